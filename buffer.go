@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+)
+
+// cursorMarker shows the model where the cursor was in a partial command
+const cursorMarker = "<cursor>"
+
+// parseBuffer interprets the command line passed by the shell integration
+// with --buffer. A "# comment" is a request in natural language and becomes
+// the query; anything else is a partial command to complete or fix, with the
+// cursor marked unless it is at the end. cursor counts characters, and -1
+// means the end.
+func parseBuffer(buffer string, cursor int) (query, partial string) {
+	trimmed := strings.TrimSpace(buffer)
+	if trimmed == "" {
+		return "", ""
+	}
+	if strings.HasPrefix(trimmed, "#") {
+		return strings.TrimSpace(strings.TrimLeft(trimmed, "#")), ""
+	}
+
+	runes := []rune(buffer)
+	if cursor < 0 || cursor > len(runes) {
+		cursor = len(runes)
+	}
+	before, after := string(runes[:cursor]), string(runes[cursor:])
+	if strings.TrimSpace(after) == "" {
+		return "", trimmed
+	}
+	return "", strings.TrimSpace(before + cursorMarker + after)
+}
+
+// partialQuery describes a session that completes a partial command in the
+// log: the command as typed, and the user's request if they gave one
+func partialQuery(partial, query string) string {
+	logQuery := "complete: " + strings.Replace(partial, cursorMarker, "", 1)
+	if query != "" {
+		logQuery += " (" + query + ")"
+	}
+	return logQuery
+}
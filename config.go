@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jerryluo/cmd/internal/config"
+	"github.com/jerryluo/cmd/internal/terminal"
+)
+
+// addSettingFlags registers the flags that override the given settings
+func addSettingFlags(fs *flag.FlagSet, keys ...string) {
+	for _, key := range keys {
+		switch key {
+		case "profile":
+			fs.String("profile", "", "Settings profile from cmd.toml to use (default: $CMD_PROFILE)")
+		case "model":
+			fs.String("model", "", "Model to use, optionally prefixed with a provider (default: opus)")
+		case "provider":
+			fs.String("provider", "", "Generation backend to use (default: cli)")
+		case "context_lines":
+			fs.Int("context-lines", terminal.ScrollbackLines, "Number of tmux scrollback lines to capture")
+		case "context_budget":
+			fs.Int("context-budget", config.DefaultContextBudget, "Estimated token limit for the prompt (0 = unlimited)")
+		}
+	}
+}
+
+// loadSettings merges the settings files, profile and environment with the
+// setting flags given on fs, creating a commented cmd.toml on first run.
+// Problems are reported as warnings.
+func loadSettings(fs *flag.FlagSet) *config.Settings {
+	if path, err := config.GetSettingsPath(); err == nil {
+		if err := config.EnsureFile(path, config.DefaultSettingsFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not create %s: %v\n", config.SettingsName, err)
+		}
+	}
+
+	profile := ""
+	if f := fs.Lookup("profile"); f != nil {
+		profile = f.Value.String()
+	}
+	settings, err := config.LoadSettings(profile)
+	// A mistyped --profile would otherwise run with the wrong model and context
+	var unknown *config.UnknownProfileError
+	if profile != "" && errors.As(err, &unknown) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", unknown)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not load settings: %v\n", err)
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "model", "provider", "context-lines", "context-budget":
+			// The flag package has already checked the type; Set rejects negative numbers
+			if err := settings.Set(strings.ReplaceAll(f.Name, "-", "_"), f.Value.String(), "--"+f.Name); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(2)
+			}
+		}
+	})
+	return settings
+}
+
+// runConfig implements `cmd config show`: print the effective settings and
+// where each one came from
+func runConfig(args []string) {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	addSettingFlags(fs, "profile", "model", "provider", "context_lines", "context_budget")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: cmd config show [options]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Print the effective settings and where each came from, with any flags applied.")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "show" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	fs.Parse(args[1:])
+
+	writeSettings(os.Stdout, loadSettings(fs))
+}
+
+// writeSettings prints settings as TOML, each value commented with its source
+func writeSettings(w io.Writer, s *config.Settings) {
+	fmt.Fprintf(w, "# Lowest precedence first: defaults, ~/.config/cmd/%s, %s files from the\n", config.SettingsName, config.ProjectSettingsName)
+	fmt.Fprintf(w, "# repository root down, the profile, $%s and $%s, then flags.\n", config.ModelEnvVar, config.ProviderEnvVar)
+	if len(s.Files) == 0 {
+		fmt.Fprintln(w, "# No settings files found.")
+	} else {
+		fmt.Fprintln(w, "# Files read:")
+		for _, path := range s.Files {
+			fmt.Fprintf(w, "#   %s\n", path)
+		}
+	}
+	if s.Profile != "" {
+		fmt.Fprintf(w, "# Profile: %s (%s)\n", s.Profile, s.Sources["profile"])
+	}
+	fmt.Fprintln(w)
+
+	cfg := config.Load(s)
+	modelSource := s.Sources["model"]
+	if modelSource == config.SourceDefault && cfg.Model != "" {
+		modelSource = "default for the " + cfg.Provider + " provider"
+	}
+	providers, providersSource := s.Providers, s.Sources["providers"]
+	if providers == nil {
+		providers, providersSource = config.ContextProviders(), "default: all"
+	}
+
+	lines := [][2]string{
+		{"model = " + strconv.Quote(cfg.Model), modelSource},
+		{"provider = " + strconv.Quote(cfg.Provider), s.Sources["provider"]},
+		{"context_lines = " + strconv.Itoa(s.ContextLines), s.Sources["context_lines"]},
+		{"context_budget = " + strconv.Itoa(s.ContextBudget), s.Sources["context_budget"]},
+		{"providers = " + tomlList(providers), providersSource},
+		{"preferences = " + tomlList(s.Preferences), s.Sources["preferences"]},
+	}
+	width := 0
+	for _, line := range lines {
+		width = max(width, len(line[0]))
+	}
+	for _, line := range lines {
+		fmt.Fprintf(w, "%-*s  # %s\n", width, line[0], line[1])
+	}
+
+	fmt.Fprintf(w, "\n[redact]  # %s; %s is applied as well\n", s.Sources["redact"], config.RedactConfigName)
+	fmt.Fprintf(w, "disabled = %s\n", tomlList(s.Redact.Disabled))
+	for _, p := range s.Redact.Patterns {
+		fmt.Fprintf(w, "\n[[redact.pattern]]\nname = %s\nregex = %s\n", strconv.Quote(p.Name), strconv.Quote(p.Regex))
+	}
+}
+
+// tomlList formats strings as a TOML array
+func tomlList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jerryluo/cmd/internal/budget"
+	"github.com/jerryluo/cmd/internal/buildtools"
+	"github.com/jerryluo/cmd/internal/claude"
+	"github.com/jerryluo/cmd/internal/config"
+	"github.com/jerryluo/cmd/internal/docs"
+	"github.com/jerryluo/cmd/internal/redact"
+	"github.com/jerryluo/cmd/internal/terminal"
+)
+
+// promptContext holds the context sources gathered once per session, with secrets redacted
+type promptContext struct {
+	claudeMd string
+	// The claude.md files and cmd.toml preferences merged into claudeMd, for the log
+	claudeMdFiles []config.ClaudeMdFile
+	preferences   []string
+	terminal      string
+	records       []terminal.Record // The tmux scrollback split into commands, nil if no prompt was found
+	info          terminal.Info     // Where the terminal context came from
+	buildTools    string
+	docs          string
+	redactions    redact.Counts
+}
+
+// gatherContext loads the user's preferences and captures the terminal, build
+// tool and documentation context, from the providers settings enable.
+// Problems are reported as warnings.
+func gatherContext(settings *config.Settings, terminalOpts terminal.Options, redactor *redact.Redactor) promptContext {
+	if err := config.EnsureClaudeMd(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not create claude.md: %v\n", err)
+	}
+
+	// Load the global claude.md and the project ones up to the repository root
+	claudeMdFiles, err := config.LoadClaudeMd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not load claude.md: %v\n", err)
+	}
+
+	// Capture terminal context from tmux, or else the shell history
+	terminalContext, terminalInfo, warning, err := terminal.Capture(terminalOpts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if warning != "" {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+
+	// Detect build tools in current directory
+	buildToolsContext := ""
+	if settings.Enabled(config.ContextBuildTools) {
+		if result := buildtools.Detect("."); result != nil {
+			buildToolsContext = result.FormatForPrompt()
+		}
+	}
+
+	// Detect documentation files
+	docsContext := ""
+	if settings.Enabled(config.ContextDocs) {
+		if result := docs.Detect("."); result != nil {
+			docsContext = result.FormatForPrompt()
+		}
+	}
+
+	// Redact secrets from every context source before it reaches the prompt or the log
+	redactions := redact.Counts{}
+	for i := range claudeMdFiles {
+		claudeMdFiles[i].Content = redactor.Redact(claudeMdFiles[i].Content, redactions)
+	}
+	var preferences []string
+	for _, preference := range settings.Preferences {
+		preferences = append(preferences, redactor.Redact(preference, redactions))
+	}
+	// Preferences from cmd.toml follow claude.md's, as a list like the default file's
+	claudeMd := config.MergeClaudeMd(claudeMdFiles)
+	if len(preferences) > 0 {
+		if claudeMd != "" {
+			claudeMd += "\n"
+		}
+		claudeMd += "- " + strings.Join(preferences, "\n- ") + "\n"
+	}
+	terminalContext = redactor.Redact(terminalContext, redactions)
+	var records []terminal.Record
+	if terminalInfo.Provider == terminal.ProviderTmux {
+		records = terminal.ParseRecords(terminalContext)
+		terminal.SetLastStatus(records, os.Getenv(terminal.LastStatusEnvVar))
+	}
+	return promptContext{
+		claudeMd:      claudeMd,
+		claudeMdFiles: claudeMdFiles,
+		preferences:   preferences,
+		terminal:      terminalContext,
+		records:       records,
+		info:          terminalInfo,
+		buildTools:    redactor.Redact(buildToolsContext, redactions),
+		docs:          redactor.Redact(docsContext, redactions),
+		redactions:    redactions,
+	}
+}
+
+// terminalText is the terminal context as sent to the model: one block per
+// command with its output if the scrollback could be split, else the raw scrollback
+func (c promptContext) terminalText() string {
+	if c.records == nil {
+		return c.terminal
+	}
+	return terminal.FormatRecords(c.records)
+}
+
+// terminalOptions scopes the terminal context to the settings' providers and
+// scrollback lines. With here, history providers only include commands that
+// refer to files in the current directory.
+func terminalOptions(settings *config.Settings, commands int, here bool) terminal.Options {
+	opts := terminal.Options{Lines: settings.ContextLines, Commands: commands, Enabled: settings.Providers}
+	if here {
+		dir, err := os.Getwd()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not get the current directory: %v\n", err)
+		}
+		opts.Dir = dir
+	}
+	return opts
+}
+
+// request adds the gathered context to req, trimming it to the token budget.
+// The query, feedback, failed command and preferences are always sent in full,
+// so they are reserved first.
+func (c promptContext) request(req claude.Request, limit int) (claude.Request, []budget.Truncation) {
+	req.ClaudeMdContent = c.claudeMd
+
+	reserved := budget.EstimateTokens(req.SystemPrompt() + req.UserPrompt())
+	sources, truncations := budget.Fit(limit, reserved, []budget.Source{
+		{Name: "terminal", Text: c.terminalText(), KeepEnd: true},
+		{Name: "build_tools", Text: c.buildTools},
+		{Name: "docs", Text: c.docs},
+	})
+	req.TerminalContext, req.BuildToolsContext, req.DocsContext = sources[0].Text, sources[1].Text, sources[2].Text
+	return req, truncations
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/jerryluo/cmd/internal/claude"
+	"github.com/jerryluo/cmd/internal/config"
+	"github.com/jerryluo/cmd/internal/logging"
+	"github.com/jerryluo/cmd/internal/safety"
+	"github.com/jerryluo/cmd/internal/terminal"
+)
+
+// maxPartWidth is the widest part printed beside its explanation; longer
+// parts get the explanation on the next line
+const maxPartWidth = 32
+
+// runExplain implements `cmd explain`: break an existing command down part by
+// part with risk notes, using the same context as generation
+func runExplain(args []string) {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	addSettingFlags(fs, "profile", "model", "provider", "context_lines", "context_budget")
+	historyCommands := fs.Int("history-commands", terminal.HistoryCommands, "Number of shell history commands to include when not in tmux")
+	historyHere := fs.Bool("history-here", false, "Only include shell history commands that refer to files in the current directory")
+	timeout := fs.Duration("timeout", config.DefaultTimeout, "Maximum time for a single generation attempt")
+	retries := fs.Int("retries", config.DefaultRetries, "Number of retries for transient generation failures")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  cmd explain [options] '<command>'   Explain a command")
+		fmt.Fprintln(os.Stderr, "  cmd explain [options] < file        Explain a command read from stdin")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	command := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if command == "" || command == "-" {
+		command = readCommand(os.Stdin)
+	}
+	if command == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	interrupts := handleInterrupts()
+
+	settings := loadSettings(fs)
+	cfg := config.Load(settings)
+	generator := setupGenerator(cfg)
+
+	// The command itself may carry secrets, e.g. a token pasted from a runbook
+	redactor := loadRedactor(settings)
+	pc := gatherContext(settings, terminalOptions(settings, *historyCommands, *historyHere), redactor)
+	redactions := pc.redactions
+	command = redactor.Redact(command, redactions)
+	reportRedactions("context", redactions)
+
+	logger := logging.NewLogger(command, pc.claudeMd, pc.terminal, pc.docs, generator.Provider(), generator.Model(), pc.info, logging.TypeExplain)
+	interrupts.setLogger(logger)
+	logger.SetPreferences(logClaudeMdFiles(pc.claudeMdFiles), pc.preferences)
+	if settings.Profile != "" {
+		logger.SetProfile(settings.Profile)
+	}
+	if redactions.Total() > 0 {
+		logger.SetRedactions(redactions)
+	}
+
+	safetyRules := loadSafetyRules()
+
+	req, truncations := pc.request(claude.Request{
+		Query:    command,
+		Template: loadPromptTemplate(),
+		Mode:     claude.ModeExplain,
+	}, settings.ContextBudget)
+	reportTruncations(settings.ContextBudget, truncations)
+	logger.SetTruncations(logTruncations(truncations))
+
+	policy := claude.RetryPolicy{
+		Timeout:    *timeout,
+		MaxRetries: *retries,
+		Backoff:    claude.DefaultRetryBackoff,
+	}
+
+	spin := startSpinner(fmt.Sprintf("Explaining command using %s", claude.Label(generator)))
+	ctx, release := interrupts.generationContext()
+	result, err := claude.GenerateWithRetry(ctx, generator, req, policy, spin.update, func(attempt int, err error) {
+		logger.AddFailedIteration("", req.SystemPrompt(), req.UserPrompt(), err.Error())
+		if claude.IsTransient(err) && attempt <= policy.MaxRetries {
+			spin.println(fmt.Sprintf("Attempt %d failed: %v. Retrying...", attempt, err))
+		}
+	})
+	release()
+
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			spin.stop("Cancelled")
+			logger.Finalize(logging.StatusQuit, "")
+			os.Exit(130)
+		}
+		spin.stop("Explanation failed")
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		logger.Finalize(logging.StatusQuit, "")
+		os.Exit(1)
+	}
+
+	summary := fmt.Sprintf("Explained command using %s", claude.Label(generator))
+	if usage := usageSummary(result); usage != "" {
+		summary += fmt.Sprintf(" (%s)", usage)
+	}
+	spin.stop(summary)
+
+	response := result.Response
+
+	// The local safety checks add to the model's risk notes
+	findings := safetyRules.Check(command)
+	logger.AddIteration("", result.SystemPrompt, result.UserPrompt, explainOutput(command, result, findings), logUsage(result))
+	logger.Finalize(logging.StatusExplained, "")
+
+	displayExplanation(command, response, findings)
+}
+
+// readCommand reads the command to explain from stdin, unless stdin is a terminal
+func readCommand(stdin *os.File) string {
+	if term.IsTerminal(int(stdin.Fd())) {
+		return ""
+	}
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// displayExplanation prints the summary, each part beside its explanation, and the risk
+func displayExplanation(command string, response *claude.Response, findings []safety.Finding) {
+	fmt.Println()
+	fmt.Printf("\033[1mCommand:\033[0m %s\n", command)
+	fmt.Println()
+	if response.Summary != "" {
+		fmt.Println(response.Summary)
+		fmt.Println()
+	}
+
+	width := 0
+	for _, part := range response.Parts {
+		if n := len(part.Text); n <= maxPartWidth && n > width {
+			width = n
+		}
+	}
+
+	fmt.Println("\033[1mBreakdown:\033[0m")
+	for _, part := range response.Parts {
+		explanation := indent(strings.TrimSpace(part.Explanation), strings.Repeat(" ", width+4))
+		if len(part.Text) > maxPartWidth {
+			fmt.Printf("  \033[36m%s\033[0m\n  %s  %s\n", part.Text, strings.Repeat(" ", width), explanation)
+			continue
+		}
+		fmt.Printf("  \033[36m%-*s\033[0m  %s\n", width, part.Text, explanation)
+	}
+	fmt.Println()
+
+	printRisk(claude.Alternative{Risk: response.Risk, RiskReasons: response.RiskReasons}, findings)
+}
+
+// indent prefixes every line after the first with prefix
+func indent(text, prefix string) string {
+	return strings.ReplaceAll(text, "\n", "\n"+prefix)
+}
+
+// explainOutput converts an explanation into its log representation: a single
+// alternative holding the explained command and its risk, broken down in Parts
+func explainOutput(command string, result *claude.GenerateResult, findings []safety.Finding) logging.ModelOutput {
+	response := result.Response
+	output := logging.ModelOutput{
+		RawResponse: result.RawOutput,
+		Command:     command,
+		Explanation: response.Summary,
+		Alternatives: []logging.Alternative{{
+			Command:     command,
+			Explanation: response.Summary,
+			Risk:        response.Risk,
+			RiskReasons: response.RiskReasons,
+			Findings:    logFindings(findings),
+		}},
+	}
+	for _, part := range response.Parts {
+		output.Parts = append(output.Parts, logging.Part{Text: part.Text, Explanation: part.Explanation})
+	}
+	return output
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jerryluo/cmd/internal/history"
+	"github.com/jerryluo/cmd/internal/redact"
+	"github.com/jerryluo/cmd/internal/terminal"
+)
+
+// maxFailedOutputLines is how much of the failed command's output is sent;
+// the error is almost always at the end
+const maxFailedOutputLines = 50
+
+// failedCommand is the command `cmd fix` corrects
+type failedCommand struct {
+	command string
+	output  string // "" if the output could not be captured
+	source  string // Where the command was found, for display
+}
+
+// findFailedCommand identifies the command to fix: command if given (the shell
+// bindings pass the last history item), else the last command in the tmux
+// scrollback that failed, or simply the last one if exit statuses aren't
+// shown, else the last one in the shell history file. Only the
+// scrollback has the output; nothing is re-run to get it. The scrollback is
+// already redacted, and the other sources are redacted here. It returns nil
+// if no command was found.
+func findFailedCommand(command string, records []terminal.Record, redactor *redact.Redactor, redactions redact.Counts) *failedCommand {
+	commands := previousCommands(records)
+	last := func() (terminal.Record, bool) {
+		for i := len(commands) - 1; i >= 0; i-- {
+			if exit := commands[i].Exit; exit != nil && *exit != 0 {
+				return commands[i], true
+			}
+		}
+		if len(commands) == 0 {
+			return terminal.Record{}, false
+		}
+		return commands[len(commands)-1], true
+	}
+
+	if command = strings.TrimSpace(command); command != "" {
+		failed := &failedCommand{command: redactor.Redact(command, redactions), source: "--command"}
+		// Use the scrollback's output if it shows the same command
+		for i := len(commands) - 1; i >= 0; i-- {
+			if commands[i].Command == failed.command {
+				failed.output = tailLines(commands[i].Output, maxFailedOutputLines)
+				break
+			}
+		}
+		return failed
+	}
+
+	if record, ok := last(); ok {
+		return &failedCommand{command: record.Command, output: tailLines(record.Output, maxFailedOutputLines), source: "tmux scrollback"}
+	}
+
+	shell := history.Shell()
+	entries, err := history.Read(shell)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not read shell history: %v\n", err)
+		return nil
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if command := strings.TrimSpace(entries[i].Command); command != "" && !isCmdInvocation(command) {
+			return &failedCommand{command: redactor.Redact(command, redactions), source: shell + " history"}
+		}
+	}
+	return nil
+}
+
+// previousCommands returns the commands in the scrollback before the current
+// prompt, leaving out empty ones and earlier runs of cmd itself
+func previousCommands(records []terminal.Record) []terminal.Record {
+	if len(records) == 0 {
+		return nil
+	}
+	var commands []terminal.Record
+	for _, record := range records[:len(records)-1] {
+		if record.Command != "" && !isCmdInvocation(record.Command) {
+			commands = append(commands, record)
+		}
+	}
+	return commands
+}
+
+// isCmdInvocation reports whether command runs cmd, e.g. an earlier `cmd fix`
+func isCmdInvocation(command string) bool {
+	fields := strings.Fields(command)
+	return len(fields) > 0 && filepath.Base(fields[0]) == "cmd"
+}
+
+// tailLines returns the last n lines of text
+func tailLines(text string, n int) string {
+	lines := strings.Split(text, "\n")
+	if len(lines) <= n {
+		return text
+	}
+	return strings.Join(lines[len(lines)-n:], "\n")
+}
+
+// fixQuery describes a fix session in the log, where there is no request of
+// its own: the failed command, and the user's hint if they gave one
+func fixQuery(failed *failedCommand, hint string) string {
+	query := "fix: " + failed.command
+	if hint != "" {
+		query += " (" + hint + ")"
+	}
+	return query
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"os"
+)
+
+// shellScripts holds the shell integrations printed by `cmd init`
+//
+//go:embed shell/cmd.fish shell/cmd.zsh shell/cmd.bash
+var shellScripts embed.FS
+
+// runInit implements `cmd init <shell>`: print the integration script for
+// the shell, to be sourced from its startup file
+func runInit(args []string) {
+	if len(args) != 1 || (args[0] != "fish" && args[0] != "zsh" && args[0] != "bash") {
+		fmt.Fprintln(os.Stderr, "Usage: cmd init <fish|zsh|bash>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Add to your shell's startup file:")
+		fmt.Fprintln(os.Stderr, "  fish  ~/.config/fish/config.fish  cmd init fish | source")
+		fmt.Fprintln(os.Stderr, "  zsh   ~/.zshrc                    eval \"$(cmd init zsh)\"")
+		fmt.Fprintln(os.Stderr, "  bash  ~/.bashrc                   eval \"$(cmd init bash)\"")
+		os.Exit(2)
+	}
+
+	script, err := shellScripts.ReadFile("shell/cmd." + args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(script)
+}
@@ -0,0 +1,107 @@
+package budget
+
+import (
+	"fmt"
+	"strings"
+)
+
+// bytesPerToken is the rough average for English text and shell output
+const bytesPerToken = 4
+
+// EstimateTokens roughly estimates the number of tokens in s
+func EstimateTokens(s string) int {
+	return (len(s) + bytesPerToken - 1) / bytesPerToken
+}
+
+// Source is one section of prompt context competing for the budget
+type Source struct {
+	Name string
+	Text string
+	// KeepEnd keeps the last lines (e.g. the most recent scrollback) instead of the first
+	KeepEnd bool
+}
+
+// Truncation records how much of a source was dropped to fit the budget
+type Truncation struct {
+	Source       string
+	Tokens       int // Estimated tokens before trimming
+	KeptTokens   int
+	DroppedLines int
+}
+
+// Fit trims sources, given from most to least important, so that together
+// with the reserved tokens (query, feedback, preferences) they fit in limit.
+// More important sources are kept whole before less important ones get any
+// space. Trimmed sources get a "[truncated N lines]" marker, which is the only
+// thing allowed past the limit. A limit of zero or less disables trimming.
+func Fit(limit, reserved int, sources []Source) ([]Source, []Truncation) {
+	if limit <= 0 {
+		return sources, nil
+	}
+
+	remaining := max(limit-reserved, 0)
+	fitted := make([]Source, len(sources))
+	var truncations []Truncation
+
+	for i, src := range sources {
+		tokens := EstimateTokens(src.Text)
+		if tokens <= remaining {
+			fitted[i] = src
+			remaining -= tokens
+			continue
+		}
+
+		text, dropped := trim(src.Text, remaining, src.KeepEnd)
+		kept := EstimateTokens(text)
+		remaining = max(remaining-kept, 0)
+
+		fitted[i] = Source{Name: src.Name, Text: text, KeepEnd: src.KeepEnd}
+		truncations = append(truncations, Truncation{
+			Source:       src.Name,
+			Tokens:       tokens,
+			KeptTokens:   kept,
+			DroppedLines: dropped,
+		})
+	}
+
+	return fitted, truncations
+}
+
+// trim keeps as many whole lines of text as fit in allowance tokens, including
+// the truncation marker, and returns the result with the number of dropped lines
+func trim(text string, allowance int, keepEnd bool) (string, int) {
+	lines := strings.Split(text, "\n")
+
+	// Reserve room for the marker assuming every line is dropped
+	budget := allowance*bytesPerToken - len(marker(len(lines))) - 1
+
+	kept := 0
+	used := 0
+	for kept < len(lines) {
+		line := lines[kept]
+		if keepEnd {
+			line = lines[len(lines)-1-kept]
+		}
+		if used+len(line)+1 > budget {
+			break
+		}
+		used += len(line) + 1
+		kept++
+	}
+
+	dropped := len(lines) - kept
+	switch {
+	case kept == 0:
+		// The marker is kept even without room for it, so the model knows the section existed
+		return marker(dropped), dropped
+	case keepEnd:
+		return marker(dropped) + "\n" + strings.Join(lines[len(lines)-kept:], "\n"), dropped
+	default:
+		return strings.Join(lines[:kept], "\n") + "\n" + marker(dropped), dropped
+	}
+}
+
+// marker is the visible note left in place of dropped lines
+func marker(lines int) string {
+	return fmt.Sprintf("[truncated %d lines]", lines)
+}
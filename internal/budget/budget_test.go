@@ -0,0 +1,76 @@
+package budget
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// numberedLines returns n lines "line 1" ... "line n"
+func numberedLines(n int) string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestFitKeepsEverythingUnderBudget(t *testing.T) {
+	sources := []Source{{Name: "terminal", Text: "$ ls\nfoo", KeepEnd: true}, {Name: "docs", Text: "# Readme"}}
+	fitted, truncations := Fit(1000, 10, sources)
+
+	if truncations != nil {
+		t.Errorf("unexpected truncations: %+v", truncations)
+	}
+	for i := range sources {
+		if fitted[i].Text != sources[i].Text {
+			t.Errorf("%s changed: %q", sources[i].Name, fitted[i].Text)
+		}
+	}
+}
+
+func TestFitPriorityAndMarkers(t *testing.T) {
+	terminal := numberedLines(200)
+	docs := numberedLines(200)
+
+	fitted, truncations := Fit(EstimateTokens(terminal)+10, 20, []Source{
+		{Name: "terminal", Text: terminal, KeepEnd: true},
+		{Name: "docs", Text: docs},
+	})
+
+	// Terminal doesn't fit with the reserved tokens: the oldest lines go
+	if !strings.HasPrefix(fitted[0].Text, "[truncated ") || !strings.HasSuffix(fitted[0].Text, "line 200") {
+		t.Errorf("terminal should keep the most recent lines:\n%s", fitted[0].Text)
+	}
+	// Nothing is left for docs but the marker
+	if fitted[1].Text != "[truncated 200 lines]" {
+		t.Errorf("docs = %q", fitted[1].Text)
+	}
+
+	if len(truncations) != 2 || truncations[0].Source != "terminal" || truncations[1].DroppedLines != 200 {
+		t.Fatalf("truncations = %+v", truncations)
+	}
+	kept := strings.Count(fitted[0].Text, "\n")
+	if truncations[0].DroppedLines != 200-kept {
+		t.Errorf("DroppedLines = %d, want %d", truncations[0].DroppedLines, 200-kept)
+	}
+	if total := 20 + EstimateTokens(fitted[0].Text); total > EstimateTokens(terminal)+10 {
+		t.Errorf("fitted context uses %d tokens, over budget", total)
+	}
+}
+
+func TestFitKeepsHead(t *testing.T) {
+	fitted, _ := Fit(30, 0, []Source{{Name: "build_tools", Text: numberedLines(50)}})
+
+	if !strings.HasPrefix(fitted[0].Text, "line 1\n") || !strings.HasSuffix(fitted[0].Text, "lines]") {
+		t.Errorf("build tools should keep the first lines:\n%s", fitted[0].Text)
+	}
+}
+
+func TestFitUnlimited(t *testing.T) {
+	text := numberedLines(1000)
+	fitted, truncations := Fit(0, 0, []Source{{Name: "terminal", Text: text}})
+	if fitted[0].Text != text || truncations != nil {
+		t.Error("a zero limit should disable trimming")
+	}
+}
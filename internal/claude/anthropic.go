@@ -0,0 +1,230 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// DefaultAnthropicBaseURL is the Messages API endpoint used when no base URL is configured
+	DefaultAnthropicBaseURL = "https://api.anthropic.com"
+
+	anthropicVersion   = "2023-06-01"
+	anthropicMaxTokens = 2048
+	anthropicToolName  = "generate_command"
+)
+
+// anthropicModelAliases maps the short names accepted by the claude CLI to API model IDs
+var anthropicModelAliases = map[string]string{
+	"opus":   "claude-opus-4-5",
+	"sonnet": "claude-sonnet-4-5",
+	"haiku":  "claude-haiku-4-5",
+}
+
+// AnthropicGenerator generates commands by calling the Anthropic Messages API directly
+type AnthropicGenerator struct {
+	model   string
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// NewAnthropicGenerator returns a Generator backed by the Messages API.
+// An empty baseURL uses DefaultAnthropicBaseURL.
+func NewAnthropicGenerator(model, apiKey, baseURL string) *AnthropicGenerator {
+	if baseURL == "" {
+		baseURL = DefaultAnthropicBaseURL
+	}
+	return &AnthropicGenerator{
+		model:   model,
+		apiKey:  apiKey,
+		baseURL: normalizeBaseURL(baseURL),
+		client:  newHTTPClient(),
+	}
+}
+
+// Provider returns ProviderAnthropic
+func (g *AnthropicGenerator) Provider() string {
+	return ProviderAnthropic
+}
+
+// Model returns the model name as configured
+func (g *AnthropicGenerator) Model() string {
+	return g.model
+}
+
+// Prompts returns the request's prompts, which are sent unchanged
+func (g *AnthropicGenerator) Prompts(req Request) (system, user string, err error) {
+	return req.Prompts()
+}
+
+// Check verifies that an API key is configured
+func (g *AnthropicGenerator) Check() error {
+	if g.apiKey == "" {
+		return fmt.Errorf("no Anthropic API key found. Set ANTHROPIC_API_KEY to use the anthropic provider")
+	}
+	return nil
+}
+
+// anthropicRequest is the request body for POST /v1/messages
+type anthropicRequest struct {
+	Model      string             `json:"model"`
+	MaxTokens  int                `json:"max_tokens"`
+	System     string             `json:"system"`
+	Messages   []anthropicMessage `json:"messages"`
+	Tools      []anthropicTool    `json:"tools"`
+	ToolChoice anthropicChoice    `json:"tool_choice"`
+	Stream     bool               `json:"stream"`
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// anthropicErrorResponse is the body the Messages API returns with an error status
+type anthropicErrorResponse struct {
+	Error *anthropicError `json:"error,omitempty"`
+}
+
+// anthropicStreamEvent is the subset of a Messages API server-sent event we use.
+// message_start carries the input usage and message_delta the running output count.
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text,omitempty"`
+		PartialJSON string `json:"partial_json,omitempty"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage,omitempty"`
+	Error *anthropicError `json:"error,omitempty"`
+}
+
+// Generate streams a Messages API call, forcing the generate_command tool so the
+// response arrives as structured tool input
+func (g *AnthropicGenerator) Generate(ctx context.Context, req Request, onProgress ProgressFunc) (*GenerateResult, error) {
+	prompt := req.UserPrompt()
+	systemPrompt := req.SystemPrompt()
+
+	headers := map[string]string{
+		"x-api-key":         g.apiKey,
+		"anthropic-version": anthropicVersion,
+	}
+	resp, err := postJSON(ctx, g.client, g.baseURL+"/v1/messages", headers, anthropicRequest{
+		Model:     resolveAnthropicModel(g.model),
+		MaxTokens: anthropicMaxTokens,
+		System:    systemPrompt,
+		Messages:  []anthropicMessage{{Role: "user", Content: prompt}},
+		Tools: []anthropicTool{{
+			Name:        anthropicToolName,
+			Description: "Return the generated shell commands and their explanations",
+			InputSchema: json.RawMessage(req.schema()),
+		}},
+		ToolChoice: anthropicChoice{Type: "tool", Name: anthropicToolName},
+		Stream:     true,
+	})
+	if err != nil {
+		return nil, streamError(ctx, transient(fmt.Errorf("failed to call Anthropic API: %w", err)))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, anthropicAPIError(resp.StatusCode, readAll(resp))
+	}
+
+	var raw, text strings.Builder
+	var usage anthropicUsage
+	toolInput := &streamAccumulator{onProgress: onProgress}
+	err = readSSE(io.TeeReader(resp.Body, &raw), func(data []byte) error {
+		var event anthropicStreamEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return nil // Skip events we don't understand
+		}
+		switch event.Type {
+		case "message_start":
+			usage = event.Message.Usage
+		case "message_delta":
+			if event.Usage != nil {
+				usage.OutputTokens = event.Usage.OutputTokens
+			}
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "input_json_delta":
+				toolInput.add(event.Delta.PartialJSON)
+			case "text_delta":
+				text.WriteString(event.Delta.Text)
+			}
+		case "error":
+			if event.Error != nil {
+				return fmt.Errorf("Anthropic API error: %s: %s", event.Error.Type, event.Error.Message)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, streamError(ctx, transient(err))
+	}
+
+	var response *Response
+	if toolInput.String() != "" {
+		response = &Response{}
+		if err := json.Unmarshal([]byte(toolInput.String()), response); err != nil {
+			return nil, transient(fmt.Errorf("failed to parse tool input: %w", err))
+		}
+		if err := response.normalize(req.Mode); err != nil {
+			return nil, err
+		}
+	} else if response, err = parseResponse(text.String(), req.Mode); err != nil {
+		// Fallback: the model answered in plain text
+		return nil, err
+	}
+
+	return &GenerateResult{
+		Response:     response,
+		SystemPrompt: systemPrompt,
+		UserPrompt:   prompt,
+		RawOutput:    raw.String(),
+		Usage:        usage.toUsage(),
+	}, nil
+}
+
+// anthropicAPIError describes an error status returned before the stream
+// starts, using the error object in the body when there is one
+func anthropicAPIError(status int, body []byte) error {
+	var apiResp anthropicErrorResponse
+	if err := json.Unmarshal(body, &apiResp); err == nil && apiResp.Error != nil {
+		return httpStatusError(status, fmt.Errorf("Anthropic API error (HTTP %d): %s: %s", status, apiResp.Error.Type, apiResp.Error.Message))
+	}
+	return httpStatusError(status, fmt.Errorf("Anthropic API error (HTTP %d): %s", status, string(body)))
+}
+
+// resolveAnthropicModel expands CLI-style aliases into API model IDs
+func resolveAnthropicModel(model string) string {
+	if id, ok := anthropicModelAliases[strings.ToLower(model)]; ok {
+		return id
+	}
+	return model
+}
@@ -0,0 +1,126 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicGenerate(t *testing.T) {
+	const body = `event: message_start
+data: {"type": "message_start", "message": {"id": "msg_1", "usage": {"input_tokens": 900, "cache_read_input_tokens": 100, "output_tokens": 1}}}
+
+event: content_block_start
+data: {"type": "content_block_start", "index": 0, "content_block": {"type": "tool_use", "name": "generate_command", "input": {}}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "input_json_delta", "partial_json": "{\"command\": \"ls -la\", \"expla"}}
+
+event: content_block_delta
+data: {"type": "content_block_delta", "index": 0, "delta": {"type": "input_json_delta", "partial_json": "nation\": \"- ls: list files\"}"}}
+
+event: message_delta
+data: {"type": "message_delta", "delta": {"stop_reason": "tool_use"}, "usage": {"output_tokens": 42}}
+
+event: message_stop
+data: {"type": "message_stop"}
+
+`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if got := r.Header.Get("x-api-key"); got != "test-key" {
+			t.Errorf("x-api-key = %q, want %q", got, "test-key")
+		}
+		if r.Header.Get("anthropic-version") == "" {
+			t.Error("missing anthropic-version header")
+		}
+
+		var req anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if req.Model != "claude-sonnet-4-5" {
+			t.Errorf("model = %q, want alias to be resolved", req.Model)
+		}
+		if req.ToolChoice.Name != anthropicToolName {
+			t.Errorf("tool_choice = %+v, want forced %s", req.ToolChoice, anthropicToolName)
+		}
+		if !strings.Contains(req.Messages[0].Content, "list files") {
+			t.Errorf("user prompt missing query: %q", req.Messages[0].Content)
+		}
+		if !req.Stream {
+			t.Error("expected streaming request")
+		}
+
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	var progress []string
+	gen := NewAnthropicGenerator("sonnet", "test-key", server.URL)
+	result, err := gen.Generate(context.Background(), Request{Query: "list files"}, func(explanation string) {
+		progress = append(progress, explanation)
+	})
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != "- ls: list files" {
+		t.Errorf("progress = %q, want streamed explanation", progress)
+	}
+
+	if result.Response.Command != "ls -la" {
+		t.Errorf("Command = %q, want %q", result.Response.Command, "ls -la")
+	}
+	if want := (Usage{InputTokens: 900, OutputTokens: 42, CacheReadTokens: 100}); result.Usage != want {
+		t.Errorf("Usage = %+v, want %+v", result.Usage, want)
+	}
+	if result.RawOutput != body {
+		t.Errorf("RawOutput not populated with response stream")
+	}
+}
+
+func TestAnthropicAPIError(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   string
+	}{
+		{529, `{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`, "Anthropic API error (HTTP 529): overloaded_error: Overloaded"},
+		{502, `Bad Gateway`, "Anthropic API error (HTTP 502): Bad Gateway"},
+	}
+
+	for _, tt := range tests {
+		if err := anthropicAPIError(tt.status, []byte(tt.body)); err == nil || err.Error() != tt.want {
+			t.Errorf("anthropicAPIError(%d) = %v, want %q", tt.status, err, tt.want)
+		}
+	}
+}
+
+func TestAnthropicCheck(t *testing.T) {
+	if err := NewAnthropicGenerator("opus", "", "").Check(); err == nil {
+		t.Error("Check() with no API key should fail")
+	}
+	if err := NewAnthropicGenerator("opus", "key", "").Check(); err != nil {
+		t.Errorf("Check() with API key failed: %v", err)
+	}
+}
+
+func TestAnthropicGenerateHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"type": "error", "error": {"type": "authentication_error", "message": "invalid x-api-key"}}`))
+	}))
+	defer server.Close()
+
+	gen := NewAnthropicGenerator("opus", "bad-key", server.URL)
+	_, err := gen.Generate(context.Background(), Request{Query: "list files"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid x-api-key") {
+		t.Errorf("Generate() error = %v, want authentication error", err)
+	}
+}
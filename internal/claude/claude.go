@@ -1,51 +1,311 @@
 package claude
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"os/exec"
 	"regexp"
 	"strings"
+	"time"
+
+	"github.com/jerryluo/cmd/internal/risk"
 )
 
 const (
 	jsonSchema = `{
 		"type": "object",
 		"properties": {
-			"command": {
+			"alternatives": {
+				"type": "array",
+				"description": "Alternative commands that accomplish the task, best first",
+				"minItems": 1,
+				"maxItems": 4,
+				"items": {
+					"type": "object",
+					"properties": {
+						"command": {
+							"type": "string",
+							"description": "The exact shell command to execute"
+						},
+						"explanation": {
+							"type": "string",
+							"description": "A breakdown explaining each tool, argument, and flag used"
+						},
+						"tradeoff": {
+							"type": "string",
+							"description": "A short note on when to prefer this variant over the others"
+						},
+						"risk": {
+							"type": "string",
+							"enum": ["low", "medium", "high"],
+							"description": "How dangerous running the command is"
+						},
+						"risk_reasons": {
+							"type": "array",
+							"items": {"type": "string"},
+							"description": "Why the command is risky, e.g. deletes files recursively; empty for low risk"
+						}
+					},
+					"required": ["command", "explanation", "tradeoff", "risk", "risk_reasons"]
+				}
+			}
+		},
+		"required": ["alternatives"]
+	}`
+
+	// scriptSchema is used instead of jsonSchema in script mode
+	scriptSchema = `{
+		"type": "object",
+		"properties": {
+			"steps": {
+				"type": "array",
+				"description": "The commands to run, in order",
+				"minItems": 1,
+				"maxItems": 9,
+				"items": {
+					"type": "object",
+					"properties": {
+						"command": {
+							"type": "string",
+							"description": "The exact shell command for this step"
+						},
+						"explanation": {
+							"type": "string",
+							"description": "A breakdown explaining each tool, argument, and flag used"
+						},
+						"risk": {
+							"type": "string",
+							"enum": ["low", "medium", "high"],
+							"description": "How dangerous running the step is"
+						},
+						"risk_reasons": {
+							"type": "array",
+							"items": {"type": "string"},
+							"description": "Why the step is risky, e.g. deletes files recursively; empty for low risk"
+						}
+					},
+					"required": ["command", "explanation", "risk", "risk_reasons"]
+				}
+			},
+			"summary": {
 				"type": "string",
-				"description": "The exact shell command to execute"
+				"description": "One sentence describing what the script does as a whole"
+			}
+		},
+		"required": ["steps", "summary"]
+	}`
+
+	// explainSchema is used instead of jsonSchema when explaining an existing command
+	explainSchema = `{
+		"type": "object",
+		"properties": {
+			"parts": {
+				"type": "array",
+				"description": "The parts of the command in order: programs, subcommands, flags with their arguments, pipes, redirections and substitutions",
+				"minItems": 1,
+				"items": {
+					"type": "object",
+					"properties": {
+						"text": {
+							"type": "string",
+							"description": "The part exactly as it appears in the command"
+						},
+						"explanation": {
+							"type": "string",
+							"description": "What this part does, in one sentence"
+						}
+					},
+					"required": ["text", "explanation"]
+				}
 			},
-			"explanation": {
+			"summary": {
 				"type": "string",
-				"description": "A breakdown explaining each tool, argument, and flag used"
+				"description": "What the whole command does, in one or two sentences"
+			},
+			"risk": {
+				"type": "string",
+				"enum": ["low", "medium", "high"],
+				"description": "How dangerous running the command is"
+			},
+			"risk_reasons": {
+				"type": "array",
+				"items": {"type": "string"},
+				"description": "Why the command is risky, e.g. deletes files recursively; empty for low risk"
 			}
 		},
-		"required": ["command", "explanation"]
+		"required": ["parts", "summary", "risk", "risk_reasons"]
 	}`
+)
+
+// Mode selects what a request asks the model for
+type Mode string
+
+const (
+	ModeCommand Mode = ""        // Alternative commands for a task
+	ModeScript  Mode = "script"  // An ordered list of steps
+	ModeExplain Mode = "explain" // A breakdown of an existing command
+	ModeFix     Mode = "fix"     // Corrected versions of a failed command
+)
 
-	systemPromptAddition = `You are a CLI command generator. Your task is to generate shell commands based on the user's natural language request.
+// jsonModeInstructions is appended to the system prompt for backends that
+// can't enforce the schema themselves
+func jsonModeInstructions(schema string) string {
+	return "\n\nRespond with a single JSON object matching this JSON schema:\n" + schema
+}
 
-IMPORTANT: You must respond with valid JSON matching the required schema. Do not include any text outside the JSON object.
+// jsonModePrompts renders the request's prompts for backends that can't
+// enforce the schema themselves, with the instructions appended
+func jsonModePrompts(req Request) (system, user string, err error) {
+	system, user, err = req.Prompts()
+	if err != nil {
+		return "", "", err
+	}
+	return system + jsonModeInstructions(req.schema()), user, nil
+}
 
-When generating commands:
-- Consider the terminal context provided to understand the user's current environment
-- Generate a single, complete command that accomplishes the task
-- In the explanation, break down each tool, argument, and flag used
-- Format the explanation with bullet points for clarity`
+// Risk levels a model can assign to a command
+const (
+	RiskLow    = risk.Low
+	RiskMedium = risk.Medium
+	RiskHigh   = risk.High
 )
 
-// Response represents the JSON response from Claude
-type Response struct {
-	Command     string `json:"command"`
+// Alternative is one candidate command with its explanation
+type Alternative struct {
+	Command     string   `json:"command"`
+	Explanation string   `json:"explanation"`
+	Tradeoff    string   `json:"tradeoff,omitempty"`
+	Risk        string   `json:"risk,omitempty"`
+	RiskReasons []string `json:"risk_reasons,omitempty"`
+}
+
+// Step is one command of a script, run in order with the others
+type Step struct {
+	Command     string   `json:"command"`
+	Explanation string   `json:"explanation"`
+	Risk        string   `json:"risk,omitempty"`
+	RiskReasons []string `json:"risk_reasons,omitempty"`
+}
+
+// Part is one token or group of tokens of an explained command
+type Part struct {
+	Text        string `json:"text"`
 	Explanation string `json:"explanation"`
 }
 
-// ClaudeResponse represents the outer JSON response from claude CLI
-type ClaudeResponse struct {
-	Result           string    `json:"result"`
-	StructuredOutput *Response `json:"structured_output"`
-	Error            bool      `json:"is_error"`
+// Response represents the JSON response from Claude.
+// Command and Explanation mirror the first alternative; responses that only set
+// them (older schema, fixtures, local models) are treated as a single alternative.
+// Script mode responses set Steps and Summary instead of Alternatives, and
+// explain mode responses set Parts, Summary, Risk and RiskReasons.
+type Response struct {
+	Alternatives []Alternative `json:"alternatives,omitempty"`
+	Command      string        `json:"command,omitempty"`
+	Explanation  string        `json:"explanation,omitempty"`
+	Steps        []Step        `json:"steps,omitempty"`
+	Summary      string        `json:"summary,omitempty"`
+	Parts        []Part        `json:"parts,omitempty"`
+	Risk         string        `json:"risk,omitempty"`
+	RiskReasons  []string      `json:"risk_reasons,omitempty"`
+}
+
+// normalize checks the response has what mode asked for. For commands it
+// fills in Alternatives or Command/Explanation from each other and drops empty
+// alternatives, failing if there is no command at all. A script becomes a
+// single alternative running every step; an explanation has no alternatives.
+// A response of the wrong shape is a transient error, so it is retried.
+func (r *Response) normalize(mode Mode) error {
+	switch mode {
+	case ModeScript:
+		return r.normalizeSteps()
+	case ModeExplain:
+		return r.normalizeParts()
+	}
+	r.Steps, r.Parts = nil, nil
+
+	alternatives := r.Alternatives[:0]
+	for _, alt := range r.Alternatives {
+		if strings.TrimSpace(alt.Command) != "" {
+			alt.Risk = normalizeRisk(alt.Risk)
+			alternatives = append(alternatives, alt)
+		}
+	}
+	r.Alternatives = alternatives
+
+	if len(r.Alternatives) == 0 {
+		if strings.TrimSpace(r.Command) == "" {
+			return transient(fmt.Errorf("response contained no command"))
+		}
+		r.Alternatives = []Alternative{{Command: r.Command, Explanation: r.Explanation}}
+	}
+
+	r.Command = r.Alternatives[0].Command
+	r.Explanation = r.Alternatives[0].Explanation
+	return nil
+}
+
+// normalizeSteps drops empty steps and sets the only alternative to the joined script,
+// rated at the risk of its riskiest step
+func (r *Response) normalizeSteps() error {
+	steps := r.Steps[:0]
+	for _, step := range r.Steps {
+		if strings.TrimSpace(step.Command) != "" {
+			step.Risk = normalizeRisk(step.Risk)
+			steps = append(steps, step)
+		}
+	}
+	r.Steps = steps
+	if len(r.Steps) == 0 {
+		return transient(fmt.Errorf("response contained no steps"))
+	}
+
+	commands := make([]string, len(r.Steps))
+	script := Alternative{Explanation: r.Summary}
+	for i, step := range r.Steps {
+		commands[i] = step.Command
+		script.Risk = risk.Max(script.Risk, step.Risk)
+		script.RiskReasons = append(script.RiskReasons, step.RiskReasons...)
+	}
+	script.Command = JoinSteps(commands)
+
+	r.Alternatives = []Alternative{script}
+	r.Command = script.Command
+	r.Explanation = script.Explanation
+	return nil
+}
+
+// normalizeParts drops empty parts of an explanation and uses the summary as its Explanation
+func (r *Response) normalizeParts() error {
+	parts := r.Parts[:0]
+	for _, part := range r.Parts {
+		if strings.TrimSpace(part.Text) != "" {
+			parts = append(parts, part)
+		}
+	}
+	r.Parts = parts
+	if len(r.Parts) == 0 {
+		return transient(fmt.Errorf("response contained no explanation"))
+	}
+
+	r.Risk = normalizeRisk(r.Risk)
+	r.Explanation = r.Summary
+	return nil
+}
+
+// JoinSteps joins step commands into one command line that stops at the first failure
+func JoinSteps(commands []string) string {
+	return strings.Join(commands, " && ")
+}
+
+// normalizeRisk maps a model-reported risk onto one of the known levels,
+// or "" if it isn't recognised
+func normalizeRisk(risk string) string {
+	switch risk = strings.ToLower(strings.TrimSpace(risk)); risk {
+	case RiskLow, RiskMedium, RiskHigh:
+		return risk
+	default:
+		return ""
+	}
 }
 
 // GenerateResult contains all data from a generation call for logging
@@ -54,79 +314,218 @@ type GenerateResult struct {
 	SystemPrompt string
 	UserPrompt   string
 	RawOutput    string
+	Usage        Usage
+	// Duration is the wall-clock time of the successful attempt
+	Duration time.Duration
 }
 
-// GenerateCommand calls the claude CLI to generate a command
-func GenerateCommand(model, claudeMdContent, terminalContext, buildToolsContext, docsContext, userQuery string, feedback string) (*GenerateResult, error) {
-	// Build the prompt
-	prompt := buildPrompt(terminalContext, buildToolsContext, docsContext, userQuery, feedback)
+// Request holds the context and query for a single generation call
+type Request struct {
+	ClaudeMdContent   string
+	TerminalContext   string
+	BuildToolsContext string
+	DocsContext       string
+	Query             string
+	// History holds the earlier commands and the feedback given on each, oldest first
+	History []Turn
+	// Template renders the prompts; nil means the built-in template
+	Template *Template
+	// Mode selects what to ask for; Query is the command to explain in ModeExplain
+	// and an optional hint in ModeFix
+	Mode Mode
+	// FailedCommand is the command to correct in ModeFix, and FailedOutput what
+	// it printed, or "" if the output could not be captured
+	FailedCommand string
+	FailedOutput  string
+	// PartialCommand is the command line the user had typed, with <cursor>
+	// marking the cursor, to complete or fix in ModeCommand
+	PartialCommand string
+}
 
-	// Build the system prompt
-	systemPrompt := systemPromptAddition
-	if claudeMdContent != "" {
-		systemPrompt = claudeMdContent + "\n\n" + systemPromptAddition
+// schema returns the JSON schema the response must match
+func (r Request) schema() string {
+	switch r.Mode {
+	case ModeScript:
+		return scriptSchema
+	case ModeExplain:
+		return explainSchema
+	default:
+		return jsonSchema
 	}
+}
 
-	// Build claude command arguments
-	args := []string{
-		"-p",
-		"--model", model,
-		"--output-format", "json",
-		"--append-system-prompt", systemPrompt,
-		"--json-schema", jsonSchema,
-		prompt,
-	}
+// Turn is one rejected command and the user's feedback on it
+type Turn struct {
+	Command  string
+	Feedback string
+}
 
-	cmd := exec.Command("claude", args...)
-	output, err := cmd.CombinedOutput()
-	rawOutput := string(output)
+// Prompts renders the system and user prompts with the request's template
+func (r Request) Prompts() (system, user string, err error) {
+	data := PromptData{
+		ClaudeMd:       r.ClaudeMdContent,
+		Terminal:       r.TerminalContext,
+		BuildTools:     r.BuildToolsContext,
+		Docs:           r.DocsContext,
+		Query:          r.Query,
+		History:        r.History,
+		Script:         r.Mode == ModeScript,
+		Explain:        r.Mode == ModeExplain,
+		Fix:            r.Mode == ModeFix,
+		FailedCommand:  r.FailedCommand,
+		FailedOutput:   r.FailedOutput,
+		PartialCommand: r.PartialCommand,
+	}
+	if len(r.History) > 0 {
+		data.Feedback = r.History[len(r.History)-1].Feedback
+	}
+	return r.Template.Render(data)
+}
 
+// prompts is Prompts, falling back to the built-in template if a custom one fails.
+// LoadTemplate checks templates up front, so this should not happen in practice.
+func (r Request) prompts() (system, user string) {
+	system, user, err := r.Prompts()
 	if err != nil {
-		// Try to parse output even on error - sometimes it contains useful info
-		if len(output) > 0 {
-			return nil, fmt.Errorf("claude CLI error: %s", rawOutput)
+		r.Template = nil
+		system, user, _ = r.Prompts()
+	}
+	return system, user
+}
+
+// SystemPrompt returns the system prompt for the request, including any user preferences
+func (r Request) SystemPrompt() string {
+	system, _ := r.prompts()
+	return system
+}
+
+// UserPrompt returns the user prompt for the request, including all context sections
+func (r Request) UserPrompt() string {
+	_, user := r.prompts()
+	return user
+}
+
+// Generator is implemented by each backend capable of producing a Response
+type Generator interface {
+	// Generate produces a command for the given request, streaming the partial
+	// explanation to onProgress (which may be nil). Cancelling ctx aborts the call.
+	Generate(ctx context.Context, req Request, onProgress ProgressFunc) (*GenerateResult, error)
+	// Check verifies the backend can be used (binary installed, credentials present, etc.)
+	Check() error
+	// Provider returns the provider name, e.g. "cli" or "ollama"
+	Provider() string
+	// Model describes the model used for generation
+	Model() string
+	// Prompts renders the system and user prompts Generate sends for the request
+	Prompts(req Request) (system, user string, err error)
+}
+
+// Provider names accepted by NewGenerator
+const (
+	ProviderCLI       = "cli"
+	ProviderAnthropic = "anthropic"
+	ProviderOpenAI    = "openai"
+	ProviderOllama    = "ollama"
+	// ProviderFixture replays a test fixture. It isn't a real backend, so it
+	// is left out of Providers, only selected with a "fixture:" model prefix,
+	// and only compiled in with -tags fixture.
+	ProviderFixture = "fixture"
+)
+
+// Providers lists every backend that can be selected by name
+var Providers = []string{ProviderCLI, ProviderAnthropic, ProviderOpenAI, ProviderOllama}
+
+// Options holds backend settings that come from configuration rather than the model name
+type Options struct {
+	AnthropicAPIKey  string
+	AnthropicBaseURL string
+	OpenAIAPIKey     string
+	OpenAIBaseURL    string
+	OllamaHost       string
+}
+
+// ParseModel splits a "provider:model" spec such as "ollama:qwen2.5-coder".
+// If the prefix is not a known provider, provider is empty and model is the full spec,
+// so model names containing colons (e.g. "qwen2.5-coder:7b") are left intact.
+func ParseModel(spec string) (provider, model string) {
+	prefix, rest, found := strings.Cut(spec, ":")
+	if !found {
+		return "", spec
+	}
+	for _, p := range append(Providers, ProviderFixture) {
+		if strings.EqualFold(prefix, p) {
+			return p, rest
 		}
-		return nil, fmt.Errorf("failed to execute claude CLI: %w", err)
 	}
+	return "", spec
+}
+
+// Label returns a display name for the generator's model, prefixed with the
+// provider unless it is the default claude CLI
+func Label(g Generator) string {
+	return FormatModel(g.Provider(), g.Model())
+}
+
+// FormatModel joins provider and model into a "provider:model" label,
+// omitting the provider for the default claude CLI
+func FormatModel(provider, model string) string {
+	if provider == "" || provider == ProviderCLI {
+		return model
+	}
+	return provider + ":" + model
+}
 
-	// Parse the outer JSON response
-	var claudeResp ClaudeResponse
-	if err := json.Unmarshal(output, &claudeResp); err != nil {
-		return nil, fmt.Errorf("failed to parse claude response: %w", err)
+// NewGenerator returns the Generator for the given provider and model.
+// A provider prefix in model (e.g. "ollama:llama3") overrides provider.
+func NewGenerator(provider, model string, opts Options) (Generator, error) {
+	if provider == ProviderFixture {
+		return nil, fmt.Errorf("unknown provider %q", provider)
+	}
+	if p, m := ParseModel(model); p != "" {
+		provider, model = p, m
 	}
 
-	if claudeResp.Error {
-		return nil, fmt.Errorf("claude returned an error")
+	switch provider {
+	case ProviderOpenAI, ProviderOllama, ProviderFixture:
+		if model == "" {
+			return nil, fmt.Errorf("the %s provider requires a model, e.g. --model %s:<model>", provider, provider)
+		}
 	}
 
-	// Check for structured_output first (used when --json-schema is provided)
-	if claudeResp.StructuredOutput != nil {
-		return &GenerateResult{
-			Response:     claudeResp.StructuredOutput,
-			SystemPrompt: systemPrompt,
-			UserPrompt:   prompt,
-			RawOutput:    rawOutput,
-		}, nil
+	switch provider {
+	case "", ProviderCLI:
+		return NewCLIGenerator(model), nil
+	case ProviderAnthropic:
+		return NewAnthropicGenerator(model, opts.AnthropicAPIKey, opts.AnthropicBaseURL), nil
+	case ProviderOpenAI:
+		return NewOpenAIGenerator(model, opts.OpenAIAPIKey, opts.OpenAIBaseURL), nil
+	case ProviderOllama:
+		return NewOllamaGenerator(model, opts.OllamaHost), nil
+	case ProviderFixture:
+		return newFixtureGenerator(model)
+	default:
+		return nil, fmt.Errorf("unknown provider %q", provider)
 	}
+}
 
-	// Fallback: parse the inner result (the actual command response)
-	// Claude sometimes wraps JSON in markdown code blocks or adds extra text
-	jsonStr := extractJSON(claudeResp.Result)
+// parseResponse extracts a Response for mode from model text that should contain a JSON object
+func parseResponse(text string, mode Mode) (*Response, error) {
+	// Models sometimes wrap JSON in markdown code blocks or add extra text
+	// Unparsable output is usually a one-off, so it is reported as transient
+	jsonStr := extractJSON(text)
 	if jsonStr == "" {
-		return nil, fmt.Errorf("no valid JSON found in response: %s", claudeResp.Result)
+		return nil, transient(fmt.Errorf("no valid JSON found in response: %s", text))
 	}
 
 	var response Response
 	if err := json.Unmarshal([]byte(jsonStr), &response); err != nil {
-		return nil, fmt.Errorf("failed to parse command response: %w (json was: %s)", err, jsonStr)
+		return nil, transient(fmt.Errorf("failed to parse command response: %w (json was: %s)", err, jsonStr))
+	}
+	if err := response.normalize(mode); err != nil {
+		return nil, err
 	}
 
-	return &GenerateResult{
-		Response:     &response,
-		SystemPrompt: systemPrompt,
-		UserPrompt:   prompt,
-		RawOutput:    rawOutput,
-	}, nil
+	return &response, nil
 }
 
 // extractJSON tries to extract a JSON object from text that may contain markdown or extra content
@@ -203,49 +602,7 @@ func extractJSONObject(text string) string {
 	return ""
 }
 
-// buildPrompt constructs the full prompt including context
-func buildPrompt(terminalContext, buildToolsContext, docsContext, userQuery, feedback string) string {
-	var sb strings.Builder
-
-	if terminalContext != "" {
-		sb.WriteString("Terminal context (recent scrollback):\n")
-		sb.WriteString("---\n")
-		sb.WriteString(terminalContext)
-		sb.WriteString("\n---\n\n")
-	}
-
-	if buildToolsContext != "" {
-		sb.WriteString("Available build tools and commands in current directory:\n")
-		sb.WriteString("---\n")
-		sb.WriteString(buildToolsContext)
-		sb.WriteString("\n---\n\n")
-	}
-
-	if docsContext != "" {
-		sb.WriteString("Project documentation (command-related sections):\n")
-		sb.WriteString("---\n")
-		sb.WriteString(docsContext)
-		sb.WriteString("\n---\n\n")
-	}
-
-	sb.WriteString("User request: ")
-	sb.WriteString(userQuery)
-
-	if feedback != "" {
-		sb.WriteString("\n\nUser feedback on previous command: ")
-		sb.WriteString(feedback)
-	}
-
-	sb.WriteString("\n\nGenerate a single shell command that accomplishes this task.")
-
-	return sb.String()
-}
-
-// CheckClaudeCLI verifies that the claude CLI is installed
-func CheckClaudeCLI() error {
-	_, err := exec.LookPath("claude")
-	if err != nil {
-		return fmt.Errorf("claude CLI not found. Please install Claude Code: https://claude.ai/code")
-	}
-	return nil
+// indent prefixes every line after the first with prefix
+func indent(text, prefix string) string {
+	return strings.ReplaceAll(text, "\n", "\n"+prefix)
 }
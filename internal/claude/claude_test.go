@@ -0,0 +1,344 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"plain object", `{"command": "ls"}`, `{"command": "ls"}`},
+		{"trailing text", `{"command": "ls"} hope this helps`, `{"command": "ls"}`},
+		{"markdown fence", "Here you go:\n```json\n{\"command\": \"ls\"}\n```", `{"command": "ls"}`},
+		{"leading prose", `Sure! {"command": "echo }"} done`, `{"command": "echo }"}`},
+		{"escaped quote", `{"command": "echo \"{\""}`, `{"command": "echo \"{\""}`},
+		{"no json", "I can't help with that", ""},
+	}
+
+	for _, tt := range tests {
+		if got := extractJSON(tt.text); got != tt.expected {
+			t.Errorf("%s: extractJSON() = %q, want %q", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestParseCLIOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		command string
+		wantErr bool
+	}{
+		{
+			name:    "structured output",
+			output:  `{"result": "", "structured_output": {"command": "git status", "explanation": "- git"}, "is_error": false}`,
+			command: "git status",
+		},
+		{
+			name:    "alternatives",
+			output:  `{"result": "", "structured_output": {"alternatives": [{"command": "", "explanation": ""}, {"command": "fd -e go", "explanation": "- fd", "tradeoff": "faster"}, {"command": "find . -name '*.go'", "explanation": "- find", "tradeoff": "portable"}]}, "is_error": false}`,
+			command: "fd -e go",
+		},
+		{
+			name:    "empty alternatives",
+			output:  `{"result": "", "structured_output": {"alternatives": []}, "is_error": false}`,
+			wantErr: true,
+		},
+		{
+			name:    "result fallback",
+			output:  `{"result": "` + "```json\\n{\\\"command\\\": \\\"pwd\\\", \\\"explanation\\\": \\\"x\\\"}\\n```" + `", "is_error": false}`,
+			command: "pwd",
+		},
+		{
+			name:    "is_error",
+			output:  `{"result": "rate limited", "is_error": true}`,
+			wantErr: true,
+		},
+		{
+			name:    "not json",
+			output:  `Error: not logged in`,
+			wantErr: true,
+		},
+		{
+			name:    "result without json",
+			output:  `{"result": "I cannot do that", "is_error": false}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		resp, _, err := parseCLIOutput([]byte(tt.output), ModeCommand)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error, got %+v", tt.name, resp)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if resp.Command != tt.command {
+			t.Errorf("%s: Command = %q, want %q", tt.name, resp.Command, tt.command)
+		}
+	}
+}
+
+func TestParseCLIOutputUsage(t *testing.T) {
+	output := `{"type": "result", "result": "", "structured_output": {"command": "ls", "explanation": "- ls"}, "is_error": false,
+		"total_cost_usd": 0.0123, "usage": {"input_tokens": 12, "cache_read_input_tokens": 3000, "cache_creation_input_tokens": 500, "output_tokens": 80}}`
+
+	_, usage, err := parseCLIOutput([]byte(output), ModeCommand)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Usage{InputTokens: 12, OutputTokens: 80, CacheReadTokens: 3000, CacheWriteTokens: 500, CostUSD: 0.0123}
+	if usage != want {
+		t.Errorf("usage = %+v, want %+v", usage, want)
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	usage := Usage{InputTokens: 1_000_000, OutputTokens: 100_000}
+
+	tests := []struct {
+		provider, model string
+		cost            float64
+		ok              bool
+	}{
+		{ProviderAnthropic, "sonnet", 4.5, true},
+		{ProviderAnthropic, "claude-sonnet-4-5-20250929", 4.5, true},
+		{ProviderAnthropic, "claude-opus-4-1", 22.5, true},
+		{ProviderOpenAI, "gpt-4o-mini", 0.21, true},
+		{ProviderOllama, "llama3", 0, true},
+		{ProviderOpenAI, "qwen2.5-coder", 0, false},
+	}
+
+	for _, tt := range tests {
+		cost, ok := EstimateCost(tt.provider, tt.model, usage)
+		if ok != tt.ok || math.Abs(cost-tt.cost) > 1e-9 {
+			t.Errorf("EstimateCost(%s, %s) = %v, %v; want %v, %v", tt.provider, tt.model, cost, ok, tt.cost, tt.ok)
+		}
+	}
+}
+
+func TestParseResponseRisk(t *testing.T) {
+	resp, err := parseResponse(`{"alternatives": [
+		{"command": "rm -rf build", "explanation": "- rm", "risk": "HIGH", "risk_reasons": ["deletes files recursively"]},
+		{"command": "ls build", "explanation": "- ls", "risk": "none"}
+	]}`, ModeCommand)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Alternatives[0].Risk; got != RiskHigh {
+		t.Errorf("Risk = %q, want %q", got, RiskHigh)
+	}
+	if got := resp.Alternatives[0].RiskReasons; len(got) != 1 || got[0] != "deletes files recursively" {
+		t.Errorf("RiskReasons = %q", got)
+	}
+	if got := resp.Alternatives[1].Risk; got != "" {
+		t.Errorf("unknown risk should be dropped, got %q", got)
+	}
+}
+
+func TestParseResponseSteps(t *testing.T) {
+	resp, err := parseResponse(`{"steps": [
+		{"command": "python -m venv .venv", "explanation": "- venv", "risk": "medium", "risk_reasons": ["creates .venv"]},
+		{"command": " ", "explanation": "empty"},
+		{"command": ".venv/bin/pip install -r requirements.txt", "explanation": "- pip", "risk": "low"}
+	], "summary": "Set up a virtualenv"}`, ModeScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Steps) != 2 {
+		t.Fatalf("got %d steps, want 2 (empty step dropped)", len(resp.Steps))
+	}
+	if len(resp.Alternatives) != 1 {
+		t.Fatalf("got %d alternatives, want the joined script only", len(resp.Alternatives))
+	}
+	script := resp.Alternatives[0]
+	if want := "python -m venv .venv && .venv/bin/pip install -r requirements.txt"; script.Command != want || resp.Command != want {
+		t.Errorf("Command = %q, want %q", script.Command, want)
+	}
+	if script.Explanation != "Set up a virtualenv" || script.Risk != RiskMedium {
+		t.Errorf("script = %+v, want summary as explanation and the riskiest step's risk", script)
+	}
+
+	if _, err := parseResponse(`{"steps": [{"command": ""}], "summary": "nothing"}`, ModeScript); err == nil {
+		t.Error("expected an error for a script with no commands")
+	}
+	// A script request answered with a plain command is retried, not run as a one-step script
+	if _, err := parseResponse(`{"command": "ls", "explanation": "- ls"}`, ModeScript); !IsTransient(err) {
+		t.Errorf("script mode without steps: error = %v, want a transient error", err)
+	}
+	// Steps in a command response are ignored
+	resp, err = parseResponse(`{"command": "ls", "explanation": "- ls", "steps": [{"command": "rm -rf /"}]}`, ModeCommand)
+	if err != nil || resp.Steps != nil || resp.Command != "ls" {
+		t.Errorf("command mode with steps = %+v, %v", resp, err)
+	}
+}
+
+func TestParseResponseParts(t *testing.T) {
+	resp, err := parseResponse(`{"summary": "Counts lines of Go code", "risk": "LOW", "parts": [
+		{"text": "find . -name '*.go'", "explanation": "list Go files"},
+		{"text": "", "explanation": "empty"},
+		{"text": "| xargs wc -l", "explanation": "count their lines"}
+	]}`, ModeExplain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Parts) != 2 || resp.Parts[1].Text != "| xargs wc -l" {
+		t.Errorf("Parts = %+v, want the empty part dropped", resp.Parts)
+	}
+	if resp.Risk != RiskLow || resp.Explanation != "Counts lines of Go code" || len(resp.Alternatives) != 0 {
+		t.Errorf("response = %+v", resp)
+	}
+
+	if _, err := parseResponse(`{"command": "ls", "explanation": "- ls"}`, ModeExplain); !IsTransient(err) {
+		t.Errorf("explain mode without parts: error = %v, want a transient error", err)
+	}
+}
+
+func TestBuildPrompt(t *testing.T) {
+	history := []Turn{
+		{Command: "make", Feedback: "use -j"},
+		{Command: "make -j", Feedback: "limit to 4 jobs"},
+	}
+	prompt := Request{
+		TerminalContext:   "$ make\nerror",
+		BuildToolsContext: "make (Makefile):\n  - build",
+		Query:             "fix the build",
+		History:           history,
+	}.UserPrompt()
+
+	for _, want := range []string{"Terminal context", "$ make", "Available build tools", "User request: fix the build",
+		"1. Command: make\n   Feedback: use -j", "2. Command: make -j\n   Feedback: limit to 4 jobs", "taking all of the feedback into account"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt missing %q:\n%s", want, prompt)
+		}
+	}
+	if strings.Contains(prompt, "Project documentation") {
+		t.Error("prompt should omit empty docs section")
+	}
+
+	script := Request{Query: "set up a venv", Mode: ModeScript}
+	if user := script.UserPrompt(); !strings.Contains(user, "Generate the steps of a shell script") {
+		t.Errorf("script prompt should ask for steps:\n%s", user)
+	}
+	if system := script.SystemPrompt(); !strings.Contains(system, "When generating steps") {
+		t.Errorf("script system prompt should describe steps:\n%s", system)
+	}
+
+	explain := Request{Query: "tar xzf a.tgz", Mode: ModeExplain}
+	if user := explain.UserPrompt(); !strings.Contains(user, "Command to explain: tar xzf a.tgz") || strings.Contains(user, "Generate") {
+		t.Errorf("explain prompt should ask for an explanation only:\n%s", user)
+	}
+
+	fix := Request{Mode: ModeFix, FailedCommand: "gti status", FailedOutput: "gti: command not found"}
+	user := fix.UserPrompt()
+	for _, want := range []string{"Failed command: gti status", "gti: command not found", "Generate a corrected command"} {
+		if !strings.Contains(user, want) {
+			t.Errorf("fix prompt missing %q:\n%s", want, user)
+		}
+	}
+	if strings.Contains(user, "User request:") {
+		t.Errorf("fix prompt without a hint should have no request:\n%s", user)
+	}
+	fix.FailedOutput, fix.Query = "", "it's git"
+	if user := fix.UserPrompt(); !strings.Contains(user, "output was not captured") || !strings.Contains(user, "User request: it's git") {
+		t.Errorf("fix prompt should note the missing output and include the hint:\n%s", user)
+	}
+
+	partial := Request{PartialCommand: "git comit<cursor> -m wip"}
+	user = partial.UserPrompt()
+	for _, want := range []string{"Partial command on the user's command line", "---\ngit comit<cursor> -m wip\n---", "Generate the complete command the user is typing."} {
+		if !strings.Contains(user, want) {
+			t.Errorf("partial prompt missing %q:\n%s", want, user)
+		}
+	}
+	if strings.Contains(user, "User request:") || !strings.Contains(partial.SystemPrompt(), "Complete the partial command") {
+		t.Errorf("partial prompt without a request should only ask to complete it:\n%s", user)
+	}
+}
+
+func TestPartialStringField(t *testing.T) {
+	tests := []struct {
+		partial  string
+		expected string
+	}{
+		{`{"command": "ls", "expla`, ""},
+		{`{"command": "ls", "explanation": "- ls: li`, "- ls: li"},
+		{`{"command": "ls", "explanation": "a\nb \"q\"`, "a\nb \"q\""},
+		{`{"command": "ls", "explanation": "done"}`, "done"},
+		{`{"explanation": "trailing escape \`, "trailing escape "},
+	}
+
+	for _, tt := range tests {
+		if got := partialStringField(tt.partial, "explanation"); got != tt.expected {
+			t.Errorf("partialStringField(%q) = %q, want %q", tt.partial, got, tt.expected)
+		}
+	}
+}
+
+// fakeClaude installs a shell script named claude on PATH for the duration of the test
+func fakeClaude(t *testing.T, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "claude"), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestCLIGenerateStream(t *testing.T) {
+	fakeClaude(t, `cat <<'EOF'
+{"type": "system", "subtype": "init"}
+{"type": "stream_event", "event": {"type": "content_block_delta", "index": 0, "delta": {"type": "input_json_delta", "partial_json": "{\"command\": \"ls\", \"explanation\": \"- ls"}}}
+{"type": "stream_event", "event": {"type": "content_block_delta", "index": 0, "delta": {"type": "input_json_delta", "partial_json": ": list\"}"}}}
+{"type": "result", "subtype": "success", "result": "", "structured_output": {"command": "ls", "explanation": "- ls: list"}, "is_error": false}
+EOF
+`)
+
+	var progress []string
+	result, err := NewCLIGenerator("opus").Generate(context.Background(), Request{Query: "list"}, func(explanation string) {
+		progress = append(progress, explanation)
+	})
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if result.Response.Command != "ls" {
+		t.Errorf("Command = %q, want ls", result.Response.Command)
+	}
+	if !strings.HasPrefix(result.RawOutput, `{"type": "result"`) {
+		t.Errorf("RawOutput should be the result event, got %q", result.RawOutput)
+	}
+	if want := []string{"- ls", "- ls: list"}; strings.Join(progress, "|") != strings.Join(want, "|") {
+		t.Errorf("progress = %q, want %q", progress, want)
+	}
+}
+
+func TestCLIGenerateCancel(t *testing.T) {
+	fakeClaude(t, "exec sleep 10\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := NewCLIGenerator("opus").Generate(ctx, Request{Query: "list"}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Generate() error = %v, want context.Canceled", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("cancellation did not stop the subprocess")
+	}
+}
@@ -0,0 +1,187 @@
+package claude
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ClaudeResponse represents the outer JSON response from claude CLI
+type ClaudeResponse struct {
+	Result           string         `json:"result"`
+	StructuredOutput *Response      `json:"structured_output"`
+	Error            bool           `json:"is_error"`
+	TotalCostUSD     float64        `json:"total_cost_usd"`
+	Usage            anthropicUsage `json:"usage"`
+}
+
+// cliStreamEvent is the subset of a claude CLI stream-json line we use
+type cliStreamEvent struct {
+	Type  string `json:"type"`
+	Event struct {
+		Type  string `json:"type"`
+		Delta struct {
+			Type        string `json:"type"`
+			Text        string `json:"text,omitempty"`
+			PartialJSON string `json:"partial_json,omitempty"`
+		} `json:"delta"`
+	} `json:"event"`
+}
+
+// CLIGenerator generates commands by shelling out to the Claude Code CLI
+type CLIGenerator struct {
+	model string
+}
+
+// NewCLIGenerator returns a Generator backed by the claude CLI
+func NewCLIGenerator(model string) *CLIGenerator {
+	return &CLIGenerator{model: model}
+}
+
+// Provider returns ProviderCLI
+func (g *CLIGenerator) Provider() string {
+	return ProviderCLI
+}
+
+// Model returns the model passed to the claude CLI
+func (g *CLIGenerator) Model() string {
+	return g.model
+}
+
+// Prompts returns the request's prompts, which are sent unchanged
+func (g *CLIGenerator) Prompts(req Request) (system, user string, err error) {
+	return req.Prompts()
+}
+
+// Check verifies that the claude CLI is installed
+func (g *CLIGenerator) Check() error {
+	return CheckClaudeCLI()
+}
+
+// Generate calls the claude CLI to generate a command, streaming partial output
+func (g *CLIGenerator) Generate(ctx context.Context, req Request, onProgress ProgressFunc) (*GenerateResult, error) {
+	prompt := req.UserPrompt()
+	systemPrompt := req.SystemPrompt()
+
+	// Build claude command arguments
+	args := []string{
+		"-p",
+		"--model", g.model,
+		"--output-format", "stream-json",
+		"--verbose",
+		"--include-partial-messages",
+		"--append-system-prompt", systemPrompt,
+		"--json-schema", req.schema(),
+		prompt,
+	}
+
+	cmd := exec.CommandContext(ctx, "claude", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute claude CLI: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to execute claude CLI: %w", err)
+	}
+
+	// Each line is a JSON event; partial deltas carry the structured output as it is
+	// generated and the final "result" event has the same shape as --output-format json
+	var resultLine []byte
+	partial := &streamAccumulator{onProgress: onProgress}
+	scanErr := readLines(stdout, func(line []byte) error {
+		var event cliStreamEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil // Skip non-JSON noise
+		}
+		switch event.Type {
+		case "stream_event":
+			if event.Event.Type == "content_block_delta" {
+				partial.add(event.Event.Delta.PartialJSON + event.Event.Delta.Text)
+			}
+		case "result":
+			resultLine = append([]byte(nil), line...)
+		}
+		return nil
+	})
+	waitErr := cmd.Wait()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if scanErr != nil {
+		return nil, transient(fmt.Errorf("failed to read claude CLI output: %w", scanErr))
+	}
+	if resultLine == nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, transient(fmt.Errorf("claude CLI error: %s", msg))
+		}
+		if waitErr != nil {
+			return nil, transient(fmt.Errorf("failed to execute claude CLI: %w", waitErr))
+		}
+		return nil, transient(fmt.Errorf("claude CLI produced no result"))
+	}
+	rawOutput := string(resultLine)
+
+	response, usage, err := parseCLIOutput(resultLine, req.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GenerateResult{
+		Response:     response,
+		SystemPrompt: systemPrompt,
+		UserPrompt:   prompt,
+		RawOutput:    rawOutput,
+		Usage:        usage,
+	}, nil
+}
+
+// parseCLIOutput extracts the Response and the reported usage and cost from
+// the claude CLI's JSON output
+func parseCLIOutput(output []byte, mode Mode) (*Response, Usage, error) {
+	// Parse the outer JSON response
+	var claudeResp ClaudeResponse
+	if err := json.Unmarshal(output, &claudeResp); err != nil {
+		return nil, Usage{}, transient(fmt.Errorf("failed to parse claude response: %w", err))
+	}
+
+	usage := claudeResp.Usage.toUsage()
+	usage.CostUSD = claudeResp.TotalCostUSD
+	response, err := parseCLIResponse(claudeResp, mode)
+	return response, usage, err
+}
+
+// parseCLIResponse extracts the Response from a parsed claude CLI result
+func parseCLIResponse(claudeResp ClaudeResponse, mode Mode) (*Response, error) {
+	if claudeResp.Error {
+		if claudeResp.Result != "" {
+			return nil, transient(fmt.Errorf("claude returned an error: %s", claudeResp.Result))
+		}
+		return nil, transient(fmt.Errorf("claude returned an error"))
+	}
+
+	// Check for structured_output first (used when --json-schema is provided)
+	if claudeResp.StructuredOutput != nil {
+		if err := claudeResp.StructuredOutput.normalize(mode); err != nil {
+			return nil, err
+		}
+		return claudeResp.StructuredOutput, nil
+	}
+
+	// Fallback: parse the inner result (the actual command response)
+	return parseResponse(claudeResp.Result, mode)
+}
+
+// CheckClaudeCLI verifies that the claude CLI is installed
+func CheckClaudeCLI() error {
+	_, err := exec.LookPath("claude")
+	if err != nil {
+		return fmt.Errorf("claude CLI not found. Please install Claude Code: https://claude.ai/code")
+	}
+	return nil
+}
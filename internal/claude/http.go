@@ -0,0 +1,63 @@
+package claude
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// httpTimeout bounds a single HTTP generation call
+const httpTimeout = 5 * time.Minute
+
+// newHTTPClient returns the client shared by the HTTP backends
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: httpTimeout}
+}
+
+// postJSON encodes body as JSON and POSTs it to url. The caller must close the response body.
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("content-type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	return client.Do(req)
+}
+
+// readAll reads a non-streaming (usually error) response body
+func readAll(resp *http.Response) []byte {
+	output, _ := io.ReadAll(resp.Body)
+	return output
+}
+
+// streamError returns the context's error if it was cancelled, otherwise err.
+// This keeps cancellation distinguishable from backend failures.
+func streamError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// normalizeBaseURL trims trailing slashes and adds a scheme to bare host:port values
+func normalizeBaseURL(baseURL string) string {
+	baseURL = strings.TrimRight(baseURL, "/")
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+	return baseURL
+}
@@ -0,0 +1,149 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultOllamaHost is the Ollama server used when no host is configured
+const DefaultOllamaHost = "http://localhost:11434"
+
+// OllamaGenerator generates commands via Ollama's native /api/chat endpoint
+type OllamaGenerator struct {
+	model  string
+	host   string
+	client *http.Client
+}
+
+// NewOllamaGenerator returns a Generator backed by an Ollama server.
+// An empty host uses DefaultOllamaHost.
+func NewOllamaGenerator(model, host string) *OllamaGenerator {
+	if host == "" {
+		host = DefaultOllamaHost
+	}
+	return &OllamaGenerator{
+		model:  model,
+		host:   normalizeBaseURL(host),
+		client: newHTTPClient(),
+	}
+}
+
+// Provider returns ProviderOllama
+func (g *OllamaGenerator) Provider() string {
+	return ProviderOllama
+}
+
+// Model returns the model name as configured
+func (g *OllamaGenerator) Model() string {
+	return g.model
+}
+
+// Prompts returns the request's prompts, with the schema appended to the
+// system prompt since JSON mode doesn't enforce it
+func (g *OllamaGenerator) Prompts(req Request) (system, user string, err error) {
+	return jsonModePrompts(req)
+}
+
+// Check verifies the Ollama server is reachable
+func (g *OllamaGenerator) Check() error {
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(g.host + "/api/version")
+	if err != nil {
+		return fmt.Errorf("Ollama server not reachable at %s. Start it with 'ollama serve' or set OLLAMA_HOST", g.host)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ollamaRequest is the request body for POST /api/chat
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []openAIMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Format   json.RawMessage `json:"format"`
+}
+
+// ollamaResponse is the subset of an /api/chat response or stream chunk we use
+type ollamaResponse struct {
+	Message openAIMessage `json:"message"`
+	Done    bool          `json:"done"`
+	Error   string        `json:"error,omitempty"`
+	// Token counts, sent with the final chunk
+	PromptEvalCount int `json:"prompt_eval_count,omitempty"`
+	EvalCount       int `json:"eval_count,omitempty"`
+}
+
+// Generate streams an /api/chat call, constraining output to the response schema
+func (g *OllamaGenerator) Generate(ctx context.Context, req Request, onProgress ProgressFunc) (*GenerateResult, error) {
+	prompt := req.UserPrompt()
+	systemPrompt := req.SystemPrompt() + jsonModeInstructions(req.schema())
+
+	resp, err := postJSON(ctx, g.client, g.host+"/api/chat", nil, ollamaRequest{
+		Model: g.model,
+		Messages: []openAIMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: prompt},
+		},
+		Stream: true,
+		Format: json.RawMessage(req.schema()),
+	})
+	if err != nil {
+		return nil, streamError(ctx, transient(fmt.Errorf("failed to call Ollama at %s: %w", g.host, err)))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, ollamaAPIError(resp.StatusCode, readAll(resp))
+	}
+
+	// Ollama streams newline-delimited JSON objects
+	var raw strings.Builder
+	var usage Usage
+	content := &streamAccumulator{onProgress: onProgress}
+	err = readLines(io.TeeReader(resp.Body, &raw), func(line []byte) error {
+		var chunk ollamaResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return nil // Skip lines we don't understand
+		}
+		if chunk.Error != "" {
+			return fmt.Errorf("Ollama error: %s", chunk.Error)
+		}
+		content.add(chunk.Message.Content)
+		if chunk.Done {
+			usage = Usage{InputTokens: chunk.PromptEvalCount, OutputTokens: chunk.EvalCount}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, streamError(ctx, transient(err))
+	}
+
+	response, err := parseResponse(content.String(), req.Mode)
+	if err != nil {
+		return nil, err
+	}
+	rawOutput := raw.String()
+
+	return &GenerateResult{
+		Response:     response,
+		SystemPrompt: systemPrompt,
+		UserPrompt:   prompt,
+		RawOutput:    rawOutput,
+		Usage:        usage,
+	}, nil
+}
+
+// ollamaAPIError describes an error status returned before the stream
+// starts, using the error message in the body when there is one
+func ollamaAPIError(status int, body []byte) error {
+	var apiResp ollamaResponse
+	if err := json.Unmarshal(body, &apiResp); err == nil && apiResp.Error != "" {
+		return httpStatusError(status, fmt.Errorf("Ollama error (HTTP %d): %s", status, apiResp.Error))
+	}
+	return httpStatusError(status, fmt.Errorf("Ollama error (HTTP %d): %s", status, strings.TrimSpace(string(body))))
+}
@@ -0,0 +1,187 @@
+package claude
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultOpenAIBaseURL is the chat completions endpoint used when no base URL is configured
+const DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAIGenerator generates commands via an OpenAI-compatible /v1/chat/completions
+// endpoint, such as OpenAI itself or llama.cpp's server
+type OpenAIGenerator struct {
+	model   string
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// NewOpenAIGenerator returns a Generator backed by a chat completions endpoint.
+// An empty baseURL uses DefaultOpenAIBaseURL.
+func NewOpenAIGenerator(model, apiKey, baseURL string) *OpenAIGenerator {
+	if baseURL == "" {
+		baseURL = DefaultOpenAIBaseURL
+	}
+	return &OpenAIGenerator{
+		model:   model,
+		apiKey:  apiKey,
+		baseURL: normalizeBaseURL(baseURL),
+		client:  newHTTPClient(),
+	}
+}
+
+// Provider returns ProviderOpenAI
+func (g *OpenAIGenerator) Provider() string {
+	return ProviderOpenAI
+}
+
+// Model returns the model name as configured
+func (g *OpenAIGenerator) Model() string {
+	return g.model
+}
+
+// Prompts returns the request's prompts, with the schema appended to the
+// system prompt since JSON mode doesn't enforce it
+func (g *OpenAIGenerator) Prompts(req Request) (system, user string, err error) {
+	return jsonModePrompts(req)
+}
+
+// Check verifies an API key is configured when talking to the hosted OpenAI API.
+// Local OpenAI-compatible servers usually don't require one.
+func (g *OpenAIGenerator) Check() error {
+	if g.apiKey == "" && g.baseURL == DefaultOpenAIBaseURL {
+		return fmt.Errorf("no OpenAI API key found. Set OPENAI_API_KEY, or OPENAI_BASE_URL for a local server")
+	}
+	return nil
+}
+
+// openAIRequest is the request body for POST /chat/completions
+type openAIRequest struct {
+	Model          string          `json:"model"`
+	Messages       []openAIMessage `json:"messages"`
+	ResponseFormat openAIFormat    `json:"response_format"`
+	Stream         bool            `json:"stream"`
+	// StreamOptions asks for a final usage chunk; only sent to the hosted API,
+	// since not every compatible server accepts it
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIFormat struct {
+	Type string `json:"type"`
+}
+
+// openAIErrorResponse is the body the chat completions API returns with an error status
+type openAIErrorResponse struct {
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// openAIStreamChunk is the subset of a streamed chat completions chunk we use
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta openAIMessage `json:"delta"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage,omitempty"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Generate streams a chat completions call in JSON mode
+func (g *OpenAIGenerator) Generate(ctx context.Context, req Request, onProgress ProgressFunc) (*GenerateResult, error) {
+	prompt := req.UserPrompt()
+	systemPrompt := req.SystemPrompt() + jsonModeInstructions(req.schema())
+
+	headers := map[string]string{}
+	if g.apiKey != "" {
+		headers["authorization"] = "Bearer " + g.apiKey
+	}
+	body := openAIRequest{
+		Model: g.model,
+		Messages: []openAIMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: prompt},
+		},
+		ResponseFormat: openAIFormat{Type: "json_object"},
+		Stream:         true,
+	}
+	if g.baseURL == DefaultOpenAIBaseURL {
+		body.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+	resp, err := postJSON(ctx, g.client, g.baseURL+"/chat/completions", headers, body)
+	if err != nil {
+		return nil, streamError(ctx, transient(fmt.Errorf("failed to call %s: %w", g.baseURL, err)))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, openAIAPIError(resp.StatusCode, readAll(resp))
+	}
+
+	var raw strings.Builder
+	var usage Usage
+	content := &streamAccumulator{onProgress: onProgress}
+	err = readSSE(io.TeeReader(resp.Body, &raw), func(data []byte) error {
+		if bytes.Equal(data, []byte("[DONE]")) {
+			return nil
+		}
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return nil // Skip chunks we don't understand
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("OpenAI API error: %s", chunk.Error.Message)
+		}
+		if chunk.Usage != nil {
+			usage = Usage{InputTokens: chunk.Usage.PromptTokens, OutputTokens: chunk.Usage.CompletionTokens}
+		}
+		for _, choice := range chunk.Choices {
+			content.add(choice.Delta.Content)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, streamError(ctx, transient(err))
+	}
+
+	response, err := parseResponse(content.String(), req.Mode)
+	if err != nil {
+		return nil, err
+	}
+	rawOutput := raw.String()
+
+	return &GenerateResult{
+		Response:     response,
+		SystemPrompt: systemPrompt,
+		UserPrompt:   prompt,
+		RawOutput:    rawOutput,
+		Usage:        usage,
+	}, nil
+}
+
+// openAIAPIError describes an error status returned before the stream
+// starts, using the error message in the body when there is one
+func openAIAPIError(status int, body []byte) error {
+	var apiResp openAIErrorResponse
+	if err := json.Unmarshal(body, &apiResp); err == nil && apiResp.Error != nil {
+		return httpStatusError(status, fmt.Errorf("OpenAI API error (HTTP %d): %s", status, apiResp.Error.Message))
+	}
+	return httpStatusError(status, fmt.Errorf("OpenAI API error (HTTP %d): %s", status, strings.TrimSpace(string(body))))
+}
@@ -0,0 +1,108 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAIGenerate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if got := r.Header.Get("authorization"); got != "" {
+			t.Errorf("authorization header sent without API key: %q", got)
+		}
+
+		var req openAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if req.ResponseFormat.Type != "json_object" {
+			t.Errorf("response_format = %q, want json_object", req.ResponseFormat.Type)
+		}
+		if !strings.Contains(req.Messages[0].Content, `"command"`) {
+			t.Error("system prompt should include the JSON schema")
+		}
+
+		if !req.Stream {
+			t.Error("expected streaming request")
+		}
+
+		w.Write([]byte(`data: {"choices": [{"delta": {"content": "{\"command\": \"ss -tlnp\", "}}]}` + "\n\n"))
+		w.Write([]byte(`data: {"choices": [{"delta": {"content": "\"explanation\": \"- ss: sockets\"}"}}]}` + "\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	gen := NewOpenAIGenerator("qwen2.5-coder", "", server.URL+"/v1")
+	if err := gen.Check(); err != nil {
+		t.Errorf("Check() for local server should not require a key: %v", err)
+	}
+
+	result, err := gen.Generate(context.Background(), Request{Query: "list listening ports"}, nil)
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if result.Response.Command != "ss -tlnp" {
+		t.Errorf("Command = %q, want %q", result.Response.Command, "ss -tlnp")
+	}
+}
+
+func TestOllamaGenerate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+
+		var req ollamaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if !req.Stream {
+			t.Error("expected streaming request")
+		}
+		if len(req.Format) == 0 {
+			t.Error("expected format to carry the response schema")
+		}
+
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "{\"command\": \"du -sh *\", "}, "done": false}` + "\n"))
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "\"explanation\": \"- du: disk usage\"}"}, "done": false}` + "\n"))
+		w.Write([]byte(`{"message": {"role": "assistant", "content": ""}, "done": true}` + "\n"))
+	}))
+	defer server.Close()
+
+	gen := NewOllamaGenerator("qwen2.5-coder", strings.TrimPrefix(server.URL, "http://"))
+	result, err := gen.Generate(context.Background(), Request{Query: "disk usage"}, nil)
+	if err != nil {
+		t.Fatalf("Generate() error: %v", err)
+	}
+	if result.Response.Command != "du -sh *" {
+		t.Errorf("Command = %q, want %q", result.Response.Command, "du -sh *")
+	}
+}
+
+func TestParseModel(t *testing.T) {
+	tests := []struct {
+		spec     string
+		provider string
+		model    string
+	}{
+		{"opus", "", "opus"},
+		{"ollama:qwen2.5-coder", ProviderOllama, "qwen2.5-coder"},
+		{"ollama:qwen2.5-coder:7b", ProviderOllama, "qwen2.5-coder:7b"},
+		{"openai:gpt-4o-mini", ProviderOpenAI, "gpt-4o-mini"},
+		{"qwen2.5-coder:7b", "", "qwen2.5-coder:7b"},
+	}
+
+	for _, tt := range tests {
+		provider, model := ParseModel(tt.spec)
+		if provider != tt.provider || model != tt.model {
+			t.Errorf("ParseModel(%q) = (%q, %q), want (%q, %q)", tt.spec, provider, model, tt.provider, tt.model)
+		}
+	}
+}
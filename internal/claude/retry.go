@@ -0,0 +1,118 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// TransientError marks a generation failure that may succeed if retried,
+// such as a non-zero CLI exit, an overloaded API or unparsable model output
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// transient wraps err as a TransientError
+func transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &TransientError{Err: err}
+}
+
+// IsTransient reports whether err is worth retrying
+func IsTransient(err error) bool {
+	var te *TransientError
+	return errors.As(err, &te)
+}
+
+// httpStatusError marks err transient for rate limits and server-side failures
+func httpStatusError(status int, err error) error {
+	if status == http.StatusTooManyRequests || status >= 500 {
+		return transient(err)
+	}
+	return err
+}
+
+// DefaultRetryBackoff is the delay before the first retry
+const DefaultRetryBackoff = time.Second
+
+// RetryPolicy bounds how long each generation attempt may take and how often
+// transient failures are retried
+type RetryPolicy struct {
+	// Timeout limits a single attempt; zero means no limit
+	Timeout time.Duration
+	// MaxRetries is the number of retries after the first attempt
+	MaxRetries int
+	// Backoff is the delay before the first retry, doubled for each subsequent one
+	Backoff time.Duration
+}
+
+// GenerateWithRetry calls g.Generate, retrying transient failures with exponential
+// backoff. onFailure (which may be nil) is called for every failed attempt,
+// including the last, so failures can be logged. Cancelling ctx stops immediately.
+func GenerateWithRetry(ctx context.Context, g Generator, req Request, policy RetryPolicy, onProgress ProgressFunc, onFailure func(attempt int, err error)) (*GenerateResult, error) {
+	backoff := policy.Backoff
+
+	for attempt := 1; ; attempt++ {
+		result, err := generateAttempt(ctx, g, req, policy.Timeout, onProgress)
+		if err == nil {
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if onFailure != nil {
+			onFailure(attempt, err)
+		}
+		if !IsTransient(err) || attempt > policy.MaxRetries {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// generateAttempt runs a single generation bounded by timeout, recording how
+// long it took and pricing it if the backend didn't report a cost
+func generateAttempt(ctx context.Context, g Generator, req Request, timeout time.Duration, onProgress ProgressFunc) (*GenerateResult, error) {
+	attemptCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	result, err := g.Generate(attemptCtx, req, onProgress)
+	if err != nil {
+		if timeout > 0 && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+			return nil, transient(fmt.Errorf("generation timed out after %s", timeout))
+		}
+		return nil, err
+	}
+
+	result.Duration = time.Since(start)
+	if result.Usage.CostUSD == 0 && result.Usage.Tokens() > 0 {
+		if cost, ok := EstimateCost(g.Provider(), g.Model(), result.Usage); ok && cost > 0 {
+			result.Usage.CostUSD = cost
+			result.Usage.CostEstimated = true
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,104 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// funcGenerator adapts a function into a Generator for tests
+type funcGenerator func(ctx context.Context) (*GenerateResult, error)
+
+func (f funcGenerator) Generate(ctx context.Context, req Request, onProgress ProgressFunc) (*GenerateResult, error) {
+	return f(ctx)
+}
+func (f funcGenerator) Check() error     { return nil }
+func (f funcGenerator) Provider() string { return "test" }
+func (f funcGenerator) Model() string    { return "test" }
+func (f funcGenerator) Prompts(req Request) (string, string, error) {
+	return req.Prompts()
+}
+
+func TestGenerateWithRetry(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond}
+
+	t.Run("retries transient failures", func(t *testing.T) {
+		calls := 0
+		gen := funcGenerator(func(ctx context.Context) (*GenerateResult, error) {
+			calls++
+			if calls < 3 {
+				return nil, transient(errors.New("overloaded"))
+			}
+			return &GenerateResult{Response: &Response{Command: "ls"}}, nil
+		})
+
+		var failures []int
+		result, err := GenerateWithRetry(context.Background(), gen, Request{}, policy, nil, func(attempt int, err error) {
+			failures = append(failures, attempt)
+		})
+		if err != nil || result.Response.Command != "ls" {
+			t.Fatalf("GenerateWithRetry() = %+v, %v", result, err)
+		}
+		if len(failures) != 2 {
+			t.Errorf("onFailure called for attempts %v, want [1 2]", failures)
+		}
+	})
+
+	t.Run("records duration and estimates cost", func(t *testing.T) {
+		gen := funcGenerator(func(ctx context.Context) (*GenerateResult, error) {
+			time.Sleep(5 * time.Millisecond)
+			return &GenerateResult{Response: &Response{Command: "ls"}, Usage: Usage{InputTokens: 10}}, nil
+		})
+		result, err := GenerateWithRetry(context.Background(), gen, Request{}, policy, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Duration < 5*time.Millisecond {
+			t.Errorf("Duration = %s, want at least 5ms", result.Duration)
+		}
+		// The test model has no price, so the cost stays unknown
+		if result.Usage.CostUSD != 0 || result.Usage.CostEstimated {
+			t.Errorf("Usage = %+v, want no cost", result.Usage)
+		}
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		calls := 0
+		gen := funcGenerator(func(ctx context.Context) (*GenerateResult, error) {
+			calls++
+			return nil, transient(errors.New("overloaded"))
+		})
+		if _, err := GenerateWithRetry(context.Background(), gen, Request{}, policy, nil, nil); err == nil {
+			t.Fatal("expected error")
+		}
+		if calls != 3 {
+			t.Errorf("calls = %d, want 3", calls)
+		}
+	})
+
+	t.Run("does not retry permanent failures", func(t *testing.T) {
+		calls := 0
+		gen := funcGenerator(func(ctx context.Context) (*GenerateResult, error) {
+			calls++
+			return nil, errors.New("invalid api key")
+		})
+		if _, err := GenerateWithRetry(context.Background(), gen, Request{}, policy, nil, nil); err == nil {
+			t.Fatal("expected error")
+		}
+		if calls != 1 {
+			t.Errorf("calls = %d, want 1", calls)
+		}
+	})
+
+	t.Run("times out hung attempts", func(t *testing.T) {
+		gen := funcGenerator(func(ctx context.Context) (*GenerateResult, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		_, err := GenerateWithRetry(context.Background(), gen, Request{}, RetryPolicy{Timeout: 10 * time.Millisecond}, nil, nil)
+		if !IsTransient(err) {
+			t.Errorf("error = %v, want transient timeout", err)
+		}
+	})
+}
@@ -0,0 +1,120 @@
+//go:build fixture
+
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ScriptedResponse is a single canned reply in a fixture file. If Error is
+// set, the generation attempt fails with that message instead, as a transient error.
+type ScriptedResponse struct {
+	Response
+	Error string `json:"error,omitempty"`
+	Usage Usage  `json:"usage,omitempty"`
+}
+
+// ScriptedGenerator replays canned responses from a JSON fixture file, one per
+// Generate call. It lets the interactive loop be exercised without a real model.
+type ScriptedGenerator struct {
+	path      string
+	responses []ScriptedResponse
+	next      int
+}
+
+// NewScriptedGenerator returns a Generator that replays the fixture at path.
+// The fixture is a JSON array of ScriptedResponse objects.
+func NewScriptedGenerator(path string) *ScriptedGenerator {
+	return &ScriptedGenerator{path: path}
+}
+
+// newFixtureGenerator returns the ScriptedGenerator for NewGenerator
+func newFixtureGenerator(path string) (Generator, error) {
+	return NewScriptedGenerator(path), nil
+}
+
+// Provider returns ProviderFixture
+func (g *ScriptedGenerator) Provider() string {
+	return ProviderFixture
+}
+
+// Model returns the fixture path
+func (g *ScriptedGenerator) Model() string {
+	return g.path
+}
+
+// Prompts returns the request's prompts, which are sent unchanged
+func (g *ScriptedGenerator) Prompts(req Request) (system, user string, err error) {
+	return req.Prompts()
+}
+
+// Check loads the fixture file and verifies it contains at least one response
+func (g *ScriptedGenerator) Check() error {
+	return g.load()
+}
+
+// load reads the fixture file once
+func (g *ScriptedGenerator) load() error {
+	if g.responses != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(g.path)
+	if err != nil {
+		return fmt.Errorf("failed to read script fixture: %w", err)
+	}
+
+	var responses []ScriptedResponse
+	if err := json.Unmarshal(data, &responses); err != nil {
+		return fmt.Errorf("failed to parse script fixture %s: %w", g.path, err)
+	}
+	if len(responses) == 0 {
+		return fmt.Errorf("script fixture %s has no responses", g.path)
+	}
+
+	g.responses = responses
+	return nil
+}
+
+// Generate returns the next canned response from the fixture
+func (g *ScriptedGenerator) Generate(ctx context.Context, req Request, onProgress ProgressFunc) (*GenerateResult, error) {
+	if err := g.load(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if g.next >= len(g.responses) {
+		return nil, fmt.Errorf("script fixture %s exhausted after %d responses", g.path, len(g.responses))
+	}
+
+	scripted := g.responses[g.next]
+	g.next++
+
+	if scripted.Error != "" {
+		return nil, transient(errors.New(scripted.Error))
+	}
+
+	rawOutput, _ := json.Marshal(scripted.Response)
+	response := scripted.Response
+	response.Alternatives = append([]Alternative(nil), scripted.Alternatives...)
+	response.Steps = append([]Step(nil), scripted.Steps...)
+	if err := response.normalize(req.Mode); err != nil {
+		return nil, err
+	}
+	if onProgress != nil {
+		onProgress(response.Explanation)
+	}
+
+	return &GenerateResult{
+		Response:     &response,
+		SystemPrompt: req.SystemPrompt(),
+		UserPrompt:   req.UserPrompt(),
+		RawOutput:    string(rawOutput),
+		Usage:        scripted.Usage,
+	}, nil
+}
@@ -0,0 +1,11 @@
+//go:build !fixture
+
+package claude
+
+import "fmt"
+
+// newFixtureGenerator rejects the fixture provider: the ScriptedGenerator is
+// only compiled into test builds, made with -tags fixture
+func newFixtureGenerator(path string) (Generator, error) {
+	return nil, fmt.Errorf("the %s provider is only available in test builds (go build -tags fixture)", ProviderFixture)
+}
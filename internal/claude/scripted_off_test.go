@@ -0,0 +1,15 @@
+//go:build !fixture
+
+package claude
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFixtureProviderNeedsBuildTag(t *testing.T) {
+	_, err := NewGenerator("", "fixture:/tmp/fixture.json", Options{})
+	if err == nil || !strings.Contains(err.Error(), "-tags fixture") {
+		t.Errorf("NewGenerator(fixture:...) error = %v, want it to need the fixture build tag", err)
+	}
+}
@@ -0,0 +1,43 @@
+//go:build fixture
+
+package claude
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScriptedGenerator(t *testing.T) {
+	fixture := filepath.Join(t.TempDir(), "fixture.json")
+	content := `[
+		{"command": "ls", "explanation": "- ls"},
+		{"error": "simulated failure"}
+	]`
+	if err := os.WriteFile(fixture, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewGenerator(ProviderFixture, fixture, Options{}); err == nil {
+		t.Error("the fixture provider should only be selectable with a model prefix")
+	}
+	gen, err := NewGenerator("", "fixture:"+fixture, Options{})
+	if err != nil {
+		t.Fatalf("NewGenerator() error: %v", err)
+	}
+	if err := gen.Check(); err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+
+	result, err := gen.Generate(context.Background(), Request{Query: "list"}, nil)
+	if err != nil || result.Response.Command != "ls" {
+		t.Fatalf("first Generate() = %+v, %v; want ls", result, err)
+	}
+	if _, err := gen.Generate(context.Background(), Request{Query: "list"}, nil); err == nil || err.Error() != "simulated failure" {
+		t.Errorf("second Generate() error = %v, want simulated failure", err)
+	}
+	if _, err := gen.Generate(context.Background(), Request{Query: "list"}, nil); err == nil {
+		t.Error("Generate() past end of fixture should fail")
+	}
+}
@@ -0,0 +1,126 @@
+package claude
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxStreamLine bounds a single line of streamed output; the claude CLI's
+// init event lists every tool and can be large
+const maxStreamLine = 16 * 1024 * 1024
+
+// ProgressFunc receives the explanation streamed so far while a command is being generated
+type ProgressFunc func(explanation string)
+
+// streamAccumulator collects streamed JSON output and reports the partial explanation
+type streamAccumulator struct {
+	buf        strings.Builder
+	onProgress ProgressFunc
+	last       string
+}
+
+// add appends a chunk of model output and notifies onProgress if the explanation grew
+func (a *streamAccumulator) add(chunk string) {
+	a.buf.WriteString(chunk)
+	if a.onProgress == nil {
+		return
+	}
+	if explanation := partialStringField(a.buf.String(), "explanation"); explanation != a.last {
+		a.last = explanation
+		a.onProgress(explanation)
+	}
+}
+
+// String returns everything accumulated so far
+func (a *streamAccumulator) String() string {
+	return a.buf.String()
+}
+
+// partialStringField returns the (possibly incomplete) string value of key in a
+// JSON object that is still being streamed. Returns "" if the key hasn't started yet.
+func partialStringField(partial, key string) string {
+	idx := strings.Index(partial, `"`+key+`"`)
+	if idx < 0 {
+		return ""
+	}
+	rest := strings.TrimLeft(partial[idx+len(key)+2:], " \t\r\n")
+	if !strings.HasPrefix(rest, ":") {
+		return ""
+	}
+	rest = strings.TrimLeft(rest[1:], " \t\r\n")
+	if !strings.HasPrefix(rest, `"`) {
+		return ""
+	}
+	rest = rest[1:]
+
+	var sb strings.Builder
+	for i := 0; i < len(rest); i++ {
+		ch := rest[i]
+		switch {
+		case ch == '"':
+			return sb.String()
+		case ch == '\\':
+			if i+1 >= len(rest) {
+				return sb.String()
+			}
+			i++
+			switch rest[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+			case 'u':
+				if i+4 >= len(rest) {
+					return sb.String()
+				}
+				if r, err := strconv.ParseUint(rest[i+1:i+5], 16, 32); err == nil {
+					sb.WriteRune(rune(r))
+				}
+				i += 4
+			default:
+				sb.WriteByte(rest[i])
+			}
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+
+	// Drop a trailing partial UTF-8 sequence
+	s := sb.String()
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// readLines calls fn for each non-empty line read from r
+func readLines(r io.Reader, fn func(line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLine)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// readSSE calls fn with the payload of each "data:" line of a server-sent event stream
+func readSSE(r io.Reader, fn func(data []byte) error) error {
+	return readLines(r, func(line []byte) error {
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			return nil
+		}
+		return fn(bytes.TrimSpace(data))
+	})
+}
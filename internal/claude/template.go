@@ -0,0 +1,252 @@
+package claude
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// DefaultTemplate is the built-in prompt. A template file defines "system"
+// and/or "user"; whichever it leaves out falls back to these definitions.
+const DefaultTemplate = `{{/* System prompt. ClaudeMd holds the user's preferences from claude.md. */}}
+{{- define "system" -}}
+{{if .ClaudeMd}}{{.ClaudeMd}}
+
+{{end -}}
+{{if .Script -}}
+You are a CLI script generator. Your task is to break the user's natural language request into an ordered list of shell commands.
+{{- else if .Explain -}}
+You are a CLI command explainer. Your task is to break down an existing shell command so the user understands exactly what it does before running it.
+{{- else if .Fix -}}
+You are a CLI command fixer. Your task is to correct a shell command that just failed, using its output and the user's environment.
+{{- else -}}
+You are a CLI command generator. Your task is to generate shell commands based on the user's natural language request.
+{{- end}}
+
+IMPORTANT: You must respond with valid JSON matching the required schema. Do not include any text outside the JSON object.
+{{if .Script}}
+When generating steps:
+- Consider the terminal context provided to understand the user's current environment
+- Make each step a single command; steps may run in separate shells, so don't rely on cd or variables set by an earlier step
+- Keep steps in the order they must run; a step only runs if the ones before it succeeded
+- Prefer commands that are safe to re-run (mkdir -p, install only if missing)
+- In each explanation, break down each tool, argument, and flag used
+- Format the explanation with bullet points for clarity
+- Rate each step's risk: high if it is destructive, irreversible or privileged (rm -rf, git push --force, dd, mkfs, sudo), medium if it modifies files or state in a way that is easy to undo, low if it only reads
+- List the specific reasons for a medium or high risk rating
+- Summarize what the whole script does in one sentence
+{{- else if .Explain}}
+When explaining the command:
+- Split it into its parts in order: each program, subcommand, flag with its argument, pipe, redirection and substitution
+- Explain each part in one sentence, in the context of the whole command
+- Use the terminal context to say what the command would do here, e.g. which files a path or glob refers to
+- Summarize what the whole command does in one or two sentences
+- Rate the command's risk: high if it is destructive, irreversible or privileged (rm -rf, git push --force, dd, mkfs, sudo), medium if it modifies files or state in a way that is easy to undo, low if it only reads
+- List the specific reasons for a medium or high risk rating
+- Do not suggest a different command
+{{- else if .Fix}}
+When fixing the command:
+- Work out why it failed from its output and the terminal context, or from the command itself if the output is missing
+- Generate a corrected command that does what the failed one was meant to do, best fix first
+- Change as little as possible, keeping the user's paths, arguments and style
+- If the command can't work here (e.g. a tool is missing), give the command that gets the user there instead
+- Add alternatives only when they are meaningfully different fixes
+- Start each explanation with what was wrong, then break down what changed
+- Format the explanation with bullet points for clarity
+- In each tradeoff, say in one sentence when to prefer that fix
+- Rate each command's risk: high if it is destructive, irreversible or privileged (rm -rf, git push --force, dd, mkfs, sudo), medium if it modifies files or state in a way that is easy to undo, low if it only reads
+- List the specific reasons for a medium or high risk rating
+{{- else}}
+When generating commands:
+- Consider the terminal context provided to understand the user's current environment
+{{- if .PartialCommand}}
+- Complete the partial command the user has typed, fixing any mistakes in it and keeping what they wrote where it is right
+{{- end}}
+- Generate a complete command that accomplishes the task, best option first
+- Add alternatives only when they are meaningfully different (e.g. fd vs find, GNU vs BSD flags, speed vs portability)
+- In each explanation, break down each tool, argument, and flag used
+- Format the explanation with bullet points for clarity
+- In each tradeoff, say in one sentence when to prefer that variant
+- Rate each command's risk: high if it is destructive, irreversible or privileged (rm -rf, git push --force, dd, mkfs, sudo), medium if it modifies files or state in a way that is easy to undo, low if it only reads
+- List the specific reasons for a medium or high risk rating
+{{- end}}
+{{- end}}
+
+{{/* What to generate, in the last line of the user prompt */}}
+{{- define "task" -}}
+{{if .Fix}}a corrected command that does what the failed command was meant to do
+{{- else if .Script}}the steps of a shell script that accomplishes this task
+{{- else if .PartialCommand}}the complete command the user is typing
+{{- else}}a shell command that accomplishes this task{{end}}
+{{- end}}
+
+{{/* The command to correct in fix mode. Query is the user's optional hint. */}}
+{{- define "failure" -}}
+Failed command: {{.FailedCommand}}
+{{if .FailedOutput}}Its output:
+---
+{{.FailedOutput}}
+---{{else}}Its output was not captured.{{end}}
+{{- if .Query}}
+
+User request: {{.Query}}{{end}}
+{{- end}}
+
+{{/* The command line the user had typed, to complete or fix. Query is the user's optional request. */}}
+{{- define "partial" -}}
+Partial command on the user's command line (<cursor> marks the cursor if it is not at the end):
+---
+{{.PartialCommand}}
+---
+{{- if .Query}}
+
+User request: {{.Query}}{{end}}
+{{- end}}
+
+{{/* User prompt. Empty context sources are left out. */}}
+{{- define "user" -}}
+{{if .Terminal}}Terminal context (recent scrollback):
+---
+{{.Terminal}}
+---
+
+{{end -}}
+{{if .BuildTools}}Available build tools and commands in current directory:
+---
+{{.BuildTools}}
+---
+
+{{end -}}
+{{if .Docs}}Project documentation (command-related sections):
+---
+{{.Docs}}
+---
+
+{{end -}}
+{{if .Explain}}Command to explain: {{.Query}}{{else if .Fix}}{{template "failure" .}}{{else if .PartialCommand}}{{template "partial" .}}{{else}}User request: {{.Query}}{{end}}
+{{- if .History}}
+
+Previous commands and user feedback (oldest first):
+{{- range $i, $turn := .History}}
+{{inc $i}}. Command: {{$turn.Command}}
+   Feedback: {{indent $turn.Feedback "   "}}
+{{- end}}
+
+Generate {{template "task" .}}, taking all of the feedback into account.
+{{- else if .Explain}}
+
+Explain what this command does, part by part.
+{{- else}}
+
+Generate {{template "task" .}}.
+{{- end}}
+{{- end}}
+`
+
+// PromptData is what prompt templates can refer to
+type PromptData struct {
+	ClaudeMd   string
+	Terminal   string
+	BuildTools string
+	Docs       string
+	Query      string
+	// Feedback is the most recent feedback, or "" on the first generation
+	Feedback string
+	// History holds every earlier command and its feedback, oldest first
+	History []Turn
+	// Script is set in --script mode, where the model returns ordered steps
+	Script bool
+	// Explain is set by `cmd explain`, where Query is the command to break down
+	Explain bool
+	// Fix is set by `cmd fix`, where Query is an optional hint from the user
+	Fix bool
+	// FailedCommand is the command to fix, and FailedOutput what it printed,
+	// or "" if the output could not be captured
+	FailedCommand string
+	FailedOutput  string
+	// PartialCommand is the command line the user had typed when they invoked
+	// cmd, with <cursor> marking the cursor, or "" if it was empty
+	PartialCommand string
+}
+
+// templateFuncs are available to prompt templates in addition to the text/template builtins
+var templateFuncs = template.FuncMap{
+	"inc":    func(i int) int { return i + 1 },
+	"indent": indent,
+	"trim":   strings.TrimSpace,
+}
+
+// Template renders the system and user prompts
+type Template struct {
+	tmpl *template.Template
+	// Sources lists the files layered over the built-in template, in order
+	Sources []string
+}
+
+// defaultTemplate is parsed once; it is a constant, so parsing cannot fail
+var defaultTemplate = &Template{
+	tmpl: template.Must(template.New("prompt").Funcs(templateFuncs).Parse(DefaultTemplate)),
+}
+
+// LoadTemplate layers the template files at paths, in order, over the built-in
+// template. Missing files are skipped. Each file is checked by rendering it with
+// sample data, so mistakes are reported up front rather than mid-session.
+func LoadTemplate(paths ...string) (*Template, error) {
+	t := defaultTemplate
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return defaultTemplate, err
+		}
+
+		tmpl, err := template.Must(t.tmpl.Clone()).Parse(string(data))
+		if err != nil {
+			return defaultTemplate, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		t = &Template{tmpl: tmpl, Sources: append(append([]string(nil), t.Sources...), path)}
+
+		if _, _, err := t.Render(sampleData); err != nil {
+			return defaultTemplate, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return t, nil
+}
+
+// sampleData exercises every field when checking a template
+var sampleData = PromptData{
+	ClaudeMd:   "- prefer ripgrep",
+	Terminal:   "$ ls\nmain.go",
+	BuildTools: "make (Makefile):\n  - build",
+	Docs:       "## Usage\nmake build",
+	Query:      "build the project",
+	Feedback:   "use -j4",
+	History:    []Turn{{Command: "make", Feedback: "use -j4"}},
+
+	FailedCommand:  "mkae build",
+	FailedOutput:   "mkae: command not found",
+	PartialCommand: "make bu<cursor>",
+}
+
+// Render executes the template, returning the system and user prompts
+func (t *Template) Render(data PromptData) (system, user string, err error) {
+	if t == nil {
+		t = defaultTemplate
+	}
+
+	var buf bytes.Buffer
+	if err := t.tmpl.ExecuteTemplate(&buf, "system", data); err != nil {
+		return "", "", fmt.Errorf("failed to render system prompt: %w", err)
+	}
+	system = buf.String()
+
+	buf.Reset()
+	if err := t.tmpl.ExecuteTemplate(&buf, "user", data); err != nil {
+		return "", "", fmt.Errorf("failed to render user prompt: %w", err)
+	}
+	return system, buf.String(), nil
+}
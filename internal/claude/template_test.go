@@ -0,0 +1,73 @@
+package claude
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTemplate(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadTemplate(t *testing.T) {
+	dir := t.TempDir()
+	global := writeTemplate(t, dir, "global.tmpl", `{{define "user"}}Task: {{.Query}}{{if .Feedback}} ({{.Feedback}}){{end}}{{end}}`)
+	project := writeTemplate(t, dir, "project.tmpl", `{{define "system"}}{{template "base" .}} Be terse.{{end}}{{define "base"}}Project rules.{{end}}`)
+
+	tmpl, err := LoadTemplate(global, filepath.Join(dir, "missing.tmpl"), project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tmpl.Sources) != 2 {
+		t.Errorf("Sources = %v, want both files", tmpl.Sources)
+	}
+
+	req := Request{Query: "list files", History: []Turn{{Command: "ls", Feedback: "include hidden"}}, Template: tmpl}
+	system, user, err := req.Prompts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if system != "Project rules. Be terse." {
+		t.Errorf("system = %q", system)
+	}
+	if user != "Task: list files (include hidden)" {
+		t.Errorf("user = %q", user)
+	}
+}
+
+func TestLoadTemplateDefaults(t *testing.T) {
+	tmpl, err := LoadTemplate(filepath.Join(t.TempDir(), "missing.tmpl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := Request{Query: "list files", Template: tmpl}
+	if req.UserPrompt() != (Request{Query: "list files"}).UserPrompt() {
+		t.Error("a missing template file should leave the built-in prompt unchanged")
+	}
+}
+
+func TestLoadTemplateErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]string{
+		"syntax.tmpl":  `{{define "user"}}{{.Query}{{end}}`,
+		"field.tmpl":   `{{define "user"}}{{.Nonexistent}}{{end}}`,
+		"missing.tmpl": `{{define "user"}}{{template "nope" .}}{{end}}`,
+	}
+	for name, content := range tests {
+		path := writeTemplate(t, dir, name, content)
+		tmpl, err := LoadTemplate(path)
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s: error = %v, want one naming the file", name, err)
+		}
+		if tmpl != defaultTemplate {
+			t.Errorf("%s: should fall back to the built-in template", name)
+		}
+	}
+}
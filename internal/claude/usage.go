@@ -0,0 +1,104 @@
+package claude
+
+import (
+	"strings"
+)
+
+// Usage is the token count and cost of a single generation
+type Usage struct {
+	InputTokens      int     `json:"input_tokens"`
+	OutputTokens     int     `json:"output_tokens"`
+	CacheReadTokens  int     `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int     `json:"cache_write_tokens,omitempty"`
+	CostUSD          float64 `json:"cost_usd"`
+	// CostEstimated is set when CostUSD was computed from the price table
+	// rather than reported by the backend
+	CostEstimated bool `json:"cost_estimated,omitempty"`
+}
+
+// Tokens returns the total number of input and output tokens
+func (u Usage) Tokens() int {
+	return u.InputTokens + u.OutputTokens + u.CacheReadTokens + u.CacheWriteTokens
+}
+
+// Price is the cost in US dollars per million tokens
+type Price struct {
+	Input      float64
+	Output     float64
+	CacheRead  float64
+	CacheWrite float64
+}
+
+// prices lists list prices for hosted models, keyed by model ID prefix.
+// The longest matching prefix wins, so dated snapshots use their family's price.
+var prices = map[string]Price{
+	"claude-opus-4-5":   {Input: 5, Output: 25, CacheRead: 0.5, CacheWrite: 6.25},
+	"claude-opus-4":     {Input: 15, Output: 75, CacheRead: 1.5, CacheWrite: 18.75},
+	"claude-sonnet-4":   {Input: 3, Output: 15, CacheRead: 0.3, CacheWrite: 3.75},
+	"claude-3-7-sonnet": {Input: 3, Output: 15, CacheRead: 0.3, CacheWrite: 3.75},
+	"claude-haiku-4-5":  {Input: 1, Output: 5, CacheRead: 0.1, CacheWrite: 1.25},
+	"claude-3-5-haiku":  {Input: 0.8, Output: 4, CacheRead: 0.08, CacheWrite: 1},
+	"gpt-4o":            {Input: 2.5, Output: 10, CacheRead: 1.25},
+	"gpt-4o-mini":       {Input: 0.15, Output: 0.6, CacheRead: 0.075},
+	"gpt-4.1":           {Input: 2, Output: 8, CacheRead: 0.5},
+	"gpt-4.1-mini":      {Input: 0.4, Output: 1.6, CacheRead: 0.1},
+	"gpt-4.1-nano":      {Input: 0.1, Output: 0.4, CacheRead: 0.025},
+}
+
+// EstimateCost prices usage for the given provider and model. Local providers
+// are free; ok is false if the model isn't in the price table.
+func EstimateCost(provider, model string, usage Usage) (cost float64, ok bool) {
+	switch provider {
+	case ProviderOllama, ProviderFixture:
+		return 0, true
+	}
+
+	price, ok := lookupPrice(resolveAnthropicModel(model))
+	if !ok {
+		return 0, false
+	}
+
+	cost = float64(usage.InputTokens)*price.Input +
+		float64(usage.OutputTokens)*price.Output +
+		float64(usage.CacheReadTokens)*price.CacheRead +
+		float64(usage.CacheWriteTokens)*price.CacheWrite
+	return cost / 1e6, true
+}
+
+// lookupPrice finds the price for the longest model ID prefix matching model
+func lookupPrice(model string) (Price, bool) {
+	model = strings.ToLower(model)
+	best := ""
+	for prefix := range prices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return prices[best], true
+}
+
+// anthropicUsage is the usage object in Messages API responses and claude CLI results
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+}
+
+func (u anthropicUsage) toUsage() Usage {
+	return Usage{
+		InputTokens:      u.InputTokens,
+		OutputTokens:     u.OutputTokens,
+		CacheReadTokens:  u.CacheReadInputTokens,
+		CacheWriteTokens: u.CacheCreationInputTokens,
+	}
+}
+
+// openAIUsage is the usage object in chat completions responses
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
@@ -1,14 +1,24 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 )
 
 const (
-	DefaultModel    = "opus"
-	ConfigDirName   = "cmd"
-	ClaudeMdName    = "claude.md"
+	DefaultModel       = "opus"
+	DefaultProvider    = "cli"
+	ConfigDirName      = "cmd"
+	ClaudeMdName       = "claude.md"
+	SafetyRulesName    = "safety.toml"
+	RedactConfigName   = "redact.toml"
+	PromptTemplateName = "prompt.tmpl"
+	// ProjectDirName holds per-project overrides, found by walking up from the working directory
+	ProjectDirName  = ".cmd"
 	DefaultClaudeMd = `# Command Generation Preferences
 
 - Generate commands for macOS/zsh unless context suggests otherwise
@@ -17,9 +27,34 @@ const (
 `
 )
 
+// Generation limits used when not overridden by flags
+const (
+	DefaultTimeout = 2 * time.Minute
+	DefaultRetries = 2
+	// DefaultContextBudget is the estimated token limit for the whole prompt
+	DefaultContextBudget = 8000
+)
+
+// Environment variables read by Load and LoadSettings
+const (
+	ModelEnvVar            = "CMD_MODEL"
+	ProviderEnvVar         = "CMD_PROVIDER"
+	AnthropicAPIKeyEnvVar  = "ANTHROPIC_API_KEY"
+	AnthropicBaseURLEnvVar = "ANTHROPIC_BASE_URL"
+	OpenAIAPIKeyEnvVar     = "OPENAI_API_KEY"
+	OpenAIBaseURLEnvVar    = "OPENAI_BASE_URL"
+	OllamaHostEnvVar       = "OLLAMA_HOST"
+)
+
 type Config struct {
-	Model       string
-	ClaudeMdDir string
+	Model            string
+	Provider         string
+	ClaudeMdDir      string
+	AnthropicAPIKey  string
+	AnthropicBaseURL string
+	OpenAIAPIKey     string
+	OpenAIBaseURL    string
+	OllamaHost       string
 }
 
 // GetConfigDir returns the path to ~/.config/cmd
@@ -40,6 +75,77 @@ func GetClaudeMdPath() (string, error) {
 	return filepath.Join(configDir, ClaudeMdName), nil
 }
 
+// GetSafetyRulesPath returns the path to the user's safety rules file
+func GetSafetyRulesPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, SafetyRulesName), nil
+}
+
+// GetRedactConfigPath returns the path to the user's secret redaction settings
+func GetRedactConfigPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, RedactConfigName), nil
+}
+
+// GetPromptTemplatePath returns the path to the user's prompt template
+func GetPromptTemplatePath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, PromptTemplateName), nil
+}
+
+// FindProjectFile returns the path of name in the nearest .cmd directory at or
+// above the working directory, up to the repository root, or "" if there is none
+func FindProjectFile(name string) string {
+	paths := FindProjectFiles(name)
+	if len(paths) == 0 {
+		return ""
+	}
+	return paths[len(paths)-1]
+}
+
+// FindProjectFiles returns the paths of name in every .cmd directory at or
+// above the working directory, up to the repository root, the outermost first
+func FindProjectFiles(name string) []string {
+	return findInProject(filepath.Join(ProjectDirName, name))
+}
+
+// findInProject returns the paths of name in the working directory and its
+// parents up to the repository root (the first with a .git), or the
+// filesystem root outside a repository. The outermost comes first, so files
+// in a parent of the repository never apply to it.
+func findInProject(name string) []string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	slices.Reverse(paths)
+	return paths
+}
+
 // EnsureConfigDir creates the config directory if it doesn't exist
 func EnsureConfigDir() error {
 	configDir, err := GetConfigDir()
@@ -60,43 +166,88 @@ func EnsureClaudeMd() error {
 		return err
 	}
 
-	// Check if file exists
-	if _, err := os.Stat(claudeMdPath); os.IsNotExist(err) {
-		// Create with default content
-		return os.WriteFile(claudeMdPath, []byte(DefaultClaudeMd), 0644)
+	return EnsureFile(claudeMdPath, DefaultClaudeMd)
+}
+
+// EnsureFile creates the file with the given default content if it doesn't exist
+func EnsureFile(path, content string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(path, []byte(content), 0644)
 	}
 
 	return nil
 }
 
-// LoadClaudeMd reads the claude.md file content
-func LoadClaudeMd() (string, error) {
-	claudeMdPath, err := GetClaudeMdPath()
-	if err != nil {
-		return "", err
-	}
+// ClaudeMdFile is one preferences file and what it contains
+type ClaudeMdFile struct {
+	Path    string
+	Content string
+}
 
-	content, err := os.ReadFile(claudeMdPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return "", nil
+// LoadClaudeMd reads ~/.config/cmd/claude.md, then the .cmd/claude.md files
+// in the working directory and its parents up to the repository root, the
+// outermost first, so the nearest project's preferences come last. Missing files are skipped; files that
+// can't be read are reported in the error and the others are still returned.
+func LoadClaudeMd() ([]ClaudeMdFile, error) {
+	var paths []string
+	if path, err := GetClaudeMdPath(); err == nil {
+		paths = append(paths, path)
+	}
+	paths = append(paths, FindProjectFiles(ClaudeMdName)...)
+
+	var files []ClaudeMdFile
+	var errs []error
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			continue
 		}
-		return "", err
+		files = append(files, ClaudeMdFile{Path: path, Content: string(content)})
 	}
+	return files, errors.Join(errs...)
+}
 
-	return string(content), nil
+// MergeClaudeMd joins the preferences files in order, separated by a blank line
+func MergeClaudeMd(files []ClaudeMdFile) string {
+	var parts []string
+	for _, file := range files {
+		if content := strings.TrimRight(file.Content, "\n"); strings.TrimSpace(content) != "" {
+			parts = append(parts, content)
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return strings.Join(parts, "\n\n") + "\n"
 }
 
-// Load returns a Config with the specified model or default
-func Load(model string) *Config {
-	if model == "" {
+// Load returns a Config with the model and provider from settings.
+// DefaultModel only applies to Claude providers; local providers need an explicit model.
+func Load(settings *Settings) *Config {
+	model, provider := settings.Model, settings.Provider
+	if provider == "" {
+		provider = DefaultProvider
+	}
+	if model == "" && (provider == DefaultProvider || provider == "anthropic") {
 		model = DefaultModel
 	}
 
 	configDir, _ := GetConfigDir()
 
 	return &Config{
-		Model:       model,
-		ClaudeMdDir: configDir,
+		Model:            model,
+		Provider:         provider,
+		ClaudeMdDir:      configDir,
+		AnthropicAPIKey:  os.Getenv(AnthropicAPIKeyEnvVar),
+		AnthropicBaseURL: os.Getenv(AnthropicBaseURLEnvVar),
+		OpenAIAPIKey:     os.Getenv(OpenAIAPIKeyEnvVar),
+		OpenAIBaseURL:    os.Getenv(OpenAIBaseURLEnvVar),
+		OllamaHost:       os.Getenv(OllamaHostEnvVar),
 	}
 }
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadClaudeMd(t *testing.T) {
+	root := t.TempDir()
+	home := filepath.Join(root, "home")
+	t.Setenv("HOME", home)
+
+	global := filepath.Join(home, ".config", "cmd", ClaudeMdName)
+	writeFile(t, global, "- use fd\n")
+	// Above the repository root, so not read
+	writeFile(t, filepath.Join(root, ProjectDirName, ClaudeMdName), "- outside\n")
+	writeFile(t, filepath.Join(root, "repo", ".git", "HEAD"), "")
+	outer := filepath.Join(root, "repo", ProjectDirName, ClaudeMdName)
+	writeFile(t, outer, "- use podman\n\n")
+	// An empty file is still a source, but adds nothing to the prompt
+	inner := filepath.Join(root, "repo", "sub", ProjectDirName, ClaudeMdName)
+	writeFile(t, inner, "")
+	t.Chdir(filepath.Join(root, "repo", "sub"))
+
+	files, err := LoadClaudeMd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ClaudeMdFile{
+		{Path: global, Content: "- use fd\n"},
+		{Path: outer, Content: "- use podman\n\n"},
+		{Path: inner, Content: ""},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("LoadClaudeMd() = %q, want %q", files, want)
+	}
+	if got, want := MergeClaudeMd(files), "- use fd\n\n- use podman\n"; got != want {
+		t.Errorf("MergeClaudeMd() = %q, want %q", got, want)
+	}
+	if got := FindProjectFile(ClaudeMdName); got != inner {
+		t.Errorf("FindProjectFile() = %q, want the nearest %q", got, inner)
+	}
+}
@@ -0,0 +1,370 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/jerryluo/cmd/internal/redact"
+	"github.com/jerryluo/cmd/internal/terminal"
+)
+
+const (
+	SettingsName = "cmd.toml"
+	// ProjectSettingsName is looked for in the working directory and its
+	// parents, up to the repository root
+	ProjectSettingsName = ".cmd.toml"
+)
+
+// Context providers other than the terminal ones, which settings can turn off
+const (
+	ContextBuildTools = "build_tools"
+	ContextDocs       = "docs"
+)
+
+// SourceDefault is the source of a setting that nothing overrides
+const SourceDefault = "default"
+
+// ProfileEnvVar selects a profile when --profile isn't given
+const ProfileEnvVar = "CMD_PROFILE"
+
+// DefaultSettingsFile is written to ~/.config/cmd/cmd.toml on first run
+const DefaultSettingsFile = `# Settings for cmd. A .cmd.toml in a project (in the working directory or a
+# parent, up to the repository root) overrides these, the nearest one last.
+# $CMD_MODEL and $CMD_PROVIDER override the files, and flags override everything.
+# A profile selected with --profile or $CMD_PROFILE overrides the files, and
+# the environment variables and flags override the profile.
+# Run "cmd config show" to see the effective settings and where each came from.
+
+# model = "sonnet"
+# provider = "cli"          # cli, anthropic, openai or ollama
+# context_lines = 100       # Lines of tmux scrollback
+# context_budget = 8000     # Estimated token limit for the prompt, 0 for unlimited
+
+# Context providers to use, from tmux, fish_history, zsh_history, bash_history,
+# build_tools and docs. All of them are used if this is not set.
+# providers = ["tmux", "zsh_history", "build_tools"]
+
+# Added to the preferences in claude.md; project files add to these
+# preferences = ["Use podman, not docker"]
+
+# Secret redaction, added to redact.toml; project files can add patterns, but
+# only this file can disable any
+# [redact]
+# disabled = ["high_entropy"]
+#
+# [[redact.pattern]]
+# name = "internal_token"
+# regex = 'itk_[a-z0-9]{32}'
+
+# Profiles bundle settings to switch between, e.g. with "cmd --profile fast".
+# They take the same keys as above; preferences and redact add to the files'.
+# Project files can define profiles too, or add to those defined here.
+# [profile.fast]
+# model = "sonnet"
+# context_budget = 2000
+# providers = ["tmux", "zsh_history"]
+#
+# [profile.thorough]
+# model = "opus"
+# context_lines = 1000
+# context_budget = 0
+# preferences = ["Explain any flag that isn't obvious"]
+`
+
+// SettingKeys lists the settings in cmd.toml, in the order they are shown
+var SettingKeys = []string{"model", "provider", "context_lines", "context_budget", "providers", "preferences", "redact"}
+
+// Settings are the values from cmd.toml files, the environment and flags
+type Settings struct {
+	Model         string `toml:"model"`
+	Provider      string `toml:"provider"`
+	ContextLines  int    `toml:"context_lines"`
+	ContextBudget int    `toml:"context_budget"`
+	// Providers lists the context providers to use; nil means all of them
+	Providers []string `toml:"providers"`
+	// Preferences are added to those in claude.md
+	Preferences []string      `toml:"preferences"`
+	Redact      redact.Config `toml:"redact"`
+	// Profiles are the [profile.<name>] tables, only applied when selected
+	Profiles map[string]Settings `toml:"profile"`
+
+	// Profile is the name of the profile applied, "" if none
+	Profile string `toml:"-"`
+	// profiles collects each profile's tables across files, in the order read
+	profiles map[string][]profileTable
+
+	// Sources maps each setting to where its value came from: SourceDefault,
+	// a file, an environment variable or a flag. Preferences and redact add
+	// up across files, so their source lists each file, comma-separated.
+	Sources map[string]string `toml:"-"`
+	// Files lists the settings files that were read, in order
+	Files []string `toml:"-"`
+}
+
+// profileTable is one file's [profile.<name>] table
+type profileTable struct {
+	path     string
+	settings Settings
+	defined  func(key string) bool
+}
+
+// DefaultSettings returns the built-in settings
+func DefaultSettings() *Settings {
+	s := &Settings{
+		Provider:      DefaultProvider,
+		ContextLines:  terminal.ScrollbackLines,
+		ContextBudget: DefaultContextBudget,
+		Sources:       map[string]string{},
+		profiles:      map[string][]profileTable{},
+	}
+	for _, key := range SettingKeys {
+		s.Sources[key] = SourceDefault
+	}
+	return s
+}
+
+// GetSettingsPath returns the path to ~/.config/cmd/cmd.toml
+func GetSettingsPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, SettingsName), nil
+}
+
+// LoadSettings merges, in increasing precedence, the built-in defaults,
+// ~/.config/cmd/cmd.toml, the .cmd.toml files from the repository root down
+// to the working directory, the selected profile, and $CMD_MODEL and
+// $CMD_PROVIDER. The profile is the one given with --profile, or else
+// $CMD_PROFILE. Flags are applied after with Set. A file with a problem is
+// skipped and an unknown profile ignored, and both are reported in the error;
+// the settings are usable either way. An unknown profile is reported as an
+// *UnknownProfileError, which callers may treat as fatal.
+func LoadSettings(profile string) (*Settings, error) {
+	s := DefaultSettings()
+
+	var errs []error
+	if path, err := GetSettingsPath(); err == nil {
+		if err := s.mergeFile(path, false); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, path := range FindProjectSettings() {
+		if err := s.mergeFile(path, true); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	source := "--profile"
+	if profile == "" {
+		profile, source = os.Getenv(ProfileEnvVar), "$"+ProfileEnvVar
+	}
+	if profile != "" {
+		if err := s.UseProfile(profile, source); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, env := range []struct{ key, name string }{{"model", ModelEnvVar}, {"provider", ProviderEnvVar}} {
+		if value := os.Getenv(env.name); value != "" {
+			s.Set(env.key, value, "$"+env.name)
+		}
+	}
+	return s, errors.Join(errs...)
+}
+
+// FindProjectSettings returns the .cmd.toml files in the working directory
+// and its parents up to the repository root, the outermost first
+func FindProjectSettings() []string {
+	return findInProject(ProjectSettingsName)
+}
+
+// mergeFile applies the settings a file defines. A missing file is not an error.
+// A project file can add redaction patterns but not disable any, since it may
+// come from a repository the user doesn't control.
+func (s *Settings) mergeFile(path string, project bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var file Settings
+	md, err := toml.Decode(string(data), &file)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return fmt.Errorf("%s: unknown setting %q", path, undecoded[0].String())
+	}
+	if err := file.check(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if project {
+		if md.IsDefined("redact", "disabled") {
+			return fmt.Errorf("%s: redact.disabled can only be set in ~/.config/cmd/%s", path, SettingsName)
+		}
+		for name := range file.Profiles {
+			if md.IsDefined("profile", name, "redact", "disabled") {
+				return fmt.Errorf("%s: profile %s: redact.disabled can only be set in ~/.config/cmd/%s", path, name, SettingsName)
+			}
+		}
+	}
+
+	s.Files = append(s.Files, path)
+	s.merge(&file, func(key string) bool { return md.IsDefined(key) }, path)
+	for name, profile := range file.Profiles {
+		s.profiles[name] = append(s.profiles[name], profileTable{
+			path:     path,
+			settings: profile,
+			defined:  func(key string) bool { return md.IsDefined("profile", name, key) },
+		})
+	}
+	return nil
+}
+
+// UseProfile applies the named profile's tables from every file, in the order
+// the files were read, each value's source naming the profile and file
+func (s *Settings) UseProfile(name, source string) error {
+	tables := s.profiles[name]
+	if len(tables) == 0 {
+		return &UnknownProfileError{Name: name, Source: source, Defined: slices.Sorted(maps.Keys(s.profiles))}
+	}
+	for _, table := range tables {
+		s.merge(&table.settings, table.defined, fmt.Sprintf("profile %s in %s", name, table.path))
+	}
+	s.Profile = name
+	s.Sources["profile"] = source
+	return nil
+}
+
+// UnknownProfileError reports a profile that no settings file defines
+type UnknownProfileError struct {
+	Name    string
+	Source  string // Where the name came from: "--profile" or "$CMD_PROFILE"
+	Defined []string
+}
+
+func (e *UnknownProfileError) Error() string {
+	if len(e.Defined) == 0 {
+		return fmt.Sprintf("%s: unknown profile %q (no profiles are defined)", e.Source, e.Name)
+	}
+	return fmt.Sprintf("%s: unknown profile %q (defined: %s)", e.Source, e.Name, strings.Join(e.Defined, ", "))
+}
+
+// merge applies the settings defined in file, recording source for each
+func (s *Settings) merge(file *Settings, defined func(key string) bool, source string) {
+	for _, key := range SettingKeys {
+		if !defined(key) {
+			continue
+		}
+		switch key {
+		case "model":
+			s.Model = file.Model
+		case "provider":
+			s.Provider = file.Provider
+		case "context_lines":
+			s.ContextLines = file.ContextLines
+		case "context_budget":
+			s.ContextBudget = file.ContextBudget
+		case "providers":
+			s.Providers = file.Providers
+		case "preferences":
+			s.Preferences = append(s.Preferences, file.Preferences...)
+			s.addSource(key, source)
+			continue
+		case "redact":
+			s.Redact.Disabled = append(s.Redact.Disabled, file.Redact.Disabled...)
+			s.Redact.Patterns = append(s.Redact.Patterns, file.Redact.Patterns...)
+			s.addSource(key, source)
+			continue
+		}
+		s.Sources[key] = source
+	}
+}
+
+// addSource records another source for a setting that adds up across files
+func (s *Settings) addSource(key, source string) {
+	if s.Sources[key] == SourceDefault {
+		s.Sources[key] = source
+		return
+	}
+	s.Sources[key] += ", " + source
+}
+
+// check validates the values read from a file, and its profiles
+func (s *Settings) check() error {
+	for name, profile := range s.Profiles {
+		if len(profile.Profiles) > 0 {
+			return fmt.Errorf("profile %s: profiles can't be nested", name)
+		}
+		if err := profile.check(); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	if s.ContextLines < 0 {
+		return fmt.Errorf("context_lines can't be negative")
+	}
+	if s.ContextBudget < 0 {
+		return fmt.Errorf("context_budget can't be negative")
+	}
+	known := ContextProviders()
+	for _, name := range s.Providers {
+		if !slices.Contains(known, name) {
+			return fmt.Errorf("unknown context provider %q (known: %s)", name, strings.Join(known, ", "))
+		}
+	}
+	return s.Redact.Validate()
+}
+
+// Set overrides a setting with a value from the environment or a flag
+func (s *Settings) Set(key, value, source string) error {
+	switch key {
+	case "model":
+		s.Model = value
+	case "provider":
+		s.Provider = value
+	case "context_lines", "context_budget":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: %s must be a number", source, key)
+		}
+		if n < 0 {
+			return fmt.Errorf("%s: %s can't be negative", source, key)
+		}
+		if key == "context_lines" {
+			s.ContextLines = n
+		} else {
+			s.ContextBudget = n
+		}
+	default:
+		return fmt.Errorf("%s: unknown setting %q", source, key)
+	}
+	s.Sources[key] = source
+	return nil
+}
+
+// Enabled reports whether the named context provider is used
+func (s *Settings) Enabled(provider string) bool {
+	return s.Providers == nil || slices.Contains(s.Providers, provider)
+}
+
+// ContextProviders lists the context providers settings can enable: the
+// terminal providers, then build tools and docs
+func ContextProviders() []string {
+	var names []string
+	for _, p := range terminal.Providers {
+		names = append(names, p.Name())
+	}
+	return append(names, ContextBuildTools, ContextDocs)
+}
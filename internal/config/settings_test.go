@@ -0,0 +1,207 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadSettings(t *testing.T) {
+	root := t.TempDir()
+	home := filepath.Join(root, "home")
+	repo := filepath.Join(root, "repo")
+	t.Setenv("HOME", home)
+	t.Setenv(ModelEnvVar, "")
+	t.Setenv(ProviderEnvVar, "ollama")
+	t.Setenv(ProfileEnvVar, "")
+
+	global := filepath.Join(home, ".config", "cmd", SettingsName)
+	writeFile(t, global, "model = \"sonnet\"\ncontext_lines = 200\npreferences = [\"use fd\"]\n[redact]\ndisabled = [\"jwt\"]\n")
+	// Above the repository root, so not read
+	writeFile(t, filepath.Join(root, ProjectSettingsName), "model = \"outside\"\n")
+	project := filepath.Join(repo, ProjectSettingsName)
+	writeFile(t, project, "context_budget = 1000\npreferences = [\"use podman\"]\n[[redact.pattern]]\nname = \"itk\"\nregex = 'itk_[a-z0-9]{32}'\n")
+	nested := filepath.Join(repo, "sub", ProjectSettingsName)
+	writeFile(t, nested, "model = \"haiku\"\nproviders = [\"tmux\", \"docs\"]\n")
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(filepath.Join(repo, "sub"))
+
+	s, err := LoadSettings("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("context_lines", "50", "--context-lines"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("context_budget", "-5", "--context-budget"); err == nil || s.ContextBudget != 1000 {
+		t.Errorf("Set(context_budget, -5) = %v, ContextBudget = %d; want an error and no change", err, s.ContextBudget)
+	}
+
+	if s.Model != "haiku" || s.Provider != "ollama" || s.ContextLines != 50 || s.ContextBudget != 1000 {
+		t.Errorf("settings = %+v", s)
+	}
+	if want := []string{"use fd", "use podman"}; !reflect.DeepEqual(s.Preferences, want) {
+		t.Errorf("Preferences = %q, want %q", s.Preferences, want)
+	}
+	if !s.Enabled("docs") || s.Enabled(ContextBuildTools) || !reflect.DeepEqual(s.Redact.Disabled, []string{"jwt"}) || len(s.Redact.Patterns) != 1 {
+		t.Errorf("Providers = %q, Redact = %+v", s.Providers, s.Redact)
+	}
+	if want := []string{global, project, nested}; !reflect.DeepEqual(s.Files, want) {
+		t.Errorf("Files = %q, want %q", s.Files, want)
+	}
+
+	wantSources := map[string]string{
+		"model":          nested,
+		"provider":       "$" + ProviderEnvVar,
+		"context_lines":  "--context-lines",
+		"context_budget": project,
+		"providers":      nested,
+		"preferences":    global + ", " + project,
+		"redact":         global + ", " + project,
+	}
+	if !reflect.DeepEqual(s.Sources, wantSources) {
+		t.Errorf("Sources = %v, want %v", s.Sources, wantSources)
+	}
+}
+
+func TestLoadSettingsErrors(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(ModelEnvVar, "")
+	t.Setenv(ProviderEnvVar, "")
+	t.Setenv(ProfileEnvVar, "")
+	t.Chdir(home)
+
+	for content, want := range map[string]string{
+		"modle = \"sonnet\"\n":                   `unknown setting "modle"`,
+		"providers = [\"screen\"]\n":             `unknown context provider "screen"`,
+		"[[redact.pattern]]\nname = \"x\"\n":     "pattern 1 has no regex",
+		"context_lines = -1\n":                   "can't be negative",
+		"[profile.fast]\nmodle = \"x\"\n":        `unknown setting "profile.fast.modle"`,
+		"[profile.fast]\ncontext_budget = -1\n":  "profile fast: context_budget can't be negative",
+		"[profile.a.profile.b]\nmodel = \"x\"\n": "profiles can't be nested",
+	} {
+		writeFile(t, filepath.Join(home, ".config", "cmd", SettingsName), content)
+		s, err := LoadSettings("")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadSettings() with %q: error %v, want %q", content, err, want)
+		}
+		// The file is skipped, leaving the defaults
+		if !reflect.DeepEqual(s, DefaultSettings()) {
+			t.Errorf("LoadSettings() with %q = %+v", content, s)
+		}
+	}
+}
+
+func TestLoadSettingsProjectRedaction(t *testing.T) {
+	root := t.TempDir()
+	home := filepath.Join(root, "home")
+	repo := filepath.Join(root, "repo")
+	t.Setenv("HOME", home)
+	t.Setenv(ModelEnvVar, "")
+	t.Setenv(ProviderEnvVar, "")
+	t.Setenv(ProfileEnvVar, "")
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(repo)
+
+	// A project file can't turn off redaction, at the top level or in a profile
+	project := filepath.Join(repo, ProjectSettingsName)
+	for _, content := range []string{
+		"model = \"haiku\"\n[redact]\ndisabled = [\"aws_access_key\"]\n",
+		"model = \"haiku\"\n[profile.fast.redact]\ndisabled = [\"high_entropy\"]\n",
+	} {
+		writeFile(t, project, content)
+		s, err := LoadSettings("")
+		if err == nil || !strings.Contains(err.Error(), "redact.disabled can only be set in") {
+			t.Errorf("LoadSettings() with %q: error %v", content, err)
+		}
+		if s.Model != "" || len(s.Redact.Disabled) > 0 || len(s.Files) > 0 {
+			t.Errorf("LoadSettings() with %q read the project file: %+v", content, s)
+		}
+	}
+}
+
+func TestLoadSettingsProfile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(ModelEnvVar, "")
+	t.Setenv(ProviderEnvVar, "")
+	t.Setenv(ProfileEnvVar, "fast")
+	if err := os.Mkdir(filepath.Join(home, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(home)
+
+	global := filepath.Join(home, ".config", "cmd", SettingsName)
+	writeFile(t, global, "model = \"opus\"\ncontext_budget = 8000\npreferences = [\"use fd\"]\n"+
+		"[profile.fast]\nmodel = \"sonnet\"\ncontext_budget = 2000\nproviders = [\"tmux\"]\n"+
+		"[profile.thorough]\ncontext_budget = 0\n")
+	// A project file adds to the global profile and overrides its values
+	project := filepath.Join(home, ProjectSettingsName)
+	writeFile(t, project, "[profile.fast]\ncontext_budget = 1000\npreferences = [\"keep it short\"]\n")
+
+	s, err := LoadSettings("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Profile != "fast" || s.Model != "sonnet" || s.ContextBudget != 1000 || !reflect.DeepEqual(s.Providers, []string{"tmux"}) {
+		t.Errorf("settings with the fast profile = %+v", s)
+	}
+	if want := []string{"use fd", "keep it short"}; !reflect.DeepEqual(s.Preferences, want) {
+		t.Errorf("Preferences = %q, want %q", s.Preferences, want)
+	}
+	wantSources := map[string]string{
+		"profile":        "$" + ProfileEnvVar,
+		"model":          "profile fast in " + global,
+		"context_budget": "profile fast in " + project,
+		"preferences":    global + ", profile fast in " + project,
+	}
+	for key, want := range wantSources {
+		if s.Sources[key] != want {
+			t.Errorf("Sources[%s] = %q, want %q", key, s.Sources[key], want)
+		}
+	}
+
+	// --profile wins over $CMD_PROFILE, and $CMD_MODEL over the profile
+	t.Setenv(ModelEnvVar, "haiku")
+	if s, err = LoadSettings("thorough"); err != nil || s.Profile != "thorough" || s.ContextBudget != 0 || s.Model != "haiku" || s.Sources["profile"] != "--profile" {
+		t.Errorf("LoadSettings(thorough) = %+v, %v", s, err)
+	}
+
+	s, err = LoadSettings("slow")
+	var unknown *UnknownProfileError
+	if !errors.As(err, &unknown) || !strings.Contains(err.Error(), `--profile: unknown profile "slow" (defined: fast, thorough)`) {
+		t.Errorf("LoadSettings(slow) error = %v", err)
+	}
+	if s.Profile != "" || s.ContextBudget != 8000 {
+		t.Errorf("an unknown profile should leave the files' settings, got %+v", s)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	s := DefaultSettings()
+	if cfg := Load(s); cfg.Model != DefaultModel || cfg.Provider != DefaultProvider {
+		t.Errorf("Load(defaults) = %+v", cfg)
+	}
+	s.Provider = "ollama"
+	if cfg := Load(s); cfg.Model != "" {
+		t.Errorf("Load() for ollama should not default the model, got %q", cfg.Model)
+	}
+}
@@ -0,0 +1,113 @@
+package execute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxOutput is how much of the end of the combined output is kept
+	MaxOutput = 4096
+	// StderrTailLines is how many trailing lines of stderr are kept
+	StderrTailLines = 20
+)
+
+// Result is the outcome of running a command
+type Result struct {
+	ExitCode int // -1 if the command was killed by a signal
+	Output   string
+	Stderr   string
+	Duration time.Duration
+}
+
+// Shell returns the user's shell from $SHELL, falling back to /bin/sh
+func Shell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "/bin/sh"
+}
+
+// Run executes command with the user's shell, streaming its output to stdout
+// and stderr while keeping the tail of it in the Result. A non-zero exit code
+// is not an error; err is only set if the shell could not be started.
+func Run(ctx context.Context, command string, stdout, stderr io.Writer) (*Result, error) {
+	output := &tailBuffer{limit: MaxOutput}
+	errTail := &tailBuffer{limit: MaxOutput}
+
+	cmd := exec.CommandContext(ctx, Shell(), "-c", command)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = io.MultiWriter(stdout, output)
+	cmd.Stderr = io.MultiWriter(stderr, output, errTail)
+
+	start := time.Now()
+	err := cmd.Run()
+	result := &Result{
+		Output:   output.String(),
+		Stderr:   lastLines(errTail.String(), StderrTailLines),
+		Duration: time.Since(start),
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		return nil, fmt.Errorf("failed to run %s: %w", Shell(), err)
+	}
+
+	return result, nil
+}
+
+// tailBuffer is an io.Writer that keeps only the last limit bytes written to it
+type tailBuffer struct {
+	mu        sync.Mutex
+	buf       []byte
+	limit     int
+	truncated bool
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - t.limit; over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+		t.truncated = true
+	}
+	return len(p), nil
+}
+
+// String returns the kept output. If earlier output was dropped, the partial
+// first line is removed and replaced by a marker.
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := string(t.buf)
+	if !t.truncated {
+		return s
+	}
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return "[output truncated]\n" + s
+}
+
+// lastLines returns at most n trailing lines of s
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,57 @@
+package execute
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+
+	var stdout, stderr bytes.Buffer
+	result, err := Run(context.Background(), "echo out; echo err >&2; exit 3", &stdout, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.ExitCode != 3 {
+		t.Errorf("ExitCode = %d, want 3", result.ExitCode)
+	}
+	if stdout.String() != "out\n" || stderr.String() != "err\n" {
+		t.Errorf("streamed stdout=%q stderr=%q", stdout.String(), stderr.String())
+	}
+	if !strings.Contains(result.Output, "out") || !strings.Contains(result.Output, "err") {
+		t.Errorf("Output = %q, want both streams", result.Output)
+	}
+	if result.Stderr != "err" {
+		t.Errorf("Stderr = %q, want %q", result.Stderr, "err")
+	}
+}
+
+func TestRunSuccess(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+
+	var out bytes.Buffer
+	result, err := Run(context.Background(), "true", &out, &out)
+	if err != nil || result.ExitCode != 0 {
+		t.Fatalf("result=%+v err=%v", result, err)
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	tail := &tailBuffer{limit: 16}
+	tail.Write([]byte("first line\nsecond\n"))
+	tail.Write([]byte("third\n"))
+
+	if got, want := tail.String(), "[output truncated]\nsecond\nthird\n"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	if got := lastLines("a\nb\nc\n", 2); got != "b\nc" {
+		t.Errorf("lastLines = %q, want %q", got, "b\nc")
+	}
+}
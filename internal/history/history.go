@@ -0,0 +1,261 @@
+package history
+
+import (
+	"bytes"
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is one command from a history file
+type Entry struct {
+	Command string
+	Time    time.Time // Zero if the history file doesn't record it
+	// Paths lists the files the command referred to, as fish records them
+	Paths []string
+}
+
+// Shell returns the name of the user's shell from $SHELL, e.g. "fish"
+func Shell() string {
+	return filepath.Base(os.Getenv("SHELL"))
+}
+
+// Path returns the history file of shell. $HISTFILE overrides the default for
+// zsh and bash, as it does in the shells themselves when exported.
+func Path(shell string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	switch shell {
+	case "fish":
+		dataDir := os.Getenv("XDG_DATA_HOME")
+		if dataDir == "" {
+			dataDir = filepath.Join(home, ".local", "share")
+		}
+		return filepath.Join(dataDir, "fish", "fish_history"), nil
+	case "zsh", "bash":
+		if path := os.Getenv("HISTFILE"); path != "" {
+			return path, nil
+		}
+		if shell == "zsh" {
+			return filepath.Join(home, ".zsh_history"), nil
+		}
+		return filepath.Join(home, ".bash_history"), nil
+	default:
+		return "", fmt.Errorf("unsupported shell %q", shell)
+	}
+}
+
+// Read parses the history file of shell, oldest first
+func Read(shell string) ([]Entry, error) {
+	path, err := Path(shell)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shell history: %w", err)
+	}
+	return Parse(shell, data)
+}
+
+// Parse parses history file data in the format of shell, oldest first
+func Parse(shell string, data []byte) ([]Entry, error) {
+	switch shell {
+	case "fish":
+		return parseFish(data), nil
+	case "zsh":
+		return parseZsh(data), nil
+	case "bash":
+		return parseBash(data), nil
+	default:
+		return nil, fmt.Errorf("unsupported shell %q", shell)
+	}
+}
+
+// parseFish reads fish's YAML-like history, where each command is a
+// "- cmd: git status" line followed by indented "when:" and "paths:" fields
+func parseFish(data []byte) []Entry {
+	var entries []Entry
+	for line := range lines(data) {
+		if command, ok := strings.CutPrefix(line, "- cmd: "); ok {
+			entries = append(entries, Entry{Command: unescapeFish(command)})
+			continue
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		entry := &entries[len(entries)-1]
+		if when, ok := strings.CutPrefix(line, "  when: "); ok {
+			entry.Time = parseUnix(when)
+		} else if path, ok := strings.CutPrefix(line, "    - "); ok {
+			entry.Paths = append(entry.Paths, unescapeFish(path))
+		}
+	}
+	return entries
+}
+
+// unescapeFish undoes fish's escaping of newlines and backslashes
+func unescapeFish(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case 'n':
+				sb.WriteByte('\n')
+				i++
+				continue
+			case '\\':
+				sb.WriteByte('\\')
+				i++
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// parseZsh reads zsh history, either plain or in the EXTENDED_HISTORY format
+// ": 1700000000:0;git status". Multi-line commands end each line but the last
+// with a backslash.
+func parseZsh(data []byte) []Entry {
+	var entries []Entry
+	var pending *Entry
+	for line := range lines(unmetafy(data)) {
+		if pending != nil {
+			pending.Command += "\n" + line
+		} else {
+			entry := Entry{Command: line}
+			if rest, ok := strings.CutPrefix(line, ": "); ok {
+				if meta, command, ok := strings.Cut(rest, ";"); ok {
+					when, _, _ := strings.Cut(meta, ":")
+					entry = Entry{Command: command, Time: parseUnix(when)}
+				}
+			}
+			entries = append(entries, entry)
+			pending = &entries[len(entries)-1]
+		}
+
+		if strings.HasSuffix(pending.Command, "\\") {
+			pending.Command = strings.TrimSuffix(pending.Command, "\\")
+			continue
+		}
+		pending = nil
+	}
+	return entries
+}
+
+// unmetafy decodes the bytes zsh escapes in its history file: 0x83 marks a
+// byte stored XORed with 0x20
+func unmetafy(data []byte) []byte {
+	if !bytes.Contains(data, []byte{0x83}) {
+		return data
+	}
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] == 0x83 && i+1 < len(data) {
+			i++
+			out = append(out, data[i]^0x20)
+			continue
+		}
+		out = append(out, data[i])
+	}
+	return out
+}
+
+// parseBash reads bash history, where each command may be preceded by a
+// "#1700000000" timestamp line when HISTTIMEFORMAT is set
+func parseBash(data []byte) []Entry {
+	var entries []Entry
+	var when time.Time
+	for line := range lines(data) {
+		if ts, ok := strings.CutPrefix(line, "#"); ok {
+			if t := parseUnix(ts); !t.IsZero() {
+				when = t
+				continue
+			}
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		entries = append(entries, Entry{Command: line, Time: when})
+		when = time.Time{}
+	}
+	return entries
+}
+
+// InDir keeps the entries that refer to a file in dir. History files don't
+// record where a command ran, so this is approximate: fish records the paths
+// each command used, and for other shells one of the command's arguments must
+// name a file in dir.
+func InDir(entries []Entry, dir string) []Entry {
+	var kept []Entry
+	for _, entry := range entries {
+		paths := entry.Paths
+		if paths == nil {
+			paths = arguments(entry.Command)
+		}
+		for _, path := range paths {
+			if filepath.IsAbs(path) {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(dir, path)); err == nil {
+				kept = append(kept, entry)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// arguments returns the words of command after the program name that could
+// be paths, without flags or surrounding quotes
+func arguments(command string) []string {
+	fields := strings.Fields(command)
+	var args []string
+	for _, field := range fields[min(1, len(fields)):] {
+		field = strings.Trim(field, `"'`)
+		if field != "" && field != "." && field != ".." && !strings.HasPrefix(field, "-") {
+			args = append(args, field)
+		}
+	}
+	return args
+}
+
+// maxLineLength is the longest line read as part of a command. Longer lines,
+// such as pasted data, are skipped rather than ending the parse, since the
+// newest commands come last.
+const maxLineLength = 1024 * 1024
+
+// lines returns the lines of data without their line endings, skipping any
+// longer than maxLineLength
+func lines(data []byte) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for line := range bytes.Lines(data) {
+			line = bytes.TrimSuffix(line, []byte("\n"))
+			line = bytes.TrimSuffix(line, []byte("\r"))
+			if len(line) > maxLineLength {
+				continue
+			}
+			if !yield(string(line)) {
+				return
+			}
+		}
+	}
+}
+
+// parseUnix parses a Unix timestamp in seconds, returning the zero time if it isn't one
+func parseUnix(s string) time.Time {
+	sec, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || sec <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
@@ -0,0 +1,124 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		shell string
+		data  string
+		want  []Entry
+	}{
+		{
+			shell: "fish",
+			data:  "- cmd: git status\n  when: 1700000000\n  paths:\n    - src\n- cmd: echo a\\\\nb\\nc\n  when: 1700000060\n",
+			want: []Entry{
+				{Command: "git status", Time: time.Unix(1700000000, 0), Paths: []string{"src"}},
+				{Command: "echo a\\nb\nc", Time: time.Unix(1700000060, 0)},
+			},
+		},
+		{
+			shell: "zsh",
+			data:  ": 1700000000:0;git status\n: 1700000060:2;for f in *; do\\\necho $f\\\ndone\nls -la\n",
+			want: []Entry{
+				{Command: "git status", Time: time.Unix(1700000000, 0)},
+				{Command: "for f in *; do\necho $f\ndone", Time: time.Unix(1700000060, 0)},
+				{Command: "ls -la"},
+			},
+		},
+		{
+			shell: "zsh",
+			data:  ": 1700000000:0;echo a\xe2\x80\x83\xb4b\n",
+			want:  []Entry{{Command: "echo a—b", Time: time.Unix(1700000000, 0)}},
+		},
+		{
+			shell: "bash",
+			data:  "ls\n#1700000000\ngit status\n\n# not a timestamp\n",
+			want: []Entry{
+				{Command: "ls"},
+				{Command: "git status", Time: time.Unix(1700000000, 0)},
+				{Command: "# not a timestamp"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.shell, []byte(tt.data))
+		if err != nil {
+			t.Fatalf("Parse(%s) error: %v", tt.shell, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%s) = %#v, want %#v", tt.shell, got, tt.want)
+		}
+	}
+
+	// A line too long to be a command is skipped, keeping the newer commands
+	long := strings.Repeat("x", maxLineLength+1)
+	for shell, data := range map[string]string{
+		"fish": "- cmd: " + long + "\n- cmd: git status\n",
+		"zsh":  long + "\ngit status\n",
+		"bash": long + "\ngit status\n",
+	} {
+		got, err := Parse(shell, []byte(data))
+		if err != nil || len(got) == 0 || got[len(got)-1].Command != "git status" {
+			t.Errorf("Parse(%s) with a long line = %d entries, %v; want git status last", shell, len(got), err)
+		}
+	}
+
+	if _, err := Parse("tcsh", nil); err == nil {
+		t.Error("Parse(tcsh) should fail")
+	}
+}
+
+func TestInDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []Entry{
+		{Command: "go run main.go"},
+		{Command: "vim 'main.go'"},
+		{Command: "ls -la ."},
+		{Command: "cat /etc/hosts"},
+		{Command: "make build", Paths: []string{"main.go"}}, // fish recorded the paths
+		{Command: "go build ./...", Paths: []string{"other.go"}},
+	}
+	var got []string
+	for _, entry := range InDir(entries, dir) {
+		got = append(got, entry.Command)
+	}
+	want := []string{"go run main.go", "vim 'main.go'", "make build"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("InDir() = %q, want %q", got, want)
+	}
+}
+
+func TestPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("HISTFILE", "")
+
+	tests := map[string]string{
+		"fish": filepath.Join(home, ".local", "share", "fish", "fish_history"),
+		"zsh":  filepath.Join(home, ".zsh_history"),
+		"bash": filepath.Join(home, ".bash_history"),
+	}
+	for shell, want := range tests {
+		if got, err := Path(shell); err != nil || got != want {
+			t.Errorf("Path(%s) = %q, %v; want %q", shell, got, err, want)
+		}
+	}
+
+	t.Setenv("HISTFILE", "/tmp/hist")
+	if got, _ := Path("bash"); got != "/tmp/hist" {
+		t.Errorf("Path(bash) with $HISTFILE = %q", got)
+	}
+}
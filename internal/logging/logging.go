@@ -3,12 +3,15 @@ package logging
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/jerryluo/cmd/internal/risk"
 	"github.com/jerryluo/cmd/internal/terminal"
 )
 
@@ -19,13 +22,49 @@ const (
 	StatusAccepted FinalStatus = "accepted"
 	StatusRejected FinalStatus = "rejected"
 	StatusQuit     FinalStatus = "quit"
+	StatusExecuted FinalStatus = "executed"
+	// StatusExplained ends an explain session, which has no command to accept
+	StatusExplained FinalStatus = "explained"
 )
 
-// ContextSources holds the context data fed into the prompt
+// SessionType is what a session asked the model for
+type SessionType string
+
+const (
+	TypeGenerate SessionType = "generate"
+	TypeScript   SessionType = "script"
+	TypeExplain  SessionType = "explain"
+	TypeFix      SessionType = "fix"
+)
+
+// SessionTypes lists every session type
+var SessionTypes = []SessionType{TypeGenerate, TypeScript, TypeExplain, TypeFix}
+
+// ContextSources holds the context data fed into the prompt.
+// The contexts are stored in full; Truncations records what was cut to fit the token budget.
 type ContextSources struct {
-	ClaudeMdContent      string `json:"claude_md_content"`
-	TerminalContext      string `json:"terminal_context"`
-	DocumentationContext string `json:"documentation_context"`
+	ClaudeMdContent string `json:"claude_md_content"`
+	// ClaudeMdFiles are the claude.md files merged into ClaudeMdContent, in order
+	ClaudeMdFiles []ClaudeMdFile `json:"claude_md_files,omitempty"`
+	// SettingsPreferences are the preferences from cmd.toml, added after the files
+	SettingsPreferences  []string     `json:"settings_preferences,omitempty"`
+	TerminalContext      string       `json:"terminal_context"`
+	DocumentationContext string       `json:"documentation_context"`
+	Truncations          []Truncation `json:"truncations,omitempty"`
+}
+
+// ClaudeMdFile is a claude.md file whose preferences were sent in the prompt
+type ClaudeMdFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// Truncation records how much of a context source was dropped from the prompt
+type Truncation struct {
+	Source       string `json:"source"`
+	Tokens       int    `json:"tokens"`
+	KeptTokens   int    `json:"kept_tokens"`
+	DroppedLines int    `json:"dropped_lines"`
 }
 
 // ModelInput holds the prompts sent to Claude
@@ -34,29 +73,126 @@ type ModelInput struct {
 	UserPrompt   string `json:"user_prompt"`
 }
 
-// ModelOutput holds Claude's response
-type ModelOutput struct {
-	RawResponse string `json:"raw_response"`
-	Command     string `json:"command"`
+// Finding is a danger detected in a command by the local safety checks
+type Finding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// Alternative is one candidate command offered by the model
+type Alternative struct {
+	Command     string    `json:"command"`
+	Explanation string    `json:"explanation"`
+	Tradeoff    string    `json:"tradeoff,omitempty"`
+	Risk        string    `json:"risk,omitempty"`
+	RiskReasons []string  `json:"risk_reasons,omitempty"`
+	Findings    []Finding `json:"findings,omitempty"`
+}
+
+// RiskLevel returns the higher of the model's risk rating and the safety findings' severities
+func (a Alternative) RiskLevel() string {
+	level := a.Risk
+	for _, f := range a.Findings {
+		level = risk.Max(level, f.Severity)
+	}
+	return level
+}
+
+// Step is one command of a script generated in --script mode, as reviewed by the user
+type Step struct {
+	Command     string    `json:"command"`
+	Explanation string    `json:"explanation"`
+	Risk        string    `json:"risk,omitempty"`
+	RiskReasons []string  `json:"risk_reasons,omitempty"`
+	Findings    []Finding `json:"findings,omitempty"`
+	// Original is the model's command if the user edited the step
+	Original  string     `json:"original,omitempty"`
+	Skipped   bool       `json:"skipped,omitempty"`
+	Execution *Execution `json:"execution,omitempty"`
+}
+
+// RiskLevel returns the higher of the model's risk rating and the safety findings' severities
+func (s Step) RiskLevel() string {
+	return Alternative{Risk: s.Risk, Findings: s.Findings}.RiskLevel()
+}
+
+// Part is one token or group of tokens of a command broken down by `cmd explain`
+type Part struct {
+	Text        string `json:"text"`
 	Explanation string `json:"explanation"`
 }
 
-// Iteration represents a single generate-feedback cycle
+// ModelOutput holds Claude's response.
+// Command and Explanation are those of the first alternative; Risk is the
+// highest risk of any alternative or step, as rated by the model or the safety checks.
+// In script mode the only alternative is the joined script and Steps lists its commands.
+// An explain session's only alternative is the explained command, broken down in Parts.
+type ModelOutput struct {
+	RawResponse  string        `json:"raw_response"`
+	Command      string        `json:"command"`
+	Explanation  string        `json:"explanation"`
+	Risk         string        `json:"risk,omitempty"`
+	Alternatives []Alternative `json:"alternatives,omitempty"`
+	Steps        []Step        `json:"steps,omitempty"`
+	Parts        []Part        `json:"parts,omitempty"`
+}
+
+// Execution records running a generated command from the interactive prompt
+type Execution struct {
+	Command    string `json:"command"`
+	ExitCode   int    `json:"exit_code"`
+	Output     string `json:"output,omitempty"` // Tail of combined stdout and stderr
+	Stderr     string `json:"stderr,omitempty"` // Last lines of stderr
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Usage records the tokens, cost and latency of a successful generation
+type Usage struct {
+	InputTokens      int     `json:"input_tokens"`
+	OutputTokens     int     `json:"output_tokens"`
+	CacheReadTokens  int     `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int     `json:"cache_write_tokens,omitempty"`
+	CostUSD          float64 `json:"cost_usd"`
+	CostEstimated    bool    `json:"cost_estimated,omitempty"` // Priced locally rather than reported by the backend
+	DurationMs       int64   `json:"duration_ms"`
+}
+
+// Iteration represents a single generate-feedback cycle.
+// Failed generation attempts are recorded with Error set and an empty ModelOutput.
+// Provider and Model are those in use for the iteration, since they can change mid-session.
 type Iteration struct {
 	Feedback    string      `json:"feedback"`
 	ModelInput  ModelInput  `json:"model_input"`
 	ModelOutput ModelOutput `json:"model_output"`
+	Error       string      `json:"error,omitempty"`
+	Execution   *Execution  `json:"execution,omitempty"`
+	Provider    string      `json:"provider,omitempty"`
+	Model       string      `json:"model,omitempty"`
+	Usage       *Usage      `json:"usage,omitempty"`
 	Timestamp   time.Time   `json:"timestamp"`
 }
 
 // Metadata holds session metadata
 type Metadata struct {
-	Timestamp      time.Time           `json:"timestamp"`
-	Model          string              `json:"model"`
-	FinalStatus    FinalStatus         `json:"final_status"`
-	FinalFeedback  string              `json:"final_feedback,omitempty"`
-	IterationCount int                 `json:"iteration_count"`
-	TmuxInfo       terminal.TmuxInfo   `json:"tmux_info"`
+	Timestamp      time.Time   `json:"timestamp"`
+	Type           SessionType `json:"type,omitempty"` // Empty in logs written before session types
+	Provider       string      `json:"provider,omitempty"`
+	Model          string      `json:"model"`
+	Profile        string      `json:"profile,omitempty"` // The settings profile in use, if any
+	FinalStatus    FinalStatus `json:"final_status"`
+	FinalFeedback  string      `json:"final_feedback,omitempty"`
+	IterationCount int         `json:"iteration_count"`
+	// Terminal records which provider supplied the terminal context; read it with SessionLog.TerminalInfo
+	Terminal terminal.Info `json:"terminal"`
+	// TmuxInfo is only set in logs written before Terminal replaced it
+	TmuxInfo *terminal.Info `json:"tmux_info,omitempty"`
+	// AcceptedAlternative is the 1-based index of the accepted alternative
+	// in the last iteration; zero if nothing was accepted
+	AcceptedAlternative int    `json:"accepted_alternative,omitempty"`
+	AcceptedCommand     string `json:"accepted_command,omitempty"`
+	// Redactions counts the secrets removed from context and command output, by kind
+	Redactions map[string]int `json:"redactions,omitempty"`
 }
 
 // SessionLog is the complete log for one CLI invocation
@@ -105,8 +241,10 @@ func NewLogger(
 	claudeMdContent string,
 	terminalContext string,
 	docsContext string,
+	provider string,
 	model string,
-	tmuxInfo terminal.TmuxInfo,
+	terminalInfo terminal.Info,
+	sessionType SessionType,
 ) *Logger {
 	if err := ensureLogDir(); err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: Could not create log directory: %v\n", err)
@@ -133,10 +271,12 @@ func NewLogger(
 			Iterations: []Iteration{},
 			Metadata: Metadata{
 				Timestamp:      now.UTC(),
+				Type:           sessionType,
+				Provider:       provider,
 				Model:          model,
 				FinalStatus:    StatusQuit, // Default, will be updated on finalize
 				IterationCount: 0,
-				TmuxInfo:       tmuxInfo,
+				Terminal:       terminalInfo,
 			},
 		},
 		filePath: filePath,
@@ -153,9 +293,8 @@ func (l *Logger) AddIteration(
 	feedback string,
 	systemPrompt string,
 	userPrompt string,
-	rawResponse string,
-	command string,
-	explanation string,
+	output ModelOutput,
+	usage Usage,
 ) {
 	if l == nil {
 		return
@@ -164,17 +303,55 @@ func (l *Logger) AddIteration(
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	for _, alt := range output.Alternatives {
+		output.Risk = risk.Max(output.Risk, alt.RiskLevel())
+	}
+	for _, step := range output.Steps {
+		output.Risk = risk.Max(output.Risk, step.RiskLevel())
+	}
+
 	iteration := Iteration{
 		Feedback: feedback,
 		ModelInput: ModelInput{
 			SystemPrompt: systemPrompt,
 			UserPrompt:   userPrompt,
 		},
-		ModelOutput: ModelOutput{
-			RawResponse: rawResponse,
-			Command:     command,
-			Explanation: explanation,
+		ModelOutput: output,
+		Provider:    l.log.Metadata.Provider,
+		Model:       l.log.Metadata.Model,
+		Usage:       &usage,
+		Timestamp:   time.Now().UTC(),
+	}
+
+	l.log.Iterations = append(l.log.Iterations, iteration)
+	l.log.Metadata.IterationCount = len(l.log.Iterations)
+
+	l.save()
+}
+
+// AddFailedIteration records a generation attempt that returned an error.
+func (l *Logger) AddFailedIteration(
+	feedback string,
+	systemPrompt string,
+	userPrompt string,
+	errMsg string,
+) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	iteration := Iteration{
+		Feedback: feedback,
+		ModelInput: ModelInput{
+			SystemPrompt: systemPrompt,
+			UserPrompt:   userPrompt,
 		},
+		Error:     errMsg,
+		Provider:  l.log.Metadata.Provider,
+		Model:     l.log.Metadata.Model,
 		Timestamp: time.Now().UTC(),
 	}
 
@@ -184,6 +361,133 @@ func (l *Logger) AddIteration(
 	l.save()
 }
 
+// SetTruncations records which context sources were trimmed for the latest prompt.
+func (l *Logger) SetTruncations(truncations []Truncation) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.log.ContextSources.Truncations = truncations
+
+	l.save()
+}
+
+// SetProfile records the settings profile the session used.
+func (l *Logger) SetProfile(profile string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.log.Metadata.Profile = profile
+
+	l.save()
+}
+
+// SetPreferences records where the preferences in the prompt came from: the
+// claude.md files and the preferences set in cmd.toml.
+func (l *Logger) SetPreferences(files []ClaudeMdFile, settingsPreferences []string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.log.ContextSources.ClaudeMdFiles = files
+	l.log.ContextSources.SettingsPreferences = settingsPreferences
+
+	l.save()
+}
+
+// SetRedactions records how many secrets were redacted so far, by kind.
+func (l *Logger) SetRedactions(counts map[string]int) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.log.Metadata.Redactions = maps.Clone(counts)
+
+	l.save()
+}
+
+// SetModel records a switch to a different provider and model mid-session.
+func (l *Logger) SetModel(provider, model string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.log.Metadata.Provider = provider
+	l.log.Metadata.Model = model
+
+	l.save()
+}
+
+// AddExecution records the result of running a command from the last iteration.
+func (l *Logger) AddExecution(execution Execution) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.log.Iterations) == 0 {
+		return
+	}
+	l.log.Iterations[len(l.log.Iterations)-1].Execution = &execution
+
+	l.save()
+}
+
+// SetSteps replaces the steps of the last iteration, recording the user's edits,
+// skips and step executions.
+func (l *Logger) SetSteps(steps []Step) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.log.Iterations) == 0 {
+		return
+	}
+	output := &l.log.Iterations[len(l.log.Iterations)-1].ModelOutput
+	output.Steps = slices.Clone(steps)
+	for _, step := range steps {
+		output.Risk = risk.Max(output.Risk, step.RiskLevel()) // Edits can add findings
+	}
+
+	l.save()
+}
+
+// SetAccepted records which alternative (1-based) of the last iteration was accepted.
+func (l *Logger) SetAccepted(alternative int, command string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.log.Metadata.AcceptedAlternative = alternative
+	l.log.Metadata.AcceptedCommand = command
+
+	l.save()
+}
+
 // Finalize records the final status and writes the complete log.
 func (l *Logger) Finalize(status FinalStatus, finalFeedback string) {
 	if l == nil {
@@ -222,69 +526,53 @@ type LogSummary struct {
 	ID             string      `json:"id"`
 	UserQuery      string      `json:"user_query"`
 	FinalStatus    FinalStatus `json:"final_status"`
+	Provider       string      `json:"provider,omitempty"`
 	Model          string      `json:"model"`
+	Profile        string      `json:"profile,omitempty"`
 	Timestamp      time.Time   `json:"timestamp"`
 	IterationCount int         `json:"iteration_count"`
 	CommandPreview string      `json:"command_preview"`
 	TmuxSession    string      `json:"tmux_session,omitempty"`
+	Risk           string      `json:"risk,omitempty"`
+	Type           SessionType `json:"type"`
 }
 
 // ListLogs returns summaries of all log files in the log directory.
 // Results are sorted by timestamp descending (newest first).
 func ListLogs() ([]LogSummary, error) {
-	logDir, err := GetLogDir()
+	ids, err := logIDs()
 	if err != nil {
 		return nil, err
 	}
 
-	entries, err := os.ReadDir(logDir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return []LogSummary{}, nil
-		}
-		return nil, err
-	}
-
-	var summaries []LogSummary
-	for _, entry := range entries {
-		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
-			continue
-		}
-
-		// Skip temp files
-		if filepath.Ext(filepath.Base(entry.Name())[:len(entry.Name())-5]) == ".tmp" {
-			continue
-		}
-
-		filePath := filepath.Join(logDir, entry.Name())
-		log, err := readLogFile(filePath)
+	summaries := []LogSummary{}
+	for _, id := range ids {
+		log, err := ReadLog(id)
 		if err != nil {
 			continue // Skip files that can't be parsed
 		}
 
-		// Extract command preview from last iteration
+		// Extract command preview from last successful iteration
 		commandPreview := ""
-		if len(log.Iterations) > 0 {
-			cmd := log.Iterations[len(log.Iterations)-1].ModelOutput.Command
-			if len(cmd) > 80 {
-				commandPreview = cmd[:77] + "..."
-			} else {
-				commandPreview = cmd
-			}
+		if cmd := log.LastCommand(); len(cmd) > 80 {
+			commandPreview = cmd[:77] + "..."
+		} else {
+			commandPreview = cmd
 		}
 
-		// ID is filename without .json extension
-		id := entry.Name()[:len(entry.Name())-5]
-
 		summaries = append(summaries, LogSummary{
 			ID:             id,
 			UserQuery:      log.UserQuery,
 			FinalStatus:    log.Metadata.FinalStatus,
+			Provider:       log.Metadata.Provider,
 			Model:          log.Metadata.Model,
+			Profile:        log.Metadata.Profile,
 			Timestamp:      log.Metadata.Timestamp,
 			IterationCount: log.Metadata.IterationCount,
 			CommandPreview: commandPreview,
-			TmuxSession:    log.Metadata.TmuxInfo.Session,
+			TmuxSession:    log.TerminalInfo().Session,
+			Risk:           log.Risk(),
+			Type:           log.Type(),
 		})
 	}
 
@@ -300,6 +588,58 @@ func ListLogs() ([]LogSummary, error) {
 	return summaries, nil
 }
 
+// ReadAllLogs reads every parsable log file, oldest first.
+func ReadAllLogs() ([]*SessionLog, error) {
+	ids, err := logIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []*SessionLog
+	for _, id := range ids {
+		log, err := ReadLog(id)
+		if err != nil {
+			continue // Skip files that can't be parsed
+		}
+		logs = append(logs, log)
+	}
+	return logs, nil
+}
+
+// logIDs returns the IDs of all log files, oldest first. IDs are filenames
+// without the .json extension; temp files are skipped.
+func logIDs() ([]string, error) {
+	logDir, err := GetLogDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(logDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		id := strings.TrimSuffix(entry.Name(), ".json")
+
+		// Skip temp files
+		if filepath.Ext(id) == ".tmp" {
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 // ReadLog reads and parses a single log file by ID.
 // ID is the filename without the .json extension.
 func ReadLog(id string) (*SessionLog, error) {
@@ -327,6 +667,70 @@ func readLogFile(filePath string) (*SessionLog, error) {
 	return &log, nil
 }
 
+// Type returns the session type, treating logs without one as generate sessions
+func (s *SessionLog) Type() SessionType {
+	if s.Metadata.Type == "" {
+		return TypeGenerate
+	}
+	return s.Metadata.Type
+}
+
+// TerminalInfo returns where the terminal context came from, falling back
+// to the tmux_info of logs written before providers were recorded
+func (s *SessionLog) TerminalInfo() terminal.Info {
+	if s.Metadata.TmuxInfo != nil && s.Metadata.Terminal == (terminal.Info{}) {
+		info := *s.Metadata.TmuxInfo
+		if info.InTmux {
+			info.Provider = terminal.ProviderTmux
+		}
+		return info
+	}
+	return s.Metadata.Terminal
+}
+
+// LastCommand returns the accepted command, or else the first command from
+// the most recent successful iteration.
+func (s *SessionLog) LastCommand() string {
+	if s.Metadata.AcceptedCommand != "" {
+		return s.Metadata.AcceptedCommand
+	}
+	for i := len(s.Iterations) - 1; i >= 0; i-- {
+		if s.Iterations[i].Error == "" {
+			return s.Iterations[i].ModelOutput.Command
+		}
+	}
+	return ""
+}
+
+// Risk returns the highest risk of any command generated in the session.
+func (s *SessionLog) Risk() string {
+	level := ""
+	for _, iter := range s.Iterations {
+		level = risk.Max(level, iter.ModelOutput.Risk)
+	}
+	return level
+}
+
+// CostUSD returns the total cost of all generations in the session.
+func (s *SessionLog) CostUSD() float64 {
+	var cost float64
+	for _, iter := range s.Iterations {
+		if iter.Usage != nil {
+			cost += iter.Usage.CostUSD
+		}
+	}
+	return cost
+}
+
+// RedactionCount returns the number of secrets redacted in the session.
+func (s *SessionLog) RedactionCount() int {
+	total := 0
+	for _, n := range s.Metadata.Redactions {
+		total += n
+	}
+	return total
+}
+
 // SessionLogWithID wraps SessionLog with an ID field for API responses
 type SessionLogWithID struct {
 	ID string `json:"id"`
@@ -387,6 +791,16 @@ func SearchLogs(query string) ([]LogSummary, error) {
 				found = true
 				break
 			}
+			for _, alt := range iter.ModelOutput.Alternatives {
+				if strings.Contains(strings.ToLower(alt.Command), query) ||
+					strings.Contains(strings.ToLower(alt.Explanation), query) {
+					found = true
+					break
+				}
+			}
+			if found {
+				break
+			}
 		}
 
 		if found {
@@ -0,0 +1,72 @@
+package redact
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+)
+
+// DefaultConfigFile is written to ~/.config/cmd/redact.toml on first run
+const DefaultConfigFile = `# Secret redaction for terminal context, docs and logs.
+# Matches are replaced with [REDACTED:<name>] before anything is sent to the
+# model or written to the session log.
+
+# Built-in patterns to turn off: private_key, aws_access_key, github_token,
+# api_key, slack_token, google_api_key, stripe_key, jwt, auth_header,
+# url_credentials, assignment, password_flag, high_entropy
+disabled = []
+
+# Extra patterns. If the regex has a capture group, only the first group is
+# replaced; otherwise the whole match is.
+#
+# [[pattern]]
+# name = "internal_token"
+# regex = 'itk_[a-z0-9]{32}'
+`
+
+// Config holds the user's redaction settings
+type Config struct {
+	Disabled []string      `toml:"disabled"`
+	Patterns []UserPattern `toml:"pattern"`
+}
+
+// UserPattern is a user-defined secret format
+type UserPattern struct {
+	Name  string `toml:"name"`
+	Regex string `toml:"regex"`
+}
+
+// LoadConfig reads redaction settings from a TOML file. A missing file is not an error.
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return cfg, err
+	}
+
+	if err := toml.Unmarshal(data, cfg); err != nil {
+		return &Config{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return &Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks that every pattern has a regex, naming unnamed ones "custom"
+func (c *Config) Validate() error {
+	for i, p := range c.Patterns {
+		if p.Regex == "" {
+			return fmt.Errorf("pattern %d has no regex", i+1)
+		}
+		if p.Name == "" {
+			c.Patterns[i].Name = "custom"
+		}
+	}
+	return nil
+}
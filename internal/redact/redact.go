@@ -0,0 +1,188 @@
+package redact
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// pattern is one kind of secret. If the regexp has a capture group, only the
+// first group is replaced so that e.g. the variable name stays readable.
+type pattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// builtins are checked in order; earlier patterns win on overlapping matches
+var builtins = []pattern{
+	{"private_key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"aws_access_key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"github_token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"api_key", regexp.MustCompile(`\bsk-(?:ant-|proj-)?[A-Za-z0-9_\-]{20,}`)},
+	{"slack_token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9\-]{10,}`)},
+	{"google_api_key", regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+	{"stripe_key", regexp.MustCompile(`\b[rs]k_(?:live|test)_[0-9A-Za-z]{16,}\b`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+`)},
+	{"auth_header", regexp.MustCompile(`(?i)\b(?:authorization:\s*(?:bearer|basic|token)|bearer)\s+([A-Za-z0-9._~+/=\-]{8,})`)},
+	{"url_credentials", regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.\-]*://[^/\s:@\[\]]+:([^@\s/\[\]]+)@`)},
+	{"assignment", regexp.MustCompile(`\b(?:[A-Z0-9_]*(?:SECRET|TOKEN|PASSWORD|PASSWD|API_?KEY|ACCESS_?KEY|PRIVATE_?KEY|CREDENTIALS?)[A-Z0-9_]*|password|passwd|secret|api_?key|access_token|auth_token|client_secret)["']?\s*[=:]\s*("[^"\n]*"|'[^'\n]*'|[^\s"',]+)`)},
+	{"password_flag", regexp.MustCompile(`(?i)(?:^|\s)--?(?:password|passwd|token|secret|api-key)[= ]([^\s-]\S*)`)},
+}
+
+// highEntropy finds candidate tokens for the entropy check
+var highEntropy = regexp.MustCompile(`[A-Za-z0-9_+=\-]{24,}`)
+
+// minEntropy is the Shannon entropy (bits per character) above which a
+// mixed-case alphanumeric token is treated as a secret. Hex strings such as
+// git SHAs top out at 4 bits and are left alone.
+const minEntropy = 4.0
+
+// HighEntropyName is the name reported for random-looking tokens
+const HighEntropyName = "high_entropy"
+
+// Counts maps the kind of secret to the number of redactions
+type Counts map[string]int
+
+// Total returns the number of redactions of all kinds
+func (c Counts) Total() int {
+	total := 0
+	for _, n := range c {
+		total += n
+	}
+	return total
+}
+
+// String summarizes the counts, e.g. "2 assignment, 1 aws_access_key"
+func (c Counts) String() string {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%d %s", c[name], name)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Add merges other into c
+func (c Counts) Add(other Counts) {
+	for name, n := range other {
+		c[name] += n
+	}
+}
+
+// Redactor replaces secrets in text with [REDACTED:kind] markers
+type Redactor struct {
+	patterns []pattern
+	entropy  bool
+}
+
+// New returns a Redactor with the built-in patterns plus those from cfg, which may be nil
+func New(cfg *Config) (*Redactor, error) {
+	r := &Redactor{entropy: true}
+	var disabled []string
+	if cfg != nil {
+		disabled = cfg.Disabled
+	}
+
+	for _, p := range builtins {
+		if !slices.Contains(disabled, p.name) {
+			r.patterns = append(r.patterns, p)
+		}
+	}
+	r.entropy = !slices.Contains(disabled, HighEntropyName)
+
+	if cfg != nil {
+		for _, p := range cfg.Patterns {
+			re, err := regexp.Compile(p.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("pattern %q: %w", p.Name, err)
+			}
+			r.patterns = append(r.patterns, pattern{name: p.Name, re: re})
+		}
+	}
+
+	return r, nil
+}
+
+// Redact returns text with secrets replaced, adding what was found to counts
+func (r *Redactor) Redact(text string, counts Counts) string {
+	if text == "" {
+		return text
+	}
+
+	for _, p := range r.patterns {
+		text = p.re.ReplaceAllStringFunc(text, func(match string) string {
+			if strings.HasPrefix(match, "[REDACTED:") {
+				return match
+			}
+			// Replace only the first capture group when there is one
+			sub := p.re.FindStringSubmatchIndex(match)
+			if len(sub) >= 4 && sub[2] >= 0 {
+				secret := match[sub[2]:sub[3]]
+				if strings.HasPrefix(secret, "[REDACTED:") || strings.HasPrefix(secret, "$") {
+					return match // already redacted, or a variable reference rather than a value
+				}
+				counts[p.name]++
+				return match[:sub[2]] + marker(p.name) + match[sub[3]:]
+			}
+			counts[p.name]++
+			return marker(p.name)
+		})
+	}
+
+	if r.entropy {
+		text = highEntropy.ReplaceAllStringFunc(text, func(token string) string {
+			if !looksRandom(token) {
+				return token
+			}
+			counts[HighEntropyName]++
+			return marker(HighEntropyName)
+		})
+	}
+
+	return text
+}
+
+// marker is the text left in place of a secret
+func marker(name string) string {
+	return "[REDACTED:" + name + "]"
+}
+
+// looksRandom reports whether token mixes upper case, lower case and digits
+// with high enough entropy to be a key rather than a word or identifier
+func looksRandom(token string) bool {
+	var upper, lower, digit bool
+	for _, c := range token {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+	}
+	return upper && lower && digit && entropy(token) > minEntropy
+}
+
+// entropy returns the Shannon entropy of s in bits per character
+func entropy(s string) float64 {
+	freq := map[rune]int{}
+	for _, c := range s {
+		freq[c]++
+	}
+	var h float64
+	n := float64(len(s))
+	for _, count := range freq {
+		p := float64(count) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
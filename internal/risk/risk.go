@@ -0,0 +1,30 @@
+// Package risk orders the risk levels the model assigns to commands, shared
+// by the generator backends, the session log and the log viewer
+package risk
+
+import "slices"
+
+// Risk levels, from least to most dangerous
+const (
+	Low    = "low"
+	Medium = "medium"
+	High   = "high"
+)
+
+var levels = []string{Low, Medium, High}
+
+// AtLeast reports whether risk is at or above the threshold level.
+// Unknown or empty risks never match.
+func AtLeast(risk, threshold string) bool {
+	r := slices.Index(levels, risk)
+	return r >= 0 && r >= slices.Index(levels, threshold)
+}
+
+// Max returns the more dangerous of two risk levels. Unknown or empty risks
+// rank below every level.
+func Max(a, b string) string {
+	if slices.Index(levels, b) > slices.Index(levels, a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,36 @@
+package risk
+
+import "testing"
+
+func TestAtLeast(t *testing.T) {
+	tests := []struct {
+		risk, threshold string
+		want            bool
+	}{
+		{High, Medium, true},
+		{Medium, Medium, true},
+		{Low, Medium, false},
+		{"", Low, false},
+		{"extreme", Low, false},
+	}
+	for _, tt := range tests {
+		if got := AtLeast(tt.risk, tt.threshold); got != tt.want {
+			t.Errorf("AtLeast(%q, %q) = %v, want %v", tt.risk, tt.threshold, got, tt.want)
+		}
+	}
+}
+
+func TestMax(t *testing.T) {
+	tests := []struct{ a, b, want string }{
+		{Low, High, High},
+		{High, Medium, High},
+		{"", Low, Low},
+		{Medium, "extreme", Medium},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if got := Max(tt.a, tt.b); got != tt.want {
+			t.Errorf("Max(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
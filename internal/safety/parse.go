@@ -0,0 +1,291 @@
+package safety
+
+import "strings"
+
+// Redirect is an I/O redirection such as "> out.txt" or "2>&1"
+type Redirect struct {
+	Op     string // Operator without the file descriptor, e.g. ">", ">>", ">&"
+	Target string
+}
+
+// Command is a simple command: its words after quote removal and its redirections
+type Command struct {
+	Args      []string
+	Redirects []Redirect
+	// Substitutions holds the parsed contents of $(...) and `...` in the words
+	Substitutions []Pipeline
+}
+
+// Pipeline is a sequence of commands connected with | or |&
+type Pipeline struct {
+	Commands []Command
+}
+
+// tokenKind distinguishes words from shell operators
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokOp
+	tokRedirect
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	subs []Pipeline // substitutions found in a word
+}
+
+// metachars end a word outside quotes
+const metachars = " \t\n|&;()<>"
+
+// Parse splits a shell command line into pipelines. It understands quoting,
+// escapes, comments, command substitution, redirections and the usual list
+// operators; grouping with ( ) or { } is flattened into separate pipelines.
+// It never fails: unterminated quotes extend to the end of the input.
+func Parse(line string) []Pipeline {
+	l := &lexer{src: line}
+	l.run()
+
+	var pipelines []Pipeline
+	var pipeline Pipeline
+	var cmd Command
+	pendingRedirect := ""
+
+	endCommand := func() {
+		if len(cmd.Args) > 0 || len(cmd.Redirects) > 0 {
+			pipeline.Commands = append(pipeline.Commands, cmd)
+		}
+		cmd = Command{}
+	}
+	endPipeline := func() {
+		endCommand()
+		if len(pipeline.Commands) > 0 {
+			pipelines = append(pipelines, pipeline)
+		}
+		pipeline = Pipeline{}
+	}
+
+	for _, tok := range l.tokens {
+		switch tok.kind {
+		case tokWord:
+			cmd.Substitutions = append(cmd.Substitutions, tok.subs...)
+			if pendingRedirect != "" {
+				cmd.Redirects = append(cmd.Redirects, Redirect{Op: pendingRedirect, Target: tok.text})
+				pendingRedirect = ""
+				continue
+			}
+			// Braces only group commands when they start or end one
+			if (tok.text == "{" && len(cmd.Args) == 0) || tok.text == "}" {
+				continue
+			}
+			cmd.Args = append(cmd.Args, tok.text)
+		case tokRedirect:
+			pendingRedirect = tok.text
+		case tokOp:
+			pendingRedirect = ""
+			if tok.text == "|" || tok.text == "|&" {
+				endCommand()
+			} else {
+				endPipeline()
+			}
+		}
+	}
+	endPipeline()
+
+	return pipelines
+}
+
+// lexer splits a command line into words and operators
+type lexer struct {
+	src    string
+	pos    int
+	tokens []token
+}
+
+func (l *lexer) run() {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t':
+			l.pos++
+		case c == '\\' && l.peek(1) == '\n':
+			l.pos += 2
+		case c == '#':
+			// Comment to end of line
+			if end := strings.IndexByte(l.src[l.pos:], '\n'); end >= 0 {
+				l.pos += end
+			} else {
+				l.pos = len(l.src)
+			}
+		case c == '<' || c == '>':
+			l.redirect()
+		case c == '&' && l.peek(1) == '>':
+			// &> and &>> redirect both stdout and stderr
+			l.pos++
+			l.redirect()
+		case strings.IndexByte(metachars, c) >= 0:
+			l.operator()
+		default:
+			start := l.pos
+			text, subs := l.word()
+			// A number directly before < or > is a file descriptor, e.g. 2>
+			if l.pos < len(l.src) && (l.src[l.pos] == '<' || l.src[l.pos] == '>') && isDigits(l.src[start:l.pos]) {
+				l.redirect()
+				continue
+			}
+			l.tokens = append(l.tokens, token{kind: tokWord, text: text, subs: subs})
+		}
+	}
+}
+
+// peek returns the byte at offset n from the current position, or 0
+func (l *lexer) peek(n int) byte {
+	if l.pos+n < len(l.src) {
+		return l.src[l.pos+n]
+	}
+	return 0
+}
+
+// operator consumes a control operator such as |, ||, &&, ; or a newline
+func (l *lexer) operator() {
+	for _, op := range []string{"||", "|&", "&&", ";;", "|", "&", ";", "(", ")", "\n"} {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			l.tokens = append(l.tokens, token{kind: tokOp, text: op})
+			return
+		}
+	}
+	l.pos++
+}
+
+// redirect consumes a redirection operator
+func (l *lexer) redirect() {
+	for _, op := range []string{"<<<", "<<-", ">>", ">|", ">&", "<<", "<&", "<>", ">", "<"} {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			l.tokens = append(l.tokens, token{kind: tokRedirect, text: op})
+			return
+		}
+	}
+	l.pos++
+}
+
+// word consumes a word, removing quotes and escapes and parsing any command substitutions
+func (l *lexer) word() (string, []Pipeline) {
+	var sb strings.Builder
+	var subs []Pipeline
+
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case strings.IndexByte(metachars, c) >= 0:
+			return sb.String(), subs
+		case c == '\\':
+			if l.pos+1 < len(l.src) {
+				sb.WriteByte(l.src[l.pos+1])
+			}
+			l.pos += 2
+		case c == '\'':
+			end := strings.IndexByte(l.src[l.pos+1:], '\'')
+			if end < 0 {
+				sb.WriteString(l.src[l.pos+1:])
+				l.pos = len(l.src)
+			} else {
+				sb.WriteString(l.src[l.pos+1 : l.pos+1+end])
+				l.pos += end + 2
+			}
+		case c == '"':
+			l.pos++
+			subs = append(subs, l.doubleQuoted(&sb)...)
+		case c == '$' && l.peek(1) == '(', c == '`':
+			raw, inner := l.substitution()
+			sb.WriteString(raw)
+			subs = append(subs, inner...)
+		default:
+			sb.WriteByte(c)
+			l.pos++
+		}
+	}
+
+	return sb.String(), subs
+}
+
+// doubleQuoted consumes the rest of a "..." string into sb
+func (l *lexer) doubleQuoted(sb *strings.Builder) []Pipeline {
+	var subs []Pipeline
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return subs
+		case c == '\\' && l.pos+1 < len(l.src) && strings.IndexByte("$`\"\\\n", l.src[l.pos+1]) >= 0:
+			sb.WriteByte(l.src[l.pos+1])
+			l.pos += 2
+		case c == '$' && l.peek(1) == '(', c == '`':
+			raw, inner := l.substitution()
+			sb.WriteString(raw)
+			subs = append(subs, inner...)
+		default:
+			sb.WriteByte(c)
+			l.pos++
+		}
+	}
+	return subs
+}
+
+// substitution consumes $(...) or `...` and returns its raw text and parsed contents
+func (l *lexer) substitution() (string, []Pipeline) {
+	start := l.pos
+
+	if l.src[l.pos] == '`' {
+		end := strings.IndexByte(l.src[l.pos+1:], '`')
+		if end < 0 {
+			l.pos = len(l.src)
+			return l.src[start:], Parse(l.src[start+1:])
+		}
+		l.pos += end + 2
+		return l.src[start:l.pos], Parse(l.src[start+1 : l.pos-1])
+	}
+
+	// Find the matching parenthesis, skipping quoted text
+	l.pos += 2
+	depth := 1
+	for l.pos < len(l.src) && depth > 0 {
+		switch l.src[l.pos] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case '\\':
+			l.pos++
+		case '\'', '"':
+			if end := strings.IndexByte(l.src[l.pos+1:], l.src[l.pos]); end >= 0 {
+				l.pos += end + 1
+			}
+		}
+		l.pos++
+	}
+	// A trailing backslash skips past the end
+	l.pos = min(l.pos, len(l.src))
+
+	inner := l.src[start+2 : l.pos]
+	if depth == 0 {
+		inner = l.src[start+2 : l.pos-1]
+	}
+	return l.src[start:l.pos], Parse(inner)
+}
+
+// isDigits reports whether s is a non-empty run of ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
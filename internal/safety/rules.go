@@ -0,0 +1,130 @@
+package safety
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// DefaultRulesFile is written to ~/.config/cmd/safety.toml on first run
+const DefaultRulesFile = `# Safety rules for generated commands.
+# Findings are shown before a command is accepted; high severity findings
+# require typing "yes" to accept.
+
+# Built-in rules to turn off, e.g. ["sudo", "overwrite-file"]
+disabled = []
+
+# Extra rules. A rule matches a simple command (after sudo, env, xargs, ...)
+# when every field that is set matches:
+#   program - the command name, e.g. "kubectl"
+#   args    - words that must all appear among the arguments
+#   pattern - a regular expression matched against the simple command's words
+#             joined by single spaces, so it can't span |, &&, ; or a redirection
+#
+# [[rule]]
+# name = "kubectl-delete"
+# severity = "high"        # "medium" or "high"
+# program = "kubectl"
+# args = ["delete"]
+# message = "deletes Kubernetes resources"
+`
+
+// Rules holds the user's customizations of the built-in checks
+type Rules struct {
+	Disabled []string `toml:"disabled"`
+	Custom   []Rule   `toml:"rule"`
+}
+
+// Rule is a user-defined check
+type Rule struct {
+	Name     string   `toml:"name"`
+	Severity string   `toml:"severity"`
+	Program  string   `toml:"program"`
+	Args     []string `toml:"args"`
+	Pattern  string   `toml:"pattern"`
+	Message  string   `toml:"message"`
+
+	re *regexp.Regexp
+}
+
+// LoadRules reads user rules from a TOML file. A missing file is not an error.
+func LoadRules(path string) (*Rules, error) {
+	rules := &Rules{}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rules, nil
+		}
+		return rules, err
+	}
+
+	if err := toml.Unmarshal(data, rules); err != nil {
+		return &Rules{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	for i := range rules.Custom {
+		if err := rules.Custom[i].compile(); err != nil {
+			return &Rules{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return rules, nil
+}
+
+// compile validates the rule and prepares its pattern
+func (r *Rule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule without a name")
+	}
+	if r.Severity != SeverityMedium && r.Severity != SeverityHigh {
+		return fmt.Errorf("rule %q: severity must be %q or %q", r.Name, SeverityMedium, SeverityHigh)
+	}
+	if r.Program == "" && r.Pattern == "" {
+		return fmt.Errorf("rule %q: needs a program or a pattern", r.Name)
+	}
+	if r.Pattern != "" {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		r.re = re
+	}
+	if r.Message == "" {
+		r.Message = "matches rule " + r.Name
+	}
+	return nil
+}
+
+// matches reports whether the rule applies to a simple command
+func (r *Rule) matches(name string, args []string) bool {
+	if r.Program != "" && r.Program != name {
+		return false
+	}
+	for _, want := range r.Args {
+		if !slices.Contains(args[1:], want) {
+			return false
+		}
+	}
+	if r.re != nil && !r.re.MatchString(strings.Join(args, " ")) {
+		return false
+	}
+	return true
+}
+
+// disabled reports whether a built-in rule has been turned off
+func (r *Rules) disabled(name string) bool {
+	return r != nil && slices.Contains(r.Disabled, name)
+}
+
+// custom returns the user-defined rules
+func (r *Rules) custom() []Rule {
+	if r == nil {
+		return nil
+	}
+	return r.Custom
+}
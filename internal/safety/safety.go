@@ -0,0 +1,366 @@
+package safety
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Severity levels, matching the model's risk levels
+const (
+	SeverityMedium = "medium"
+	SeverityHigh   = "high"
+)
+
+// Finding is a potential danger detected in a command
+type Finding struct {
+	Rule     string // Name of the rule that matched, e.g. "rm-recursive-force"
+	Severity string
+	Message  string
+}
+
+// Highest returns the most severe level among findings, or "" if there are none
+func Highest(findings []Finding) string {
+	highest := ""
+	for _, f := range findings {
+		if f.Severity == SeverityHigh {
+			return SeverityHigh
+		}
+		highest = f.Severity
+	}
+	return highest
+}
+
+// Check analyzes a command with the built-in rules only
+func Check(command string) []Finding {
+	return (*Rules)(nil).Check(command)
+}
+
+// Check analyzes a command with the built-in rules and any user rules.
+// Rules may be nil.
+func (r *Rules) Check(command string) []Finding {
+	c := &checker{rules: r, seen: map[Finding]bool{}}
+	c.line(command, 0)
+	return c.findings
+}
+
+// maxShellDepth bounds recursion into sh -c scripts and substitutions
+const maxShellDepth = 4
+
+// shells run their -c argument as a script
+var shells = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "fish": true,
+}
+
+// interpreters execute code read from stdin
+var interpreters = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "fish": true,
+	"python": true, "python3": true, "perl": true, "ruby": true, "node": true, "php": true,
+}
+
+// downloaders fetch remote content to stdout
+var downloaders = map[string]bool{"curl": true, "wget": true, "fetch": true}
+
+// checker accumulates findings for one command line
+type checker struct {
+	rules    *Rules
+	findings []Finding
+	seen     map[Finding]bool
+}
+
+func (c *checker) add(rule, severity, format string, args ...any) {
+	if c.rules.disabled(rule) {
+		return
+	}
+	f := Finding{Rule: rule, Severity: severity, Message: fmt.Sprintf(format, args...)}
+	if !c.seen[f] {
+		c.seen[f] = true
+		c.findings = append(c.findings, f)
+	}
+}
+
+func (c *checker) line(line string, depth int) {
+	if depth > maxShellDepth {
+		return
+	}
+	for _, p := range Parse(line) {
+		c.pipeline(p, depth)
+	}
+}
+
+func (c *checker) pipeline(p Pipeline, depth int) {
+	downloading := false
+	for _, cmd := range p.Commands {
+		args := unwrap(cmd.Args, func(wrapper string) {
+			if wrapper == "sudo" || wrapper == "doas" {
+				c.add("sudo", SeverityMedium, "runs with root privileges (%s)", wrapper)
+			}
+		})
+
+		if len(args) > 0 {
+			name := filepath.Base(args[0])
+			if downloading && interpreters[name] {
+				c.add("pipe-to-shell", SeverityHigh, "pipes downloaded content into %s", name)
+			}
+			downloading = downloading || downloaders[name]
+			c.command(name, args, cmd, depth)
+		}
+
+		for _, r := range cmd.Redirects {
+			c.redirect(r)
+		}
+		for _, sub := range cmd.Substitutions {
+			c.pipeline(sub, depth+1)
+		}
+	}
+}
+
+// command applies the built-in and user rules to one simple command
+func (c *checker) command(name string, args []string, cmd Command, depth int) {
+	switch {
+	case name == "rm":
+		c.rm(args)
+	case name == "chmod":
+		c.chmod(args)
+	case name == "git":
+		c.git(args)
+	case name == "dd":
+		for _, arg := range args[1:] {
+			if target, ok := strings.CutPrefix(arg, "of="); ok {
+				c.add("dd-write", SeverityHigh, "dd writes raw data to %s", target)
+			}
+		}
+	case strings.HasPrefix(name, "mkfs"), name == "wipefs", name == "fdisk", name == "sfdisk", name == "parted", name == "gdisk":
+		c.add("disk-format", SeverityHigh, "%s formats or repartitions a disk", name)
+	case name == "shred":
+		c.add("shred", SeverityHigh, "shred irrecoverably destroys file contents")
+	case name == "find":
+		for i, arg := range args {
+			if arg == "-delete" {
+				c.add("find-delete", SeverityMedium, "find -delete removes every matching file")
+			}
+			if (arg == "-exec" || arg == "-execdir" || arg == "-ok") && i+1 < len(args) {
+				// The executed command ends at ";" or "+"
+				exec := args[i+1:]
+				if end := slices.IndexFunc(exec, func(a string) bool { return a == ";" || a == "+" }); end >= 0 {
+					exec = exec[:end]
+				}
+				if len(exec) == 0 {
+					continue
+				}
+				execName := filepath.Base(exec[0])
+				if execName == "rm" {
+					c.add("find-delete", SeverityMedium, "find -exec rm removes every matching file")
+				}
+				c.command(execName, exec, Command{Args: exec}, depth+1)
+			}
+		}
+	case name == "shutdown", name == "reboot", name == "halt", name == "poweroff":
+		c.add("power", SeverityMedium, "%s stops or restarts the machine", name)
+	case shells[name]:
+		for i, arg := range args {
+			if arg == "-c" && i+1 < len(args) {
+				c.line(args[i+1], depth+1)
+				break
+			}
+		}
+		for _, sub := range cmd.Substitutions {
+			for _, subCmd := range sub.Commands {
+				if len(subCmd.Args) > 0 && downloaders[filepath.Base(subCmd.Args[0])] {
+					c.add("pipe-to-shell", SeverityHigh, "runs downloaded content with %s", name)
+				}
+			}
+		}
+	}
+
+	for _, rule := range c.rules.custom() {
+		if rule.matches(name, args) {
+			c.add(rule.Name, rule.Severity, "%s", rule.Message)
+		}
+	}
+}
+
+func (c *checker) rm(args []string) {
+	recursive, force := false, false
+	var targets []string
+	flagsDone := false
+	for _, arg := range args[1:] {
+		switch {
+		case arg == "--":
+			flagsDone = true
+		case !flagsDone && (arg == "--recursive"):
+			recursive = true
+		case !flagsDone && arg == "--force":
+			force = true
+		case !flagsDone && strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--"):
+			recursive = recursive || strings.ContainsAny(arg, "rR")
+			force = force || strings.Contains(arg, "f")
+		case !flagsDone && strings.HasPrefix(arg, "--"):
+		default:
+			targets = append(targets, arg)
+		}
+	}
+
+	switch {
+	case recursive && force:
+		c.add("rm-recursive-force", SeverityHigh, "rm -rf deletes recursively without confirmation")
+	case recursive:
+		c.add("rm-recursive", SeverityMedium, "rm -r deletes directories recursively")
+	}
+	for _, target := range targets {
+		if criticalPath(target) {
+			c.add("rm-critical-path", SeverityHigh, "rm targets %s", target)
+		}
+	}
+}
+
+// criticalPath reports whether deleting path would wipe a root, home or whole directory
+func criticalPath(path string) bool {
+	switch strings.TrimRight(path, "/") {
+	case "", "/*", "~", "~/*", "$HOME", "${HOME}", "$HOME/*", "*", ".", "..", "/usr", "/etc", "/var", "/home", "/bin", "/boot":
+		return true
+	}
+	return false
+}
+
+func (c *checker) chmod(args []string) {
+	recursive := false
+	worldWritable := false
+	for _, arg := range args[1:] {
+		switch {
+		case arg == "-R" || arg == "--recursive":
+			recursive = true
+		case arg == "777" || arg == "0777" || arg == "a+rwx" || arg == "ugo+rwx" || arg == "o+w" || arg == "a+w":
+			worldWritable = true
+		}
+	}
+	if !worldWritable {
+		return
+	}
+	if recursive {
+		c.add("chmod-world-writable", SeverityHigh, "chmod -R makes every file world-writable")
+	} else {
+		c.add("chmod-world-writable", SeverityMedium, "chmod makes the file world-writable")
+	}
+}
+
+func (c *checker) git(args []string) {
+	// Skip global options to find the subcommand, e.g. git -C dir push
+	i := 1
+	for i < len(args) && strings.HasPrefix(args[i], "-") {
+		if args[i] == "-C" || args[i] == "-c" {
+			i++
+		}
+		i++
+	}
+	if i >= len(args) {
+		return
+	}
+	sub, rest := args[i], args[i+1:]
+
+	switch sub {
+	case "push":
+		for _, arg := range rest {
+			switch {
+			case arg == "--force-with-lease" || strings.HasPrefix(arg, "--force-with-lease="):
+				c.add("force-push", SeverityMedium, "git push --force-with-lease rewrites remote history")
+			case arg == "-f" || arg == "--force" || (strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.Contains(arg, "f")):
+				c.add("force-push", SeverityHigh, "git push --force overwrites remote history")
+			case strings.HasPrefix(arg, "+"):
+				c.add("force-push", SeverityHigh, "git push %s force-updates the remote branch", arg)
+			case arg == "--mirror" || arg == "--delete" || arg == "-d":
+				c.add("force-push", SeverityHigh, "git push %s deletes or overwrites remote refs", arg)
+			}
+		}
+	case "reset":
+		if slices.Contains(rest, "--hard") {
+			c.add("git-discard", SeverityMedium, "git reset --hard discards uncommitted changes")
+		}
+	case "clean":
+		for _, arg := range rest {
+			if arg == "--force" || (strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.Contains(arg, "f")) {
+				c.add("git-discard", SeverityMedium, "git clean -f deletes untracked files")
+				break
+			}
+		}
+	}
+}
+
+func (c *checker) redirect(r Redirect) {
+	if r.Op != ">" && r.Op != ">|" {
+		return
+	}
+	target := r.Target
+	switch {
+	case strings.HasPrefix(target, "/dev/sd"), strings.HasPrefix(target, "/dev/nvme"),
+		strings.HasPrefix(target, "/dev/disk"), strings.HasPrefix(target, "/dev/hd"):
+		c.add("device-write", SeverityHigh, "writes directly to the device %s", target)
+	case strings.HasPrefix(target, "/dev/"):
+	default:
+		if info, err := os.Stat(expandHome(target)); err == nil && info.Mode().IsRegular() {
+			c.add("overwrite-file", SeverityMedium, "overwrites the existing file %s", target)
+		}
+	}
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// unwrap strips wrapper commands such as sudo, env or xargs and leading
+// variable assignments, returning the wrapped command's words. Each wrapper
+// found is passed to visit.
+func unwrap(args []string, visit func(wrapper string)) []string {
+	for len(args) > 0 {
+		if strings.Contains(args[0], "=") && !strings.HasPrefix(args[0], "=") {
+			args = args[1:]
+			continue
+		}
+
+		name := filepath.Base(args[0])
+		valueFlags, ok := wrappers[name]
+		if !ok {
+			return args
+		}
+		visit(name)
+
+		args = args[1:]
+		for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+			if args[0] == "--" {
+				args = args[1:]
+				break
+			}
+			if strings.Contains(valueFlags, " "+args[0]+" ") && len(args) > 1 {
+				args = args[1:]
+			}
+			args = args[1:]
+		}
+		if name == "timeout" && len(args) > 0 {
+			args = args[1:] // duration
+		}
+	}
+	return args
+}
+
+// wrappers maps commands that run another command to their flags that take a value
+var wrappers = map[string]string{
+	"sudo":    " -u -g -C -D -h -p -r -t -U ",
+	"doas":    " -u -C ",
+	"env":     " -u -C -S ",
+	"nohup":   "",
+	"time":    "",
+	"nice":    " -n ",
+	"exec":    " -a ",
+	"command": "",
+	"xargs":   " -I -L -n -P -d -s -E -a ",
+	"timeout": " -s -k ",
+	"watch":   " -n -d ",
+}
@@ -0,0 +1,222 @@
+package safety
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line      string
+		pipelines [][][]string
+	}{
+		{`ls -la`, [][][]string{{{"ls", "-la"}}}},
+		{`echo 'a | b' "c;d" e\ f`, [][][]string{{{"echo", "a | b", "c;d", "e f"}}}},
+		{`cat x | grep y && echo ok; ls`, [][][]string{{{"cat", "x"}, {"grep", "y"}}, {{"echo", "ok"}}, {{"ls"}}}},
+		{`(cd build && make) || { echo fail; }`, [][][]string{{{"cd", "build"}}, {{"make"}}, {{"echo", "fail"}}}},
+		{`ls # rm -rf /`, [][][]string{{{"ls"}}}},
+		{`sort a>b 2>&1`, [][][]string{{{"sort", "a"}}}},
+	}
+
+	for _, tt := range tests {
+		var got [][][]string
+		for _, p := range Parse(tt.line) {
+			var cmds [][]string
+			for _, c := range p.Commands {
+				cmds = append(cmds, c.Args)
+			}
+			got = append(got, cmds)
+		}
+		if !reflect.DeepEqual(got, tt.pipelines) {
+			t.Errorf("Parse(%q) = %q, want %q", tt.line, got, tt.pipelines)
+		}
+	}
+}
+
+func TestParseRedirectsAndSubstitutions(t *testing.T) {
+	p := Parse(`echo "$(date +%s)" 2>/dev/null >> log.txt`)
+	if len(p) != 1 || len(p[0].Commands) != 1 {
+		t.Fatalf("unexpected parse: %+v", p)
+	}
+	cmd := p[0].Commands[0]
+
+	want := []Redirect{{Op: ">", Target: "/dev/null"}, {Op: ">>", Target: "log.txt"}}
+	if !reflect.DeepEqual(cmd.Redirects, want) {
+		t.Errorf("Redirects = %+v, want %+v", cmd.Redirects, want)
+	}
+	if len(cmd.Substitutions) != 1 || cmd.Substitutions[0].Commands[0].Args[0] != "date" {
+		t.Errorf("Substitutions = %+v", cmd.Substitutions)
+	}
+}
+
+// corpus maps commands to the rules expected to fire; nil means the command is safe
+var corpus = []struct {
+	command string
+	rules   []string
+}{
+	// Safe commands
+	{`ls -la`, nil},
+	{`find . -name '*.go' -mtime -7`, nil},
+	{`git push origin main`, nil},
+	{`git status && git log --oneline -5`, nil},
+	{`rm build/output.o`, nil},
+	{`echo "rm -rf /"`, nil},
+	{`grep -r 'sudo' .`, nil},
+	{`curl -sSL https://example.com/data.json | jq .`, nil},
+	{`chmod +x script.sh`, nil},
+	{`dd if=/dev/zero bs=1M count=1 status=none`, nil},
+	{`du -sh * | sort -h > /dev/null`, nil},
+	{`ls # && rm -rf /`, nil},
+
+	// rm
+	{`rm -rf node_modules`, []string{"rm-recursive-force"}},
+	{`rm -r -f dist`, []string{"rm-recursive-force"}},
+	{`rm --recursive --force dist`, []string{"rm-recursive-force"}},
+	{`rm -r old`, []string{"rm-recursive"}},
+	{`rm -rf /`, []string{"rm-recursive-force", "rm-critical-path"}},
+	{`rm -rf ~/`, []string{"rm-recursive-force", "rm-critical-path"}},
+	{`find . -name '*.tmp' | xargs rm -rf`, []string{"rm-recursive-force"}},
+	{`/bin/rm -fr cache`, []string{"rm-recursive-force"}},
+
+	// Privileges and wrappers
+	{`sudo apt update`, []string{"sudo"}},
+	{`sudo -u root rm -rf /var/cache/app`, []string{"sudo", "rm-recursive-force"}},
+	{`FOO=1 env -i nice -n 10 rm -rf tmp`, []string{"rm-recursive-force"}},
+
+	// Permissions
+	{`chmod -R 777 /srv/www`, []string{"chmod-world-writable"}},
+	{`chmod 777 file.txt`, []string{"chmod-world-writable"}},
+
+	// Remote code
+	{`curl -fsSL https://get.example.com | sh`, []string{"pipe-to-shell"}},
+	{`wget -qO- https://example.com/install.sh | sudo bash`, []string{"sudo", "pipe-to-shell"}},
+	{`sh -c "$(curl -fsSL https://example.com/install.sh)"`, []string{"pipe-to-shell"}},
+	{`curl https://example.com/x.py | python3 -`, []string{"pipe-to-shell"}},
+
+	// Disks
+	{`sudo mkfs.ext4 /dev/sdb1`, []string{"sudo", "disk-format"}},
+	{`dd if=ubuntu.iso of=/dev/disk2 bs=4m`, []string{"dd-write"}},
+	{`echo hi > /dev/sda`, []string{"device-write"}},
+	{`shred -u secrets.txt`, []string{"shred"}},
+
+	// Git
+	{`git push --force origin main`, []string{"force-push"}},
+	{`git push -f`, []string{"force-push"}},
+	{`git -C repo push origin +main`, []string{"force-push"}},
+	{`git push --force-with-lease`, []string{"force-push"}},
+	{`git reset --hard HEAD~1`, []string{"git-discard"}},
+	{`git clean -fdx`, []string{"git-discard"}},
+
+	// Nested scripts and substitutions
+	{`bash -c 'cd /tmp && rm -rf build'`, []string{"rm-recursive-force"}},
+	{`echo $(rm -rf cache)`, []string{"rm-recursive-force"}},
+	{"ls `git push -f`", []string{"force-push"}},
+	// Unterminated substitutions ending in a backslash
+	{`echo $(foo \`, nil},
+	{`$(\`, nil},
+	{`echo "$(a \`, nil},
+
+	// Other
+	{`find /tmp -name '*.log' -delete`, []string{"find-delete"}},
+	{`find . -type d -name __pycache__ -exec rm -r {} +`, []string{"find-delete", "rm-recursive"}},
+	{`sudo reboot`, []string{"sudo", "power"}},
+}
+
+func TestCheckCorpus(t *testing.T) {
+	for _, tt := range corpus {
+		if got := ruleNames(Check(tt.command)); !reflect.DeepEqual(got, tt.rules) {
+			t.Errorf("Check(%q) rules = %q, want %q", tt.command, got, tt.rules)
+		}
+	}
+}
+
+func TestCheckOverwriteExistingFile(t *testing.T) {
+	existing := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(existing, []byte("keep me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ruleNames(Check("echo hi > " + existing)); !slices.Equal(got, []string{"overwrite-file"}) {
+		t.Errorf("overwrite rules = %q", got)
+	}
+	if got := ruleNames(Check("echo hi >> " + existing)); got != nil {
+		t.Errorf("append should be safe, got %q", got)
+	}
+	if got := ruleNames(Check("echo hi > " + existing + ".new")); got != nil {
+		t.Errorf("new file should be safe, got %q", got)
+	}
+}
+
+func TestUserRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "safety.toml")
+	content := `disabled = ["sudo"]
+
+[[rule]]
+name = "kubectl-delete"
+severity = "high"
+program = "kubectl"
+args = ["delete"]
+message = "deletes Kubernetes resources"
+
+[[rule]]
+name = "prod"
+severity = "medium"
+pattern = "--context[= ]prod"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	findings := rules.Check("sudo kubectl --context prod delete pod web-1")
+	if got := ruleNames(findings); !slices.Equal(got, []string{"kubectl-delete", "prod"}) {
+		t.Errorf("rules = %q", got)
+	}
+	if Highest(findings) != SeverityHigh {
+		t.Errorf("Highest = %q, want high", Highest(findings))
+	}
+	if got := ruleNames(rules.Check("kubectl get pods")); got != nil {
+		t.Errorf("kubectl get should be safe, got %q", got)
+	}
+}
+
+func TestLoadRulesErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	if rules, err := LoadRules(filepath.Join(dir, "missing.toml")); err != nil || rules == nil {
+		t.Errorf("missing file: rules=%v err=%v", rules, err)
+	}
+
+	for name, content := range map[string]string{
+		"bad severity": "[[rule]]\nname = \"x\"\nseverity = \"extreme\"\nprogram = \"ls\"\n",
+		"no matcher":   "[[rule]]\nname = \"x\"\nseverity = \"high\"\n",
+		"bad pattern":  "[[rule]]\nname = \"x\"\nseverity = \"high\"\npattern = \"(\"\n",
+		"bad toml":     "disabled = [",
+	} {
+		path := filepath.Join(dir, "rules.toml")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadRules(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+// ruleNames returns the distinct rule names of findings in order
+func ruleNames(findings []Finding) []string {
+	var names []string
+	for _, f := range findings {
+		if !slices.Contains(names, f.Rule) {
+			names = append(names, f.Rule)
+		}
+	}
+	return names
+}
@@ -0,0 +1,231 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jerryluo/cmd/internal/claude"
+	"github.com/jerryluo/cmd/internal/logging"
+)
+
+// Group aggregates the generations that share a day or a model
+type Group struct {
+	Key          string
+	Sessions     int
+	Accepted     int // Sessions ending in an accepted or executed command
+	Generations  int
+	Failures     int
+	InputTokens  int // Including cached input
+	OutputTokens int
+	CostUSD      float64
+	// CostEstimated is set if any of the cost came from the price table
+	CostEstimated bool
+	latencies     []time.Duration
+}
+
+// MedianLatency returns the median duration of successful generations
+func (g *Group) MedianLatency() time.Duration {
+	return g.percentile(50)
+}
+
+// P90Latency returns the 90th percentile duration of successful generations
+func (g *Group) P90Latency() time.Duration {
+	return g.percentile(90)
+}
+
+func (g *Group) percentile(p int) time.Duration {
+	if len(g.latencies) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(g.latencies)
+	slices.Sort(sorted)
+	return sorted[(len(sorted)-1)*p/100]
+}
+
+// AcceptRate returns the fraction of sessions that ended with a command being used
+func (g *Group) AcceptRate() float64 {
+	if g.Sessions == 0 {
+		return 0
+	}
+	return float64(g.Accepted) / float64(g.Sessions)
+}
+
+// addIteration counts one generation attempt
+func (g *Group) addIteration(iter logging.Iteration) {
+	if iter.Error != "" {
+		g.Failures++
+		return
+	}
+	g.Generations++
+	if iter.Usage == nil {
+		return // Logged before usage was recorded
+	}
+	g.InputTokens += iter.Usage.InputTokens + iter.Usage.CacheReadTokens + iter.Usage.CacheWriteTokens
+	g.OutputTokens += iter.Usage.OutputTokens
+	g.CostUSD += iter.Usage.CostUSD
+	g.CostEstimated = g.CostEstimated || iter.Usage.CostEstimated
+	g.latencies = append(g.latencies, time.Duration(iter.Usage.DurationMs)*time.Millisecond)
+}
+
+// addSession counts one session and whether its command was used.
+// Explain sessions have no command to use, so only their generations count.
+func (g *Group) addSession(log *logging.SessionLog) {
+	if log.Type() == logging.TypeExplain {
+		return
+	}
+	g.Sessions++
+	switch log.Metadata.FinalStatus {
+	case logging.StatusAccepted, logging.StatusExecuted:
+		g.Accepted++
+	}
+}
+
+// Report summarizes usage by day (newest first), by model (most expensive first) and overall
+type Report struct {
+	Days   []*Group
+	Models []*Group
+	Total  Group
+}
+
+// Compute aggregates the logs of sessions started at or after since.
+// A zero since includes every session.
+func Compute(logs []*logging.SessionLog, since time.Time) Report {
+	days := map[string]*Group{}
+	models := map[string]*Group{}
+	var report Report
+
+	group := func(groups map[string]*Group, key string) *Group {
+		if groups[key] == nil {
+			groups[key] = &Group{Key: key}
+		}
+		return groups[key]
+	}
+
+	for _, log := range logs {
+		if log.Metadata.Timestamp.Before(since) {
+			continue
+		}
+
+		day := group(days, log.Metadata.Timestamp.Local().Format("2006-01-02"))
+		day.addSession(log)
+		report.Total.addSession(log)
+
+		// A session is credited to the model that produced its last command
+		sessionModel := modelKey(log.Metadata.Provider, log.Metadata.Model)
+		for _, iter := range log.Iterations {
+			model := sessionModel
+			if iter.Model != "" {
+				model = modelKey(iter.Provider, iter.Model)
+			}
+			group(models, model).addIteration(iter)
+			day.addIteration(iter)
+			report.Total.addIteration(iter)
+			if iter.Error == "" {
+				sessionModel = model
+			}
+		}
+		group(models, sessionModel).addSession(log)
+	}
+
+	for _, g := range days {
+		report.Days = append(report.Days, g)
+	}
+	sort.Slice(report.Days, func(i, j int) bool { return report.Days[i].Key > report.Days[j].Key })
+
+	for _, g := range models {
+		report.Models = append(report.Models, g)
+	}
+	sort.Slice(report.Models, func(i, j int) bool {
+		if report.Models[i].CostUSD != report.Models[j].CostUSD {
+			return report.Models[i].CostUSD > report.Models[j].CostUSD
+		}
+		return report.Models[i].Key < report.Models[j].Key
+	})
+
+	report.Total.Key = "total"
+	return report
+}
+
+// modelKey labels a model the same way the CLI and log viewer do
+func modelKey(provider, model string) string {
+	if model == "" {
+		return "unknown"
+	}
+	return claude.FormatModel(provider, model)
+}
+
+// Write prints the report as two tables, by model and by day, followed by the totals
+func Write(w io.Writer, r Report) error {
+	if r.Total.Sessions == 0 {
+		_, err := fmt.Fprintln(w, "No sessions logged in this period.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	writeTable(tw, "MODEL", r.Models, &r.Total)
+	fmt.Fprintln(tw)
+	writeTable(tw, "DAY", r.Days, &r.Total)
+
+	if r.Total.CostEstimated {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "~ cost estimated from list prices where the backend did not report it")
+	}
+	return tw.Flush()
+}
+
+// writeTable prints one row per group plus the total
+func writeTable(w io.Writer, title string, groups []*Group, total *Group) {
+	fmt.Fprintf(w, "%s\tSESSIONS\tACCEPTED\tGENERATIONS\tFAILED\tTOKENS IN\tTOKENS OUT\tCOST\tMEDIAN\tP90\n", title)
+	for _, g := range append(groups, total) {
+		median, p90 := "-", "-"
+		if len(g.latencies) > 0 {
+			median, p90 = formatLatency(g.MedianLatency()), formatLatency(g.P90Latency())
+		}
+		fmt.Fprintf(w, "%s\t%d\t%.0f%%\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			g.Key,
+			g.Sessions,
+			g.AcceptRate()*100,
+			g.Generations,
+			g.Failures,
+			formatTokens(g.InputTokens),
+			formatTokens(g.OutputTokens),
+			formatCost(g.CostUSD, g.CostEstimated),
+			median,
+			p90,
+		)
+	}
+}
+
+// formatTokens abbreviates large token counts, e.g. 12.3k or 4.5M
+func formatTokens(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 10_000:
+		return fmt.Sprintf("%.1fk", float64(n)/1e3)
+	default:
+		return fmt.Sprint(n)
+	}
+}
+
+// formatCost prints dollars, with more precision under a dollar, marking
+// estimates with a leading ~
+func formatCost(cost float64, estimated bool) string {
+	s := fmt.Sprintf("$%.2f", cost)
+	if cost > 0 && cost < 1 {
+		s = fmt.Sprintf("$%.4f", cost)
+	}
+	if estimated {
+		s = "~" + s
+	}
+	return s
+}
+
+// formatLatency prints a duration in seconds
+func formatLatency(d time.Duration) string {
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
@@ -0,0 +1,119 @@
+package stats
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jerryluo/cmd/internal/logging"
+)
+
+func iteration(provider, model string, cost float64, ms int64) logging.Iteration {
+	return logging.Iteration{
+		Provider: provider,
+		Model:    model,
+		Usage:    &logging.Usage{InputTokens: 1000, OutputTokens: 100, CostUSD: cost, DurationMs: ms},
+	}
+}
+
+func TestCompute(t *testing.T) {
+	day1 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+
+	logs := []*logging.SessionLog{
+		{
+			Metadata:   logging.Metadata{Timestamp: day1, Provider: "cli", Model: "opus", FinalStatus: logging.StatusAccepted},
+			Iterations: []logging.Iteration{iteration("cli", "opus", 0.05, 4000), iteration("cli", "opus", 0.05, 6000)},
+		},
+		{
+			// Switched to sonnet after opus failed; the session is credited to sonnet
+			Metadata: logging.Metadata{Timestamp: day2, Provider: "cli", Model: "sonnet", FinalStatus: logging.StatusExecuted},
+			Iterations: []logging.Iteration{
+				{Provider: "cli", Model: "opus", Error: "timed out"},
+				iteration("cli", "sonnet", 0.01, 2000),
+			},
+		},
+		{
+			// Older logs have no per-iteration model or usage
+			Metadata:   logging.Metadata{Timestamp: day2, Model: "sonnet", FinalStatus: logging.StatusQuit},
+			Iterations: []logging.Iteration{{}},
+		},
+		{
+			Metadata: logging.Metadata{Timestamp: day1.AddDate(0, -1, 0), Model: "opus"},
+		},
+	}
+
+	report := Compute(logs, day1.AddDate(0, 0, -1))
+
+	if report.Total.Sessions != 3 || report.Total.Accepted != 2 || report.Total.Failures != 1 {
+		t.Errorf("total = %+v", report.Total)
+	}
+	if got := report.Total.CostUSD; got < 0.109 || got > 0.111 {
+		t.Errorf("total cost = %v, want 0.11", got)
+	}
+
+	if len(report.Models) != 2 || report.Models[0].Key != "opus" {
+		t.Fatalf("models = %+v", report.Models)
+	}
+	opus, sonnet := report.Models[0], report.Models[1]
+	if opus.Sessions != 1 || opus.Generations != 2 || opus.Failures != 1 {
+		t.Errorf("opus = %+v", opus)
+	}
+	if sonnet.Sessions != 2 || sonnet.Accepted != 1 || sonnet.Generations != 2 {
+		t.Errorf("sonnet = %+v", sonnet)
+	}
+	if opus.MedianLatency() != 4*time.Second || opus.P90Latency() != 4*time.Second {
+		t.Errorf("opus latency median=%s p90=%s", opus.MedianLatency(), opus.P90Latency())
+	}
+
+	if len(report.Days) != 2 || report.Days[0].Key != day2.Format("2006-01-02") {
+		t.Errorf("days = %+v", report.Days)
+	}
+}
+
+func TestComputeExplainSessions(t *testing.T) {
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	logs := []*logging.SessionLog{
+		{
+			Metadata:   logging.Metadata{Timestamp: day, Model: "opus", FinalStatus: logging.StatusAccepted},
+			Iterations: []logging.Iteration{iteration("cli", "opus", 0.05, 4000)},
+		},
+		{
+			Metadata:   logging.Metadata{Timestamp: day, Model: "opus", Type: logging.TypeExplain, FinalStatus: logging.StatusExplained},
+			Iterations: []logging.Iteration{iteration("cli", "opus", 0.02, 3000)},
+		},
+	}
+
+	report := Compute(logs, time.Time{})
+	if report.Total.Sessions != 1 || report.Total.AcceptRate() != 1 {
+		t.Errorf("explain sessions should not count towards the accept rate: %+v", report.Total)
+	}
+	if report.Total.Generations != 2 || report.Total.CostUSD < 0.069 || report.Total.CostUSD > 0.071 {
+		t.Errorf("explain generations should still be counted: %+v", report.Total)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	logs := []*logging.SessionLog{{
+		Metadata:   logging.Metadata{Timestamp: time.Now(), Provider: "anthropic", Model: "sonnet", FinalStatus: logging.StatusAccepted},
+		Iterations: []logging.Iteration{iteration("anthropic", "sonnet", 0.0042, 1500)},
+	}}
+	logs[0].Iterations[0].Usage.CostEstimated = true
+
+	var out bytes.Buffer
+	if err := Write(&out, Compute(logs, time.Time{})); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"MODEL", "anthropic:sonnet", "100%", "~$0.0042", "1.5s", "DAY", "total", "estimated"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	Write(&out, Compute(nil, time.Time{}))
+	if !strings.Contains(out.String(), "No sessions") {
+		t.Errorf("empty output = %q", out.String())
+	}
+}
@@ -4,19 +4,124 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
 )
 
 const (
 	ScrollbackLines = 100
+	// HistoryCommands is how many commands a history provider includes by default
+	HistoryCommands = 50
 )
 
-// TmuxInfo holds information about the current tmux session
-type TmuxInfo struct {
-	InTmux  bool   `json:"in_tmux"`
-	Session string `json:"session,omitempty"`
-	Window  string `json:"window,omitempty"`
-	Pane    string `json:"pane,omitempty"`
+// Info records where the terminal context came from. It succeeds TmuxInfo
+// and keeps its fields, so the tmux_info of older logs reads into it.
+type Info struct {
+	// Provider names the context provider used, or "" if none was available
+	Provider string `json:"provider,omitempty"`
+	InTmux   bool   `json:"in_tmux"`
+	Session  string `json:"session,omitempty"`
+	Window   string `json:"window,omitempty"`
+	Pane     string `json:"pane,omitempty"`
+	// HistoryFile, Commands and Dir describe what a history provider read
+	HistoryFile string `json:"history_file,omitempty"`
+	Commands    int    `json:"commands,omitempty"`
+	Dir         string `json:"dir,omitempty"`
+}
+
+// Label describes the context source in one line, e.g. "tmux: main/editor/1"
+func (i Info) Label() string {
+	switch {
+	case i.Provider == ProviderTmux || (i.Provider == "" && i.InTmux):
+		return fmt.Sprintf("tmux: %s/%s/%s", i.Session, i.Window, i.Pane)
+	case i.Provider != "":
+		return strings.ReplaceAll(i.Provider, "_", " ")
+	default:
+		return "no terminal context"
+	}
+}
+
+// Options scope the context a provider captures
+type Options struct {
+	Lines    int    // tmux scrollback lines
+	Commands int    // History commands
+	Dir      string // If set, only history commands that refer to files in Dir
+	// Enabled names the providers that may be used; nil means all of them
+	Enabled []string
+}
+
+// Provider is a source of terminal context
+type Provider interface {
+	// Name identifies the provider in the session log, e.g. "tmux" or "fish_history"
+	Name() string
+	// Available reports whether the provider can be used in this environment
+	Available() bool
+	// Capture returns the recent context and where it came from
+	Capture(opts Options) (string, Info, error)
+}
+
+// Providers lists the context providers in order of preference
+var Providers = []Provider{
+	TmuxProvider{},
+	HistoryProvider{Shell: "fish"},
+	HistoryProvider{Shell: "zsh"},
+	HistoryProvider{Shell: "bash"},
+}
+
+// Capture gets the terminal context from the first available provider that
+// is enabled. It returns a warning instead if none is available, unless every
+// provider was turned off.
+func Capture(opts Options) (context string, info Info, warning string, err error) {
+	enabled := 0
+	for _, p := range Providers {
+		if opts.Enabled != nil && !slices.Contains(opts.Enabled, p.Name()) {
+			continue
+		}
+		enabled++
+		if p.Available() {
+			context, info, err = p.Capture(opts)
+			return context, info, "", err
+		}
+	}
+	switch {
+	case enabled == 0:
+		return "", Info{}, "", nil
+	case opts.Enabled != nil:
+		return "", Info{}, "Warning: None of the enabled terminal context providers is available.", nil
+	default:
+		return "", Info{}, "Warning: Not running in tmux and no shell history found. Terminal context capture is unavailable.", nil
+	}
+}
+
+// ProviderTmux is the name of the tmux scrollback provider
+const ProviderTmux = "tmux"
+
+// TmuxProvider captures the scrollback of the current tmux pane
+type TmuxProvider struct{}
+
+// Name returns ProviderTmux
+func (TmuxProvider) Name() string {
+	return ProviderTmux
+}
+
+// Available reports whether cmd is running inside tmux
+func (TmuxProvider) Available() bool {
+	return InTmux()
+}
+
+// Capture captures opts.Lines lines of scrollback
+func (TmuxProvider) Capture(opts Options) (string, Info, error) {
+	info := GetTmuxInfo()
+
+	// Capture scrollback from tmux
+	// -p: print to stdout
+	// -S -N: start from N lines back (negative = scrollback)
+	cmd := exec.Command("tmux", "capture-pane", "-p", "-S", fmt.Sprintf("-%d", opts.Lines))
+	output, err := cmd.Output()
+	if err != nil {
+		return "", info, fmt.Errorf("failed to capture tmux pane: %w", err)
+	}
+	return strings.TrimSpace(string(output)), info, nil
 }
 
 // InTmux returns true if running inside a tmux session
@@ -25,12 +130,12 @@ func InTmux() bool {
 }
 
 // GetTmuxInfo returns information about the current tmux session, window, and pane
-func GetTmuxInfo() TmuxInfo {
+func GetTmuxInfo() Info {
 	if !InTmux() {
-		return TmuxInfo{InTmux: false}
+		return Info{InTmux: false}
 	}
 
-	info := TmuxInfo{InTmux: true}
+	info := Info{Provider: ProviderTmux, InTmux: true}
 
 	// Get session name
 	if out, err := exec.Command("tmux", "display-message", "-p", "#S").Output(); err == nil {
@@ -49,23 +154,3 @@ func GetTmuxInfo() TmuxInfo {
 
 	return info
 }
-
-// CaptureContext captures the terminal scrollback via tmux
-// Returns the context string and a warning message if not in tmux
-func CaptureContext(lines int) (context string, warning string, err error) {
-	if !InTmux() {
-		return "", "Warning: Not running in tmux. Terminal context capture is unavailable.", nil
-	}
-
-	// Capture scrollback from tmux
-	// -p: print to stdout
-	// -S -N: start from N lines back (negative = scrollback)
-	cmd := exec.Command("tmux", "capture-pane", "-p", "-S", fmt.Sprintf("-%d", lines))
-	output, err := cmd.Output()
-	if err != nil {
-		return "", "", fmt.Errorf("failed to capture tmux pane: %w", err)
-	}
-
-	context = strings.TrimSpace(string(output))
-	return context, "", nil
-}
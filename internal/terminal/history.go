@@ -0,0 +1,72 @@
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jerryluo/cmd/internal/history"
+)
+
+// HistoryProvider reads recent commands from the history file of Shell. It is
+// used outside tmux, when the user's shell is Shell. History files have no
+// output, so the context is only the commands.
+type HistoryProvider struct {
+	Shell string
+}
+
+// Name returns e.g. "fish_history"
+func (p HistoryProvider) Name() string {
+	return p.Shell + "_history"
+}
+
+// Available reports whether Shell is the user's shell and its history file exists
+func (p HistoryProvider) Available() bool {
+	if history.Shell() != p.Shell {
+		return false
+	}
+	path, err := history.Path(p.Shell)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// Capture returns the last opts.Commands commands, only those referring to
+// files in opts.Dir if it is set
+func (p HistoryProvider) Capture(opts Options) (string, Info, error) {
+	path, _ := history.Path(p.Shell)
+	info := Info{Provider: p.Name(), HistoryFile: path, Dir: opts.Dir}
+
+	entries, err := history.Read(p.Shell)
+	if err != nil {
+		return "", info, err
+	}
+	if opts.Dir != "" {
+		entries = history.InDir(entries, opts.Dir)
+	}
+	if len(entries) > opts.Commands {
+		entries = entries[len(entries)-opts.Commands:]
+	}
+	info.Commands = len(entries)
+	if len(entries) == 0 {
+		return "", info, nil
+	}
+	return formatHistory(p.Shell, entries), info, nil
+}
+
+// formatHistory renders history entries for the prompt, oldest first, with
+// their times when the history file records them
+func formatHistory(shell string, entries []history.Entry) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Recent commands from %s history, oldest first (their output is not available):", shell)
+	for _, entry := range entries {
+		sb.WriteString("\n")
+		if !entry.Time.IsZero() {
+			sb.WriteString(entry.Time.Local().Format("2006-01-02 15:04") + "  ")
+		}
+		sb.WriteString(strings.ReplaceAll(entry.Command, "\n", "\n    "))
+	}
+	return sb.String()
+}
@@ -0,0 +1,72 @@
+package terminal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jerryluo/cmd/internal/history"
+)
+
+func TestHistoryProvider(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("HISTFILE", "")
+	t.Setenv("SHELL", "/bin/bash")
+
+	p := HistoryProvider{Shell: "bash"}
+	if p.Available() {
+		t.Fatal("Available() without a history file")
+	}
+	if (HistoryProvider{Shell: "zsh"}).Available() {
+		t.Fatal("zsh Available() when the shell is bash")
+	}
+
+	path := filepath.Join(home, ".bash_history")
+	data := "ls\n#1700000000\nfor f in a b; do\necho $f; done\ngit status\nmake buidl\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Available() {
+		t.Fatal("Available() with a history file")
+	}
+
+	context, info, err := p.Capture(Options{Commands: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Info{Provider: "bash_history", HistoryFile: path, Commands: 2}
+	if info != want {
+		t.Errorf("Capture() info = %+v, want %+v", info, want)
+	}
+	wantContext := "Recent commands from bash history, oldest first (their output is not available):\ngit status\nmake buidl"
+	if context != wantContext {
+		t.Errorf("Capture() = %q, want %q", context, wantContext)
+	}
+	if got := info.Label(); got != "bash history" {
+		t.Errorf("Label() = %q", got)
+	}
+
+	t.Setenv("TMUX", "")
+	if _, info, _, _ := Capture(Options{Commands: 2}); info.Provider != "bash_history" {
+		t.Errorf("Capture() provider = %q", info.Provider)
+	}
+	if context, _, warning, _ := Capture(Options{Commands: 2, Enabled: []string{"tmux", "zsh_history"}}); context != "" || !strings.Contains(warning, "None of the enabled") {
+		t.Errorf("Capture() with bash_history disabled = %q, warning %q", context, warning)
+	}
+	if _, _, warning, _ := Capture(Options{Enabled: []string{}}); warning != "" {
+		t.Errorf("Capture() with every provider disabled warned %q", warning)
+	}
+}
+
+func TestFormatHistory(t *testing.T) {
+	entries, err := history.Parse("zsh", []byte(": 1700000000:0;for f in *; do\\\necho $f\\\ndone\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := formatHistory("zsh", entries)
+	if !strings.HasSuffix(got, "  for f in *; do\n    echo $f\n    done") {
+		t.Errorf("formatHistory() = %q", got)
+	}
+}
@@ -0,0 +1,199 @@
+package terminal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Record is a command typed at a shell prompt in the scrollback, with the
+// output printed before the next prompt. Output that precedes the first
+// prompt is kept as a record with no prompt or command.
+type Record struct {
+	Prompt  string
+	Command string
+	Output  string
+	// Exit is the command's exit status, or nil if the scrollback doesn't show it
+	Exit *int
+}
+
+// promptLine matches a line starting with a shell prompt: up to 80 characters
+// ending in a common prompt marker, then the command typed after it, if any
+var promptLine = regexp.MustCompile(`^(\S.{0,80}?[$#%>❯➜λ]|[$#%>❯➜λ])(?: (.*))?$`)
+
+// semanticMark matches an OSC 133 semantic prompt mark, terminated by BEL or ST.
+// A starts the prompt, B the command, C the output, and D ends the command
+// with an optional exit status.
+var semanticMark = regexp.MustCompile(`\x1b\]133;([ABCD])([^\x07\x1b]*)(?:\x07|\x1b\\)`)
+
+// ParseRecords splits scrollback into the commands typed at each prompt and
+// their output. The current prompt is the last record. OSC 133 semantic prompt
+// marks are used when the scrollback carries them, which also gives each
+// command's exit status; otherwise prompts are recognised heuristically. It
+// returns nil if neither finds a prompt. tmux capture-pane drops the marks,
+// so its scrollback only gets an exit status from SetLastStatus.
+func ParseRecords(scrollback string) []Record {
+	if semanticMark.MatchString(scrollback) {
+		return parseMarkedRecords(scrollback)
+	}
+	return parsePromptRecords(scrollback)
+}
+
+// LastStatusEnvVar is exported by the shell integrations before each prompt
+// with the exit status of the command just run
+const LastStatusEnvVar = "CMD_LAST_STATUS"
+
+// SetLastStatus gives the last command before the current prompt the exit
+// status from LastStatusEnvVar, unless the scrollback already showed one. A
+// status that isn't a number, such as an unset variable, is ignored.
+func SetLastStatus(records []Record, status string) {
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return
+	}
+	for i := len(records) - 2; i >= 0; i-- {
+		if records[i].Command == "" {
+			continue
+		}
+		if records[i].Exit == nil {
+			records[i].Exit = &code
+		}
+		return
+	}
+}
+
+// parseMarkedRecords splits scrollback at its OSC 133 marks
+func parseMarkedRecords(scrollback string) []Record {
+	const (
+		inOutput = iota
+		inPrompt
+		inCommand
+	)
+	var records []Record
+	var leading strings.Builder
+	state := inOutput
+
+	write := func(text string) {
+		if len(records) == 0 {
+			leading.WriteString(text)
+			return
+		}
+		record := &records[len(records)-1]
+		if state == inCommand {
+			// Shells that don't mark C start the output on the next line
+			command, output, found := strings.Cut(text, "\n")
+			record.Command += command
+			if !found {
+				return
+			}
+			text, state = output, inOutput
+		}
+		switch state {
+		case inPrompt:
+			record.Prompt += text
+		default:
+			record.Output += text
+		}
+	}
+
+	pos := 0
+	for _, m := range semanticMark.FindAllStringSubmatchIndex(scrollback, -1) {
+		write(scrollback[pos:m[0]])
+		pos = m[1]
+
+		switch scrollback[m[2]:m[3]] {
+		case "A":
+			records = append(records, Record{})
+			state = inPrompt
+		case "B":
+			state = inCommand
+		case "C":
+			state = inOutput
+		case "D":
+			// D;<status> may carry further ;key=value options
+			status, _, _ := strings.Cut(strings.TrimPrefix(scrollback[m[4]:m[5]], ";"), ";")
+			if code, err := strconv.Atoi(status); err == nil && len(records) > 0 {
+				records[len(records)-1].Exit = &code
+			}
+			state = inOutput
+		}
+	}
+	write(scrollback[pos:])
+
+	for i := range records {
+		records[i].Prompt = strings.TrimSpace(records[i].Prompt)
+		records[i].Command = strings.TrimSpace(records[i].Command)
+		records[i].Output = strings.Trim(records[i].Output, "\n")
+	}
+	if output := strings.Trim(leading.String(), "\n"); output != "" {
+		records = append([]Record{{Output: output}}, records...)
+	}
+	return records
+}
+
+// parsePromptRecords recognises prompts by their shape. The last line is
+// taken to be the current prompt, and other lines count as prompts when they
+// start and end the same way, so output that happens to contain a marker is
+// not mistaken for one.
+func parsePromptRecords(scrollback string) []Record {
+	lines := strings.Split(strings.TrimRight(scrollback, " \n"), "\n")
+	current := promptLine.FindStringSubmatch(lines[len(lines)-1])
+	if current == nil {
+		return nil
+	}
+	first, _ := utf8.DecodeRuneInString(current[1])
+	marker, _ := utf8.DecodeLastRuneInString(current[1])
+
+	var records []Record
+	var output []string
+	flush := func() {
+		if len(records) > 0 {
+			records[len(records)-1].Output = strings.Join(output, "\n")
+		} else if len(output) > 0 {
+			records = append(records, Record{Output: strings.Join(output, "\n")})
+		}
+		output = nil
+	}
+	for _, line := range lines {
+		m := promptLine.FindStringSubmatch(line)
+		if m != nil && strings.HasPrefix(m[1], string(first)) && strings.HasSuffix(m[1], string(marker)) {
+			flush()
+			records = append(records, Record{Prompt: m[1], Command: strings.TrimSpace(m[2])})
+			continue
+		}
+		output = append(output, line)
+	}
+	flush()
+	return records
+}
+
+// FormatRecords renders records for the prompt, one command per block with
+// its exit status when known and its output indented beneath it. Empty
+// prompts, including the current one, are left out.
+func FormatRecords(records []Record) string {
+	var blocks []string
+	for _, record := range records {
+		if record.Command == "" && record.Output == "" {
+			continue
+		}
+
+		var sb strings.Builder
+		if record.Command == "" {
+			sb.WriteString("Output without a command:")
+		} else {
+			fmt.Fprintf(&sb, "Command: %s", record.Command)
+			if record.Exit != nil {
+				fmt.Fprintf(&sb, " (exit status %d)", *record.Exit)
+			}
+		}
+		if record.Output == "" {
+			sb.WriteString("\nNo output")
+		} else {
+			sb.WriteString("\n  " + strings.ReplaceAll(record.Output, "\n", "\n  "))
+		}
+		blocks = append(blocks, sb.String())
+	}
+	return strings.Join(blocks, "\n\n")
+}
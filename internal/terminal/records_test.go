@@ -0,0 +1,104 @@
+package terminal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRecords(t *testing.T) {
+	tests := []struct {
+		name       string
+		scrollback string
+		want       []Record
+	}{
+		{
+			name:       "bash prompt",
+			scrollback: "Last login: today\nuser@host:~/src$ ls\na.txt  b.txt\nuser@host:~/src$ cat c.txt\ncat: c.txt: No such file or directory\nuser@host:~/src$ ",
+			want: []Record{
+				{Output: "Last login: today"},
+				{Prompt: "user@host:~/src$", Command: "ls", Output: "a.txt  b.txt"},
+				{Prompt: "user@host:~/src$", Command: "cat c.txt", Output: "cat: c.txt: No such file or directory"},
+				{Prompt: "user@host:~/src$"},
+			},
+		},
+		{
+			name:       "fish prompt and redirections in output",
+			scrollback: "~/src> echo 'a > b'\na > b\n~/src> make buidl\nmake: *** No rule to make target 'buidl'.  Stop.\n~/src> cmd fix",
+			want: []Record{
+				{Prompt: "~/src>", Command: "echo 'a > b'", Output: "a > b"},
+				{Prompt: "~/src>", Command: "make buidl", Output: "make: *** No rule to make target 'buidl'.  Stop."},
+				{Prompt: "~/src>", Command: "cmd fix"},
+			},
+		},
+		{
+			name:       "bare marker and empty command",
+			scrollback: "❯ gti status\nzsh: command not found: gti\n❯\n❯",
+			want: []Record{
+				{Prompt: "❯", Command: "gti status", Output: "zsh: command not found: gti"},
+				{Prompt: "❯"},
+				{Prompt: "❯"},
+			},
+		},
+		{
+			name: "OSC 133 marks with exit statuses",
+			scrollback: "\x1b]133;A\x07~/src \x1b]133;B\x07make buidl\n\x1b]133;C\x07make: *** No rule.\n\x1b]133;D;2\x07" +
+				"\x1b]133;A;click_events=1\x1b\\~/src \x1b]133;B\x1b\\true\nno C mark\n\x1b]133;D;0\x07\x1b]133;A\x07~/src \x1b]133;B\x07",
+			want: []Record{
+				{Prompt: "~/src", Command: "make buidl", Output: "make: *** No rule.", Exit: exit(2)},
+				{Prompt: "~/src", Command: "true", Output: "no C mark", Exit: exit(0)},
+				{Prompt: "~/src"},
+			},
+		},
+		{
+			name:       "no prompt on the last line",
+			scrollback: "$ sleep 100\nstill running",
+			want:       nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseRecords(tt.scrollback); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRecords() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetLastStatus(t *testing.T) {
+	records := ParseRecords("$ make buidl\nmake: *** No rule.\n$\n$ ")
+	SetLastStatus(records, "2")
+	if exit := records[0].Exit; exit == nil || *exit != 2 {
+		t.Errorf("Exit = %v, want 2 on the last command", exit)
+	}
+	if records[1].Exit != nil || records[2].Exit != nil {
+		t.Errorf("records = %#v, want no status on the empty or current prompt", records)
+	}
+
+	// A status from the scrollback's own marks wins, and a missing one is ignored
+	records = []Record{{Command: "true", Exit: exit(0)}, {Prompt: "$"}}
+	SetLastStatus(records, "1")
+	SetLastStatus(records, "")
+	if *records[0].Exit != 0 {
+		t.Errorf("Exit = %d, want 0", *records[0].Exit)
+	}
+}
+
+func TestFormatRecords(t *testing.T) {
+	got := FormatRecords([]Record{
+		{Output: "Last login: today"},
+		{Prompt: "$", Command: "make buidl", Output: "make: *** No rule.\nStop.", Exit: exit(2)},
+		{Prompt: "$", Command: "touch a"},
+		{Prompt: "$"},
+	})
+	want := "Output without a command:\n  Last login: today\n\n" +
+		"Command: make buidl (exit status 2)\n  make: *** No rule.\n  Stop.\n\n" +
+		"Command: touch a\nNo output"
+	if got != want {
+		t.Errorf("FormatRecords() = %q, want %q", got, want)
+	}
+}
+
+func exit(code int) *int {
+	return &code
+}
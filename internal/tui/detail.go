@@ -8,7 +8,10 @@ import (
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/jerryluo/cmd/internal/claude"
 	"github.com/jerryluo/cmd/internal/logging"
+	"github.com/jerryluo/cmd/internal/risk"
+	"github.com/jerryluo/cmd/internal/terminal"
 )
 
 // Tab indices
@@ -41,11 +44,16 @@ type detailModel struct {
 	err           error
 	showHelp      bool
 	statusMessage string
+
+	// records are the commands in the terminal context, listed in the Tmux
+	// tab; the selected one is expanded to show its output
+	records        []terminal.Record
+	selectedRecord int
 }
 
 func newDetailModel() detailModel {
 	return detailModel{
-		tabs: []string{"Response", "System", "User Prompt", "Query", "Tmux", "Docs", "Build Tools", "Preferences"},
+		tabs: []string{"Response", "System", "User Prompt", "Query", "Terminal", "Docs", "Build Tools", "Preferences"},
 	}
 }
 
@@ -69,6 +77,11 @@ func (m detailModel) Update(msg tea.Msg) (detailModel, tea.Cmd) {
 		}
 		m.log = msg.log
 		m.activeTab = tabResponse
+		m.records = nil
+		if m.log.TerminalInfo().InTmux {
+			m.records = commandRecords(m.log.ContextSources.TerminalContext)
+		}
+		m.selectedRecord = len(m.records) - 1
 		if !m.ready {
 			m.viewport = viewport.New(m.width, m.height-7)
 			m.ready = true
@@ -97,6 +110,21 @@ func (m detailModel) Update(msg tea.Msg) (detailModel, tea.Cmd) {
 				m.viewport.GotoTop()
 			}
 			return m, nil
+		case "n", "p":
+			if m.activeTab != tabTmuxContext || len(m.records) == 0 {
+				break
+			}
+			if msg.String() == "n" {
+				m.selectedRecord = min(m.selectedRecord+1, len(m.records)-1)
+			} else {
+				m.selectedRecord = max(m.selectedRecord-1, 0)
+			}
+			content, line := m.renderTmuxContext()
+			m.viewport.SetContent(content)
+			if line < m.viewport.YOffset || line >= m.viewport.YOffset+m.viewport.Height {
+				m.viewport.SetYOffset(line)
+			}
+			return m, nil
 		}
 	}
 
@@ -159,7 +187,7 @@ func (m detailModel) View() string {
 		status := lipgloss.NewStyle().Foreground(colorGreen).Render(m.statusMessage)
 		helpLine = status + "  " + helpStyle.Render("esc back  tab/1-8 switch tab  c copy  ? help  q quit")
 	} else if m.showHelp {
-		helpLine = helpStyle.Render("esc back to list  tab/l next tab  shift+tab/h prev tab  1-8 jump to tab\nc copy content  ? toggle help  q quit  ↑/↓ scroll")
+		helpLine = helpStyle.Render("esc back to list  tab/l next tab  shift+tab/h prev tab  1-8 jump to tab\nc copy content  n/p next/prev command (Terminal tab)  ? toggle help  q quit  ↑/↓ scroll")
 	} else {
 		helpLine = helpStyle.Render("esc back  tab/1-8 switch tab  c copy  ? help  q quit")
 	}
@@ -174,6 +202,10 @@ func (m detailModel) renderMetadata() string {
 
 	parts := []string{ago}
 
+	if t := m.log.Type(); t != logging.TypeGenerate {
+		parts = append(parts, string(t))
+	}
+
 	if m.log.Metadata.IterationCount > 0 {
 		iterLabel := "iteration"
 		if m.log.Metadata.IterationCount != 1 {
@@ -183,7 +215,23 @@ func (m detailModel) renderMetadata() string {
 	}
 
 	parts = append(parts, StatusStyle(string(m.log.Metadata.FinalStatus)))
-	parts = append(parts, ModelStyle(m.log.Metadata.Model))
+	parts = append(parts, ModelStyle(claude.FormatModel(m.log.Metadata.Provider, m.log.Metadata.Model)))
+
+	if profile := m.log.Metadata.Profile; profile != "" {
+		parts = append(parts, "profile "+profile)
+	}
+
+	if level := m.log.Risk(); risk.AtLeast(level, risk.Medium) {
+		parts = append(parts, RiskStyle(level))
+	}
+
+	if cost := m.log.CostUSD(); cost > 0 {
+		parts = append(parts, fmt.Sprintf("$%.4f", cost))
+	}
+
+	if n := m.log.RedactionCount(); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d redacted", n))
+	}
 
 	return strings.Join(parts, " · ")
 }
@@ -192,6 +240,12 @@ func (m detailModel) renderIterationHistory() string {
 	var lines []string
 	for i, iter := range m.log.Iterations {
 		cmd := iter.ModelOutput.Command
+		if iter.Error != "" {
+			cmd = "✗ " + iter.Error
+		}
+		if iter.Execution != nil {
+			cmd = fmt.Sprintf("%s (exit %d)", iter.Execution.Command, iter.Execution.ExitCode)
+		}
 		if len(cmd) > 50 {
 			cmd = cmd[:47] + "..."
 		}
@@ -235,60 +289,320 @@ func (m detailModel) renderTabContent() string {
 	case tabUserQuery:
 		return renderTextBlock("User Query", m.log.UserQuery)
 	case tabTmuxContext:
-		return m.renderTmuxContext()
+		content, _ := m.renderTmuxContext()
+		return content
 	case tabDocContext:
-		return renderTextBlock("Documentation Context", m.log.ContextSources.DocumentationContext)
+		return m.truncationNote("docs") + renderTextBlock("Documentation Context", m.log.ContextSources.DocumentationContext)
 	case tabBuildTools:
-		return m.renderBuildTools(lastIter)
+		return m.truncationNote("build_tools") + m.renderBuildTools(lastIter)
 	case tabPreferences:
-		return renderTextBlock("Preferences (claude.md)", m.log.ContextSources.ClaudeMdContent)
+		return m.renderPreferences()
 	default:
 		return ""
 	}
 }
 
 func (m detailModel) renderResponse(iter logging.Iteration) string {
+	if len(iter.ModelOutput.Steps) > 0 {
+		return m.renderSteps(iter)
+	}
+	if len(iter.ModelOutput.Parts) > 0 {
+		return m.renderParts(iter)
+	}
+	return m.renderAlternatives(iter) + m.renderExecution(iter.Execution)
+}
+
+// renderSteps renders a --script response one step at a time, with the
+// user's edits and skips and each step's execution
+func (m detailModel) renderSteps(iter logging.Iteration) string {
 	var s strings.Builder
+	if iter.ModelOutput.Explanation != "" {
+		s.WriteString("  Script: ")
+		s.WriteString(iter.ModelOutput.Explanation)
+		s.WriteString("\n\n")
+	}
 
-	s.WriteString("  Command:\n")
-	cmd := codeBlockStyle.Width(m.width - 4).Render(iter.ModelOutput.Command)
-	s.WriteString(cmd)
-	s.WriteString("\n\n")
+	for i, step := range iter.ModelOutput.Steps {
+		label := fmt.Sprintf("  Step %d:", i+1)
+		switch {
+		case step.Skipped:
+			label += " " + helpStyle.Render("skipped")
+		case step.Original != "":
+			label += " " + lipgloss.NewStyle().Foreground(colorYellow).Render("edited")
+		}
+		s.WriteString(label)
+		s.WriteString("\n")
+		s.WriteString(codeBlockStyle.Width(m.width - 4).Render(step.Command))
+		s.WriteString("\n")
+		if step.Original != "" {
+			s.WriteString("  ")
+			s.WriteString(helpStyle.Render("was: " + step.Original))
+			s.WriteString("\n")
+		}
+		s.WriteString(renderRisk(logging.Alternative{Risk: step.Risk, RiskReasons: step.RiskReasons, Findings: step.Findings}))
+		if step.Explanation != "" {
+			s.WriteString("\n  ")
+			s.WriteString(step.Explanation)
+			s.WriteString("\n")
+		}
+		if step.Execution != nil {
+			s.WriteString("\n")
+			s.WriteString(m.renderExecution(step.Execution))
+		}
+		s.WriteString("\n")
+	}
+
+	return s.String()
+}
+
+func (m detailModel) renderAlternatives(iter logging.Iteration) string {
+	var s strings.Builder
+
+	if iter.Error != "" {
+		s.WriteString("  Error:\n")
+		s.WriteString("  ")
+		s.WriteString(lipgloss.NewStyle().Foreground(colorRed).Render(iter.Error))
+		s.WriteString("\n")
+		return s.String()
+	}
+
+	alternatives := iter.ModelOutput.Alternatives
+	if len(alternatives) <= 1 {
+		s.WriteString("  Command:\n")
+		cmd := codeBlockStyle.Width(m.width - 4).Render(iter.ModelOutput.Command)
+		s.WriteString(cmd)
+		s.WriteString("\n\n")
+
+		if len(alternatives) == 1 {
+			s.WriteString(renderRisk(alternatives[0]))
+		}
+
+		if iter.ModelOutput.Explanation != "" {
+			s.WriteString("  Explanation:\n")
+			s.WriteString("  ")
+			s.WriteString(iter.ModelOutput.Explanation)
+			s.WriteString("\n")
+		}
 
+		return s.String()
+	}
+
+	accepted := m.log.Metadata.AcceptedAlternative
+	for i, alt := range alternatives {
+		label := fmt.Sprintf("  Alternative %d:", i+1)
+		if i+1 == accepted {
+			label += " " + lipgloss.NewStyle().Foreground(colorGreen).Render("✓ accepted")
+		}
+		s.WriteString(label)
+		s.WriteString("\n")
+		s.WriteString(codeBlockStyle.Width(m.width - 4).Render(alt.Command))
+		s.WriteString("\n")
+		s.WriteString(renderRisk(alt))
+		if alt.Tradeoff != "" {
+			s.WriteString("  ")
+			s.WriteString(helpStyle.Render(alt.Tradeoff))
+			s.WriteString("\n")
+		}
+		if alt.Explanation != "" {
+			s.WriteString("\n  ")
+			s.WriteString(alt.Explanation)
+			s.WriteString("\n")
+		}
+		s.WriteString("\n")
+	}
+
+	return s.String()
+}
+
+// renderParts renders the breakdown of a command explained by `cmd explain`
+func (m detailModel) renderParts(iter logging.Iteration) string {
+	var s strings.Builder
+	s.WriteString("  Explained command:\n")
+	s.WriteString(codeBlockStyle.Width(m.width - 4).Render(iter.ModelOutput.Command))
+	s.WriteString("\n\n")
+	if len(iter.ModelOutput.Alternatives) == 1 {
+		s.WriteString(renderRisk(iter.ModelOutput.Alternatives[0]))
+	}
 	if iter.ModelOutput.Explanation != "" {
-		s.WriteString("  Explanation:\n")
 		s.WriteString("  ")
 		s.WriteString(iter.ModelOutput.Explanation)
+		s.WriteString("\n\n")
+	}
+
+	s.WriteString("  Breakdown:\n")
+	for _, part := range iter.ModelOutput.Parts {
+		s.WriteString("    ")
+		s.WriteString(lipgloss.NewStyle().Foreground(colorCyan).Render(part.Text))
+		s.WriteString("\n      ")
+		s.WriteString(part.Explanation)
+		s.WriteString("\n")
+	}
+	return s.String()
+}
+
+// renderExecution renders the exit code and output of a command run from the prompt
+func (m detailModel) renderExecution(exec *logging.Execution) string {
+	if exec == nil {
+		return ""
+	}
+
+	var s strings.Builder
+	status := lipgloss.NewStyle().Foreground(colorGreen).Render("✓ exit 0")
+	if exec.ExitCode != 0 {
+		status = lipgloss.NewStyle().Foreground(colorRed).Render(fmt.Sprintf("✗ exit %d", exec.ExitCode))
+	}
+	s.WriteString(fmt.Sprintf("  Executed: %s  %s\n", status, helpStyle.Render(fmt.Sprintf("%.1fs", float64(exec.DurationMs)/1000))))
+	s.WriteString(codeBlockStyle.Width(m.width - 4).Render(exec.Command))
+	s.WriteString("\n")
+	if exec.Output != "" {
+		s.WriteString("\n  Output:\n")
+		s.WriteString(exec.Output)
 		s.WriteString("\n")
 	}
+	return s.String()
+}
+
+// renderRisk renders the risk level of a medium or high risk alternative with
+// the model's reasons and the safety findings
+func renderRisk(alt logging.Alternative) string {
+	level := alt.RiskLevel()
+	if !risk.AtLeast(level, risk.Medium) {
+		return ""
+	}
 
+	var s strings.Builder
+	s.WriteString("  ")
+	s.WriteString(RiskStyle(level))
+	s.WriteString("\n")
+	for _, reason := range alt.RiskReasons {
+		s.WriteString("    • ")
+		s.WriteString(reason)
+		s.WriteString("\n")
+	}
+	for _, f := range alt.Findings {
+		s.WriteString("    • ")
+		s.WriteString(f.Message)
+		s.WriteString(" ")
+		s.WriteString(helpStyle.Render("[" + f.Rule + "]"))
+		s.WriteString("\n")
+	}
 	return s.String()
 }
 
-func (m detailModel) renderTmuxContext() string {
+// renderTmuxContext renders the session info and the terminal context as a
+// list of commands, returning the line of the selected command so it can be
+// scrolled into view. Scrollback without recognisable prompts is shown as is.
+func (m detailModel) renderTmuxContext() (string, int) {
 	var s strings.Builder
 
-	info := m.log.Metadata.TmuxInfo
-	if info.InTmux {
+	info := m.log.TerminalInfo()
+	switch {
+	case info.InTmux:
 		s.WriteString("  Tmux Session Info:\n")
 		s.WriteString(fmt.Sprintf("    Session: %s\n", info.Session))
 		s.WriteString(fmt.Sprintf("    Window:  %s\n", info.Window))
 		s.WriteString(fmt.Sprintf("    Pane:    %s\n", info.Pane))
 		s.WriteString("\n")
-	} else {
-		s.WriteString("  Not running in tmux\n\n")
+	case info.HistoryFile != "":
+		s.WriteString("  Shell History:\n")
+		s.WriteString(fmt.Sprintf("    File:     %s\n", info.HistoryFile))
+		s.WriteString(fmt.Sprintf("    Commands: %d\n", info.Commands))
+		if info.Dir != "" {
+			s.WriteString(fmt.Sprintf("    Only referring to files in %s\n", info.Dir))
+		}
+		s.WriteString("\n")
+	default:
+		s.WriteString("  Not running in tmux, and no shell history found\n\n")
 	}
 
+	s.WriteString(m.truncationNote("terminal"))
+
 	ctx := m.log.ContextSources.TerminalContext
-	if ctx != "" {
-		s.WriteString("  Terminal Scrollback:\n")
+	switch {
+	case len(m.records) > 0:
+		s.WriteString(fmt.Sprintf("  Commands (%d, n/p to select):\n\n", len(m.records)))
+	case ctx != "":
+		s.WriteString("  Terminal Context:\n")
 		s.WriteString(ctx)
 		s.WriteString("\n")
-	} else {
+		return s.String(), 0
+	default:
 		s.WriteString("  No terminal context captured\n")
+		return s.String(), 0
 	}
 
-	return s.String()
+	selectedLine := 0
+	for i, record := range m.records {
+		header := lipgloss.NewStyle().Bold(true).Render(record.Prompt + " " + record.Command)
+		if record.Command == "" {
+			header = helpStyle.Render("(output without a command)")
+		}
+		if record.Exit != nil {
+			if *record.Exit == 0 {
+				header += " " + lipgloss.NewStyle().Foreground(colorGreen).Render("✓")
+			} else {
+				header += " " + lipgloss.NewStyle().Foreground(colorRed).Render(fmt.Sprintf("✗ exit %d", *record.Exit))
+			}
+		}
+
+		lines := 0
+		if record.Output != "" {
+			lines = strings.Count(record.Output, "\n") + 1
+		}
+		if i != m.selectedRecord {
+			lineLabel := "lines"
+			if lines == 1 {
+				lineLabel = "line"
+			}
+			s.WriteString("    " + header + " " + helpStyle.Render(fmt.Sprintf("(%d %s)", lines, lineLabel)) + "\n")
+			continue
+		}
+
+		selectedLine = strings.Count(s.String(), "\n")
+		s.WriteString("  ▸ " + header + "\n")
+		if lines == 0 {
+			s.WriteString("      " + helpStyle.Render("No output") + "\n")
+			continue
+		}
+		for _, line := range strings.Split(record.Output, "\n") {
+			s.WriteString("      " + line + "\n")
+		}
+	}
+	return s.String(), selectedLine
+}
+
+// commandRecords splits a logged terminal context into the commands it shows,
+// leaving out empty prompts
+func commandRecords(scrollback string) []terminal.Record {
+	var records []terminal.Record
+	for _, record := range terminal.ParseRecords(scrollback) {
+		if record.Command != "" || record.Output != "" {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// renderPreferences shows each claude.md file as its own section, in the
+// order they were merged, then the preferences from cmd.toml. Logs from
+// before project files were recorded only have the merged content.
+func (m detailModel) renderPreferences() string {
+	sources := m.log.ContextSources
+	if len(sources.ClaudeMdFiles) == 0 && len(sources.SettingsPreferences) == 0 {
+		return renderTextBlock("Preferences (claude.md)", sources.ClaudeMdContent)
+	}
+	var sections []string
+	for _, file := range sources.ClaudeMdFiles {
+		if strings.TrimSpace(file.Content) == "" {
+			sections = append(sections, fmt.Sprintf("  %s: %s\n", file.Path, helpStyle.Render("empty")))
+			continue
+		}
+		sections = append(sections, renderTextBlock(file.Path, strings.TrimRight(file.Content, "\n")))
+	}
+	if prefs := sources.SettingsPreferences; len(prefs) > 0 {
+		sections = append(sections, renderTextBlock("Preferences from cmd.toml", "- "+strings.Join(prefs, "\n- ")))
+	}
+	return strings.Join(sections, "\n")
 }
 
 func (m detailModel) renderBuildTools(iter logging.Iteration) string {
@@ -323,6 +637,9 @@ func (m detailModel) copyableContent() string {
 	lastIter := m.log.Iterations[len(m.log.Iterations)-1]
 	switch m.activeTab {
 	case tabResponse:
+		if m.log.Metadata.AcceptedCommand != "" {
+			return m.log.Metadata.AcceptedCommand
+		}
 		return lastIter.ModelOutput.Command
 	case tabSystemPrompt:
 		return lastIter.ModelInput.SystemPrompt
@@ -359,6 +676,17 @@ func (m detailModel) extractBuildToolsText(iter logging.Iteration) string {
 	return ""
 }
 
+// truncationNote describes how much of a context source was dropped from the prompt, if any
+func (m detailModel) truncationNote(source string) string {
+	for _, t := range m.log.ContextSources.Truncations {
+		if t.Source == source {
+			note := fmt.Sprintf("Trimmed to fit the token budget: %d lines dropped, ~%d of %d tokens sent", t.DroppedLines, t.KeptTokens, t.Tokens)
+			return "  " + lipgloss.NewStyle().Foreground(colorYellow).Render(note) + "\n\n"
+		}
+	}
+	return ""
+}
+
 func renderTextBlock(title, content string) string {
 	if content == "" {
 		return fmt.Sprintf("  No %s available\n", strings.ToLower(title))
@@ -3,16 +3,19 @@ package tui
 import "github.com/charmbracelet/bubbles/key"
 
 type keyMap struct {
-	Quit         key.Binding
-	Help         key.Binding
-	Enter        key.Binding
-	Back         key.Binding
-	Search       key.Binding
-	StatusFilter key.Binding
-	NextTab      key.Binding
-	PrevTab      key.Binding
-	Escape       key.Binding
-	Copy         key.Binding
+	Quit          key.Binding
+	Help          key.Binding
+	Enter         key.Binding
+	Back          key.Binding
+	Search        key.Binding
+	StatusFilter  key.Binding
+	RiskFilter    key.Binding
+	TypeFilter    key.Binding
+	ProfileFilter key.Binding
+	NextTab       key.Binding
+	PrevTab       key.Binding
+	Escape        key.Binding
+	Copy          key.Binding
 }
 
 func newKeyMap() keyMap {
@@ -41,6 +44,18 @@ func newKeyMap() keyMap {
 			key.WithKeys("s"),
 			key.WithHelp("s", "cycle status filter"),
 		),
+		RiskFilter: key.NewBinding(
+			key.WithKeys("r"),
+			key.WithHelp("r", "cycle risk filter"),
+		),
+		TypeFilter: key.NewBinding(
+			key.WithKeys("t"),
+			key.WithHelp("t", "cycle session type filter"),
+		),
+		ProfileFilter: key.NewBinding(
+			key.WithKeys("p"),
+			key.WithHelp("p", "cycle profile filter"),
+		),
 		NextTab: key.NewBinding(
 			key.WithKeys("tab", "l"),
 			key.WithHelp("tab/l", "next tab"),
@@ -68,7 +83,7 @@ func (k keyMap) ShortHelp() []key.Binding {
 // FullHelp returns keybindings for the expanded help view.
 func (k keyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
-		{k.Enter, k.Back, k.Search, k.StatusFilter},
+		{k.Enter, k.Back, k.Search, k.StatusFilter, k.RiskFilter, k.TypeFilter, k.ProfileFilter},
 		{k.NextTab, k.PrevTab, k.Copy},
 		{k.Help, k.Quit},
 	}
@@ -2,6 +2,7 @@ package tui
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -10,7 +11,9 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 
+	"github.com/jerryluo/cmd/internal/claude"
 	"github.com/jerryluo/cmd/internal/logging"
+	"github.com/jerryluo/cmd/internal/risk"
 )
 
 // logsLoadedMsg is sent when logs have been loaded from disk.
@@ -25,6 +28,9 @@ type listModel struct {
 	searchInput   textinput.Model
 	searching     bool
 	statusFilter  string
+	riskFilter    string
+	typeFilter    logging.SessionType
+	profileFilter string
 	allLogs       []logging.LogSummary
 	filteredLogs  []logging.LogSummary
 	width         int
@@ -87,11 +93,12 @@ func (m listModel) columns() []table.Column {
 	}
 
 	statusW := 10
-	modelW := 8
+	modelW := 12
+	profileW := 10
 	timeW := 10
-	fixedW := statusW + modelW + timeW
-	// Account for cell padding (1 on each side per column = 2 per column, 5 columns)
-	remaining := w - fixedW - 10
+	fixedW := statusW + modelW + profileW + timeW
+	// Account for cell padding (1 on each side per column = 2 per column, 6 columns)
+	remaining := w - fixedW - 12
 	if remaining < 20 {
 		remaining = 20
 	}
@@ -102,6 +109,7 @@ func (m listModel) columns() []table.Column {
 		{Title: "Query", Width: queryW},
 		{Title: "Status", Width: statusW},
 		{Title: "Model", Width: modelW},
+		{Title: "Profile", Width: profileW},
 		{Title: "Time", Width: timeW},
 		{Title: "Command", Width: cmdW},
 	}
@@ -170,6 +178,18 @@ func (m listModel) updateNormal(msg tea.KeyMsg) (listModel, tea.Cmd) {
 		m.cycleStatusFilter()
 		m.applyFilters()
 		return m, nil
+	case "r":
+		m.cycleRiskFilter()
+		m.applyFilters()
+		return m, nil
+	case "t":
+		m.cycleTypeFilter()
+		m.applyFilters()
+		return m, nil
+	case "p":
+		m.cycleProfileFilter()
+		m.applyFilters()
+		return m, nil
 	}
 
 	var cmd tea.Cmd
@@ -177,21 +197,67 @@ func (m listModel) updateNormal(msg tea.KeyMsg) (listModel, tea.Cmd) {
 	return m, cmd
 }
 
-// cycleStatusFilter cycles through "" -> "accepted" -> "rejected" -> "quit" -> "".
+// cycleStatusFilter cycles through "" -> "accepted" -> "executed" -> "rejected" -> "quit" -> "explained" -> "".
 func (m *listModel) cycleStatusFilter() {
 	switch m.statusFilter {
 	case "":
 		m.statusFilter = "accepted"
 	case "accepted":
+		m.statusFilter = "executed"
+	case "executed":
 		m.statusFilter = "rejected"
 	case "rejected":
 		m.statusFilter = "quit"
 	case "quit":
+		m.statusFilter = "explained"
+	case "explained":
 		m.statusFilter = ""
 	}
 }
 
-// applyFilters filters allLogs based on search text and status filter,
+// cycleRiskFilter cycles through "" -> "high" -> "medium" -> "".
+// A risk filter matches sessions at or above that level.
+func (m *listModel) cycleRiskFilter() {
+	switch m.riskFilter {
+	case "":
+		m.riskFilter = "high"
+	case "high":
+		m.riskFilter = "medium"
+	case "medium":
+		m.riskFilter = ""
+	}
+}
+
+// cycleTypeFilter cycles through "" and each session type in turn.
+func (m *listModel) cycleTypeFilter() {
+	types := logging.SessionTypes
+	i := slices.Index(types, m.typeFilter)
+	if i == len(types)-1 {
+		m.typeFilter = ""
+	} else {
+		m.typeFilter = types[i+1]
+	}
+}
+
+// cycleProfileFilter cycles through "" and each profile used in the logs, in
+// alphabetical order.
+func (m *listModel) cycleProfileFilter() {
+	var profiles []string
+	for _, log := range m.allLogs {
+		if log.Profile != "" && !slices.Contains(profiles, log.Profile) {
+			profiles = append(profiles, log.Profile)
+		}
+	}
+	slices.Sort(profiles)
+	i := slices.Index(profiles, m.profileFilter)
+	if i == len(profiles)-1 {
+		m.profileFilter = ""
+	} else {
+		m.profileFilter = profiles[i+1]
+	}
+}
+
+// applyFilters filters allLogs based on search text, status, risk, type and profile filters,
 // then rebuilds the table rows.
 func (m *listModel) applyFilters() {
 	search := strings.ToLower(m.searchInput.Value())
@@ -201,6 +267,15 @@ func (m *listModel) applyFilters() {
 		if m.statusFilter != "" && string(log.FinalStatus) != m.statusFilter {
 			continue
 		}
+		if m.riskFilter != "" && !risk.AtLeast(log.Risk, m.riskFilter) {
+			continue
+		}
+		if m.typeFilter != "" && log.Type != m.typeFilter {
+			continue
+		}
+		if m.profileFilter != "" && log.Profile != m.profileFilter {
+			continue
+		}
 		if search != "" {
 			q := strings.ToLower(log.UserQuery)
 			c := strings.ToLower(log.CommandPreview)
@@ -221,7 +296,8 @@ func (m *listModel) rebuildRows() {
 		rows[i] = table.Row{
 			log.UserQuery,
 			statusText(string(log.FinalStatus)),
-			log.Model,
+			claude.FormatModel(log.Provider, log.Model),
+			log.Profile,
 			shortTimeAgo(log.Timestamp),
 			log.CommandPreview,
 		}
@@ -265,11 +341,11 @@ func (m listModel) View() string {
 	var helpLine string
 	if m.statusMessage != "" {
 		status := lipgloss.NewStyle().Foreground(colorGreen).Render(m.statusMessage)
-		helpLine = status + "  " + helpStyle.Render("/ search  s filter  c copy  enter view  ? help  q quit")
+		helpLine = status + "  " + helpStyle.Render("/ search  s filter  r risk  t type  p profile  c copy  enter view  ? help  q quit")
 	} else if m.showHelp {
-		helpLine = helpStyle.Render("/ search  s cycle status  c copy command  enter view details  ? toggle help  q quit\n↑/↓ navigate  page up/down scroll")
+		helpLine = helpStyle.Render("/ search  s cycle status  r cycle risk  t cycle type  p cycle profile  c copy command  enter view details  ? toggle help  q quit\n↑/↓ navigate  page up/down scroll")
 	} else {
-		helpLine = helpStyle.Render("/ search  s filter  c copy  enter view  ? help  q quit")
+		helpLine = helpStyle.Render("/ search  s filter  r risk  t type  p profile  c copy  enter view  ? help  q quit")
 	}
 	b.WriteString(helpLine)
 
@@ -291,6 +367,21 @@ func (m listModel) filterStatusText() string {
 		parts = append(parts, fmt.Sprintf("%d logs", total))
 	}
 
+	switch m.riskFilter {
+	case "high":
+		parts = append(parts, "high risk")
+	case "medium":
+		parts = append(parts, "medium+ risk")
+	}
+
+	if m.typeFilter != "" {
+		parts = append(parts, string(m.typeFilter))
+	}
+
+	if m.profileFilter != "" {
+		parts = append(parts, "profile "+m.profileFilter)
+	}
+
 	search := m.searchInput.Value()
 	if search != "" && !m.searching {
 		parts = append(parts, fmt.Sprintf("search: %s", search))
@@ -316,10 +407,14 @@ func statusText(status string) string {
 	switch strings.ToLower(status) {
 	case "accepted":
 		return "✓ accepted"
+	case "executed":
+		return "▶ executed"
 	case "rejected":
 		return "✗ rejected"
 	case "quit":
 		return "- quit"
+	case "explained":
+		return "? explained"
 	default:
 		return status
 	}
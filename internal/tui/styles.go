@@ -11,6 +11,7 @@ import (
 var (
 	colorGreen  = lipgloss.Color("2")
 	colorRed    = lipgloss.Color("1")
+	colorYellow = lipgloss.Color("3")
 	colorGray   = lipgloss.Color("8")
 	colorPurple = lipgloss.Color("5")
 	colorBlue   = lipgloss.Color("4")
@@ -40,15 +41,31 @@ func StatusStyle(status string) string {
 	switch s {
 	case "accepted":
 		return lipgloss.NewStyle().Foreground(colorGreen).Render("✓ accepted")
+	case "executed":
+		return lipgloss.NewStyle().Foreground(colorGreen).Render("▶ executed")
 	case "rejected":
 		return lipgloss.NewStyle().Foreground(colorRed).Render("✗ rejected")
 	case "quit":
 		return lipgloss.NewStyle().Foreground(colorGray).Render("- quit")
+	case "explained":
+		return lipgloss.NewStyle().Foreground(colorBlue).Render("? explained")
 	default:
 		return s
 	}
 }
 
+// RiskStyle returns styled risk text for medium and high risk levels.
+func RiskStyle(risk string) string {
+	switch strings.ToLower(risk) {
+	case "high":
+		return lipgloss.NewStyle().Foreground(colorRed).Bold(true).Render("⚠ high risk")
+	case "medium":
+		return lipgloss.NewStyle().Foreground(colorYellow).Render("⚠ medium risk")
+	default:
+		return risk
+	}
+}
+
 // ModelStyle returns styled model text for the given model name.
 func ModelStyle(model string) string {
 	m := strings.ToLower(model)
@@ -69,10 +69,10 @@ func copyCommandFromLog(id string) tea.Cmd {
 		if err != nil {
 			return clipboardCopyMsg{err: err}
 		}
-		if len(log.Iterations) == 0 {
+		cmd := log.LastCommand()
+		if cmd == "" {
 			return clipboardCopyMsg{err: fmt.Errorf("no command available")}
 		}
-		cmd := log.Iterations[len(log.Iterations)-1].ModelOutput.Command
 		return clipboardCopyMsg{err: clipboard.Copy(cmd)}
 	}
 }
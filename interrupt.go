@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+
+	"github.com/jerryluo/cmd/internal/logging"
+)
+
+// interruptHandler routes Ctrl+C to the in-flight generation if there is one.
+// Otherwise it finalizes the session log and exits, so a log is never left
+// un-finalized when launched from shell key bindings.
+type interruptHandler struct {
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	ignoring bool
+	logger   *logging.Logger
+}
+
+// handleInterrupts starts listening for SIGINT
+func handleInterrupts() *interruptHandler {
+	h := &interruptHandler{}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt)
+	go func() {
+		for range sigChan {
+			h.mu.Lock()
+			if h.ignoring {
+				h.mu.Unlock()
+				continue
+			}
+			cancel := h.cancel
+			h.cancel = nil
+			logger := h.logger
+			h.mu.Unlock()
+
+			if cancel != nil {
+				cancel()
+				continue
+			}
+
+			logger.Finalize(logging.StatusQuit, "")
+			fmt.Println()
+			os.Exit(130)
+		}
+	}()
+
+	return h
+}
+
+// setLogger sets the session log finalized on an idle Ctrl+C
+func (h *interruptHandler) setLogger(logger *logging.Logger) {
+	h.mu.Lock()
+	h.logger = logger
+	h.mu.Unlock()
+}
+
+// generationContext returns a context cancelled by the next Ctrl+C.
+// The returned release function must be called once generation finishes.
+func (h *interruptHandler) generationContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	h.mu.Lock()
+	h.cancel = cancel
+	h.mu.Unlock()
+
+	return ctx, func() {
+		h.mu.Lock()
+		h.cancel = nil
+		h.mu.Unlock()
+		cancel()
+	}
+}
+
+// ignore stops Ctrl+C from ending the session while a command runs in the
+// foreground; the command receives the signal from the terminal itself.
+// The returned function restores the default behaviour.
+func (h *interruptHandler) ignore() func() {
+	h.mu.Lock()
+	h.ignoring = true
+	h.mu.Unlock()
+
+	return func() {
+		h.mu.Lock()
+		h.ignoring = false
+		h.mu.Unlock()
+	}
+}
@@ -2,31 +2,68 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"os/signal"
+	"slices"
 	"strings"
 
 	"golang.org/x/term"
 
-	"github.com/jerryluo/cmd/internal/buildtools"
+	"github.com/jerryluo/cmd/internal/budget"
 	"github.com/jerryluo/cmd/internal/claude"
 	"github.com/jerryluo/cmd/internal/clipboard"
 	"github.com/jerryluo/cmd/internal/config"
-	"github.com/jerryluo/cmd/internal/docs"
+	"github.com/jerryluo/cmd/internal/execute"
 	"github.com/jerryluo/cmd/internal/logging"
+	"github.com/jerryluo/cmd/internal/redact"
+	"github.com/jerryluo/cmd/internal/safety"
 	"github.com/jerryluo/cmd/internal/terminal"
 	"github.com/jerryluo/cmd/internal/tui"
 )
 
 func main() {
+	// Subcommands take their own flags, except fix, which shares the
+	// generation flags and interactive loop
+	fix := false
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fix":
+			fix = true
+			os.Args = slices.Delete(os.Args, 1, 2)
+		case "stats":
+			runStats(os.Args[2:])
+			return
+		case "prompt":
+			runPrompt(os.Args[2:])
+			return
+		case "explain":
+			runExplain(os.Args[2:])
+			return
+		case "init":
+			runInit(os.Args[2:])
+			return
+		case "config":
+			runConfig(os.Args[2:])
+			return
+		}
+	}
+
 	// Parse flags
-	model := flag.String("model", "", "Claude model to use (default: opus)")
-	contextLines := flag.Int("context-lines", terminal.ScrollbackLines, "Number of tmux scrollback lines to capture")
+	addSettingFlags(flag.CommandLine, "profile", "model", "provider", "context_lines", "context_budget")
+	historyCommands := flag.Int("history-commands", terminal.HistoryCommands, "Number of shell history commands to include when not in tmux")
+	historyHere := flag.Bool("history-here", false, "Only include shell history commands that refer to files in the current directory")
 	help := flag.Bool("help", false, "Show help")
 	logs := flag.Bool("logs", false, "Launch log viewer")
 	output := flag.String("output", "", "Write accepted command to file instead of clipboard")
+	timeout := flag.Duration("timeout", config.DefaultTimeout, "Maximum time for a single generation attempt")
+	retries := flag.Int("retries", config.DefaultRetries, "Number of retries for transient generation failures")
+	script := flag.Bool("script", false, "Generate an ordered list of steps instead of a single command")
+	fixCommand := flag.String("command", "", "With fix: the command to fix (default: the last one in the tmux scrollback or shell history)")
+	buffer := flag.String("buffer", "", "Command line typed so far, from the shell integration: a partial command to complete, or a # comment to use as the query")
+	cursor := flag.Int("cursor", -1, "Cursor position in --buffer, in characters (default: the end)")
 	flag.Parse()
 
 	if *help {
@@ -40,20 +77,33 @@ func main() {
 		return
 	}
 
-	// Handle Ctrl+C for clean exit (especially when launched from shell key bindings)
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt)
-	go func() {
-		<-sigChan
-		fmt.Println()
-		os.Exit(130)
-	}()
+	// Handle Ctrl+C: cancel in-flight generation, or exit cleanly
+	// (especially when launched from shell key bindings)
+	interrupts := handleInterrupts()
+
+	if fix && *script {
+		fmt.Fprintln(os.Stderr, "Error: --script can't be used with cmd fix")
+		os.Exit(2)
+	}
+	if fix && *buffer != "" {
+		fmt.Fprintln(os.Stderr, "Error: --buffer can't be used with cmd fix")
+		os.Exit(2)
+	}
 
-	// Get the query from arguments or interactive prompt
+	// Get the query from arguments, a # comment on the command line or the
+	// interactive prompt
 	reader := bufio.NewReader(os.Stdin)
 	args := flag.Args()
+	bufferQuery, partial := parseBuffer(*buffer, *cursor)
 	var query string
-	if len(args) == 0 {
+	switch {
+	case len(args) > 0:
+		query = strings.Join(args, " ")
+	case bufferQuery != "":
+		query = bufferQuery
+	case fix || partial != "":
+		// The query is an optional hint for the command to fix or complete
+	default:
 		fmt.Print("What do you need? ")
 		line, err := reader.ReadString('\n')
 		if err != nil {
@@ -63,144 +113,701 @@ func main() {
 		if query == "" {
 			os.Exit(0)
 		}
-	} else {
-		query = strings.Join(args, " ")
 	}
 
-	// Check claude CLI is available
-	if err := claude.CheckClaudeCLI(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	// Merge the settings files, environment and flags, and ensure claude.md exists
+	settings := loadSettings(flag.CommandLine)
+	cfg := config.Load(settings)
+
+	// Set up the generation backend and check it is usable
+	generator := setupGenerator(cfg)
+
+	// Gather preferences, terminal, build tool and docs context, with secrets redacted
+	redactor := loadRedactor(settings)
+	pc := gatherContext(settings, terminalOptions(settings, *historyCommands, *historyHere), redactor)
+	redactions := pc.redactions
+	// The query may carry secrets too, e.g. a token pasted to ask about
+	query = redactor.Redact(query, redactions)
+
+	// Find the command to fix in the scrollback or shell history
+	var failed *failedCommand
+	if fix {
+		failed = findFailedCommand(*fixCommand, pc.records, redactor, redactions)
+		if failed == nil {
+			fmt.Fprintln(os.Stderr, "Error: could not find the last command. Pass it with --command.")
+			os.Exit(1)
+		}
+		fmt.Printf("Fixing: \033[1m%s\033[0m \033[2m(from %s)\033[0m\n", failed.command, failed.source)
 	}
-
-	// Load config and ensure claude.md exists
-	cfg := config.Load(*model)
-	if err := config.EnsureClaudeMd(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: Could not create claude.md: %v\n", err)
+	if partial != "" {
+		partial = redactor.Redact(partial, redactions)
+		fmt.Printf("Completing: \033[1m%s\033[0m\n", strings.Replace(partial, cursorMarker, "", 1))
 	}
+	reportRedactions("context", redactions)
 
-	// Load claude.md content
-	claudeMdContent, err := config.LoadClaudeMd()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: Could not load claude.md: %v\n", err)
-	}
+	// Load the user's safety rules, creating a commented template on first run
+	safetyRules := loadSafetyRules()
 
-	// Capture terminal context
-	terminalContext, warning, err := terminal.CaptureContext(*contextLines)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	// Load the prompt template, if the user or project customizes it
+	promptTemplate := loadPromptTemplate()
+
+	// Initialize request logger
+	sessionType := logging.TypeGenerate
+	logQuery := query
+	switch {
+	case *script:
+		sessionType = logging.TypeScript
+	case fix:
+		sessionType = logging.TypeFix
+		logQuery = fixQuery(failed, query)
 	}
-	if warning != "" {
-		fmt.Fprintln(os.Stderr, warning)
+	if partial != "" {
+		logQuery = partialQuery(partial, query)
 	}
-
-	// Get tmux info for display
-	tmuxInfo := terminal.GetTmuxInfo()
-
-	// Detect build tools in current directory
-	buildToolsResult := buildtools.Detect(".")
-	buildToolsContext := ""
-	if buildToolsResult != nil {
-		buildToolsContext = buildToolsResult.FormatForPrompt()
+	logger := logging.NewLogger(logQuery, pc.claudeMd, pc.terminal, pc.docs, generator.Provider(), generator.Model(), pc.info, sessionType)
+	interrupts.setLogger(logger)
+	logger.SetPreferences(logClaudeMdFiles(pc.claudeMdFiles), pc.preferences)
+	if settings.Profile != "" {
+		logger.SetProfile(settings.Profile)
 	}
-
-	// Detect documentation files
-	docsResult := docs.Detect(".")
-	docsContext := ""
-	if docsResult != nil {
-		docsContext = docsResult.FormatForPrompt()
+	if redactions.Total() > 0 {
+		logger.SetRedactions(redactions)
 	}
 
-	// Initialize request logger
-	logger := logging.NewLogger(query, claudeMdContent, terminalContext, docsContext, cfg.Model, tmuxInfo)
+	policy := claude.RetryPolicy{
+		Timeout:    *timeout,
+		MaxRetries: *retries,
+		Backoff:    claude.DefaultRetryBackoff,
+	}
 
-	// Interactive loop
+	// Interactive loop. Every rejected command and its feedback is sent with
+	// each new request so refinements build on each other.
 	feedback := ""
+	var history []claude.Turn
+	var lastTruncations []budget.Truncation
 
 	for {
-		// Display generation message with model and tmux context
-		var tmuxContext string
-		if tmuxInfo.InTmux {
-			tmuxContext = fmt.Sprintf("tmux: %s/%s/%s", tmuxInfo.Session, tmuxInfo.Window, tmuxInfo.Pane)
-		} else {
-			tmuxContext = "no tmux context"
+		base := claude.Request{Query: query, History: history, Template: promptTemplate, PartialCommand: partial}
+		switch {
+		case *script:
+			base.Mode = claude.ModeScript
+		case fix:
+			base.Mode = claude.ModeFix
+			base.FailedCommand, base.FailedOutput = failed.command, failed.output
+		}
+		req, truncations := pc.request(base, settings.ContextBudget)
+		if !slices.Equal(truncations, lastTruncations) {
+			lastTruncations = truncations
+			reportTruncations(settings.ContextBudget, truncations)
+			logger.SetTruncations(logTruncations(truncations))
 		}
-		fmt.Printf("\nGenerating command using %s (%s)...\n", cfg.Model, tmuxContext)
 
-		result, err := claude.GenerateCommand(cfg.Model, claudeMdContent, terminalContext, buildToolsContext, docsContext, query, feedback)
+		fmt.Println()
+		spin := startSpinner(fmt.Sprintf("Generating command using %s (%s)", claude.Label(generator), pc.info.Label()))
+
+		ctx, release := interrupts.generationContext()
+		result, err := claude.GenerateWithRetry(ctx, generator, req, policy, spin.update, func(attempt int, err error) {
+			logger.AddFailedIteration(feedback, req.SystemPrompt(), req.UserPrompt(), err.Error())
+			if claude.IsTransient(err) && attempt <= policy.MaxRetries {
+				spin.println(fmt.Sprintf("Attempt %d failed: %v. Retrying...", attempt, err))
+			}
+		})
+		release()
+
 		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				spin.stop("Cancelled")
+				logger.Finalize(logging.StatusQuit, "")
+				os.Exit(130)
+			}
+			spin.stop("Generation failed")
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+
+			// Keep the session alive: let the user retry or try another model
+			if !recoverFromFailure(reader, cfg, &generator, logger) {
+				logger.Finalize(logging.StatusQuit, "")
+				fmt.Println("Exiting without copying.")
+				os.Exit(1)
+			}
+			continue
 		}
+		// The spinner adds the elapsed time
+		summary := fmt.Sprintf("Generated command using %s", claude.Label(generator))
+		if usage := usageSummary(result); usage != "" {
+			summary += fmt.Sprintf(" (%s)", usage)
+		}
+		spin.stop(summary)
 
 		// Log this iteration
-		logger.AddIteration(feedback, result.SystemPrompt, result.UserPrompt,
-			result.RawOutput, result.Response.Command, result.Response.Explanation)
+		response := result.Response
+
+		// Check each alternative locally rather than trusting the model's risk rating alone
+		findings := checkSafety(safetyRules, response)
+		logger.AddIteration(feedback, result.SystemPrompt, result.UserPrompt, modelOutput(result, findings), logUsage(result))
+
+		// Scripts are reviewed step by step
+		if len(response.Steps) > 0 {
+			review := &scriptReview{
+				reader:     reader,
+				interrupts: interrupts,
+				logger:     logger,
+				rules:      safetyRules,
+				redactor:   redactor,
+				redactions: redactions,
+				output:     *output,
+			}
+			turn := review.run(response)
+			feedback = turn.Feedback
+			history = append(history, turn)
+			continue
+		}
 
-		// Display the command and explanation
-		fmt.Println()
-		fmt.Printf("\033[1mCommand:\033[0m %s\n", result.Response.Command)
-		fmt.Println()
-		fmt.Println("\033[1mExplanation:\033[0m")
-		printExplanation(result.Response.Explanation)
-		fmt.Println()
+		// Display the alternatives and let the user pick one with the number keys
+		selected := 0
+		displayResponse(response, findings, selected)
+
+	prompt:
+		for {
+			if len(response.Alternatives) > 1 {
+				fmt.Printf("\033[1m[1-%d]\033[0m select  ", len(response.Alternatives))
+			}
+			fmt.Print("\033[1m[A]\033[0mccept  \033[1m[X]\033[0mecute  \033[1m[R]\033[0meject with feedback  \033[1m[Q]\033[0muit: ")
+
+			key, err := readSingleKey()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\nError reading input: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println() // Move to next line after keypress
+
+			switch {
+			case key >= '1' && key <= '9':
+				n := int(key - '0')
+				if n > len(response.Alternatives) {
+					fmt.Printf("No alternative %d.\n", n)
+					continue
+				}
+				selected = n - 1
+				displayResponse(response, findings, selected)
+
+			case key == 'a' || key == 'A':
+				alt := response.Alternatives[selected]
+				if riskLevel(alt, findings[selected]) == claude.RiskHigh && !confirmHighRisk(reader) {
+					fmt.Println("Not accepted.")
+					continue
+				}
+				logger.SetAccepted(selected+1, alt.Command)
+				logger.Finalize(logging.StatusAccepted, "")
+				deliverCommand(alt.Command, *output)
+				os.Exit(0)
+
+			case key == 'x' || key == 'X':
+				alt := response.Alternatives[selected]
+				if riskLevel(alt, findings[selected]) == claude.RiskHigh && !confirmHighRisk(reader) {
+					fmt.Println("Not executed.")
+					continue
+				}
 
-		// Prompt for action
-		fmt.Print("\033[1m[A]\033[0mccept  \033[1m[R]\033[0meject with feedback  \033[1m[Q]\033[0muit: ")
+				result := runCommand(interrupts, alt.Command)
+				if result == nil {
+					continue
+				}
+
+				// The output is logged and may be sent back to the model
+				redactOutput(redactor, result, redactions, logger)
+				logger.AddExecution(logExecution(alt.Command, result))
+
+				// On failure, offer to send the output back to the model for a fix
+				if result.ExitCode != 0 && offerFix() {
+					feedback = executionFeedback(alt.Command, result)
+					history = append(history, claude.Turn{Command: alt.Command, Feedback: feedback})
+					break prompt
+				}
+				logger.SetAccepted(selected+1, alt.Command)
+				logger.Finalize(logging.StatusExecuted, "")
+				os.Exit(0)
+
+			case key == 'q' || key == 'Q':
+				logger.Finalize(logging.StatusQuit, "")
+				fmt.Println("Exiting without copying.")
+				os.Exit(0)
+
+			case key == 'r' || key == 'R':
+				// Get feedback using normal buffered input
+				fmt.Print("Enter feedback: ")
+				feedback, err = reader.ReadString('\n')
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error reading feedback: %v\n", err)
+					os.Exit(1)
+				}
+				feedback = strings.TrimSpace(feedback)
+				if feedback == "" {
+					fmt.Println("No feedback provided, please try again.")
+					continue
+				}
+				feedback = redactFeedback(redactor, feedback, redactions, logger)
+				// Regenerate with the new feedback
+				history = append(history, claude.Turn{Command: response.Alternatives[selected].Command, Feedback: feedback})
+				break prompt
+
+			case key == 3: // Ctrl+C
+				logger.Finalize(logging.StatusQuit, "")
+				fmt.Println("^C")
+				os.Exit(0)
+
+			default:
+				fmt.Println("Invalid option. Please enter A, X, R, or Q.")
+			}
+		}
+	}
+}
+
+// runCommand runs command in the user's shell with its output streamed to the
+// terminal, then prints the exit code. It returns nil if the shell could not be started.
+func runCommand(interrupts *interruptHandler, command string) *execute.Result {
+	fmt.Printf("\033[2mRunning with %s...\033[0m\n", execute.Shell())
+
+	// Ctrl+C goes to the command, not to cmd
+	restore := interrupts.ignore()
+	result, err := execute.Run(context.Background(), command, os.Stdout, os.Stderr)
+	restore()
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return nil
+	}
+
+	if result.ExitCode == 0 {
+		fmt.Printf("\033[32m✓ Exit code 0\033[0m \033[2m(%.1fs)\033[0m\n", result.Duration.Seconds())
+	} else {
+		fmt.Printf("\033[31m✗ Exit code %d\033[0m \033[2m(%.1fs)\033[0m\n", result.ExitCode, result.Duration.Seconds())
+	}
+	return result
+}
+
+// deliverCommand writes an accepted command to the --output file, or copies it to the clipboard
+func deliverCommand(command, output string) {
+	if output != "" {
+		if err := os.WriteFile(output, []byte(command), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing to %s: %v\n", output, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := clipboard.Copy(command); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not copy to clipboard: %v\n", err)
+		fmt.Printf("Command: %s\n", command)
+	} else {
+		fmt.Println("Command copied to clipboard!")
+	}
+}
+
+// redactOutput removes secrets from a command's output before it is logged or
+// sent back to the model, adding them to the session's redaction counts
+func redactOutput(redactor *redact.Redactor, result *execute.Result, redactions redact.Counts, logger *logging.Logger) {
+	found := redact.Counts{}
+	result.Output = redactor.Redact(result.Output, found)
+	result.Stderr = redactor.Redact(result.Stderr, found)
+	if found.Total() > 0 {
+		reportRedactions("command output", found)
+		redactions.Add(found)
+		logger.SetRedactions(redactions)
+	}
+}
+
+// redactFeedback removes secrets from feedback the user typed before it is
+// logged or sent to the model, adding them to the session's redaction counts
+func redactFeedback(redactor *redact.Redactor, feedback string, redactions redact.Counts, logger *logging.Logger) string {
+	found := redact.Counts{}
+	feedback = redactor.Redact(feedback, found)
+	if found.Total() > 0 {
+		reportRedactions("feedback", found)
+		redactions.Add(found)
+		logger.SetRedactions(redactions)
+	}
+	return feedback
+}
+
+// logExecution converts the result of running command into its log representation
+func logExecution(command string, result *execute.Result) logging.Execution {
+	return logging.Execution{
+		Command:    command,
+		ExitCode:   result.ExitCode,
+		Output:     result.Output,
+		Stderr:     result.Stderr,
+		DurationMs: result.Duration.Milliseconds(),
+	}
+}
+
+// offerFix asks whether to feed a failed command's output back to the model
+func offerFix() bool {
+	for {
+		fmt.Print("\033[1m[F]\033[0mix using the output  \033[1m[Q]\033[0muit: ")
 
 		key, err := readSingleKey()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "\nError reading input: %v\n", err)
-			os.Exit(1)
+			return false
 		}
-		fmt.Println() // Move to next line after keypress
+		fmt.Println()
 
 		switch key {
-		case 'a', 'A':
-			logger.Finalize(logging.StatusAccepted, "")
-			if *output != "" {
-				if err := os.WriteFile(*output, []byte(result.Response.Command), 0644); err != nil {
-					fmt.Fprintf(os.Stderr, "Error writing to %s: %v\n", *output, err)
-					os.Exit(1)
-				}
-			} else {
-				// Copy to clipboard
-				if err := clipboard.Copy(result.Response.Command); err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: Could not copy to clipboard: %v\n", err)
-					fmt.Printf("Command: %s\n", result.Response.Command)
-				} else {
-					fmt.Println("Command copied to clipboard!")
-				}
+		case 'f', 'F':
+			return true
+		case 'q', 'Q', 3: // 3 = Ctrl+C
+			return false
+		default:
+			fmt.Println("Invalid option. Please enter F or Q.")
+		}
+	}
+}
+
+// executionFeedback describes a failed run as feedback for the next generation
+func executionFeedback(command string, result *execute.Result) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Running `%s` failed with exit code %d.", command, result.ExitCode)
+	if output := strings.TrimSpace(result.Output); output != "" {
+		sb.WriteString(" Output:\n")
+		sb.WriteString(output)
+	}
+	sb.WriteString("\nFix the command.")
+	return sb.String()
+}
+
+// reportTruncations tells the user which context sources were trimmed to fit the budget
+func reportTruncations(limit int, truncations []budget.Truncation) {
+	if len(truncations) == 0 {
+		return
+	}
+	parts := make([]string, len(truncations))
+	for i, t := range truncations {
+		parts[i] = fmt.Sprintf("%s (dropped %d lines, ~%d of %d tokens kept)", t.Source, t.DroppedLines, t.KeptTokens, t.Tokens)
+	}
+	fmt.Printf("\033[2mContext trimmed to fit the %d token budget: %s\033[0m\n", limit, strings.Join(parts, ", "))
+}
+
+// logTruncations converts truncations into their log representation
+func logTruncations(truncations []budget.Truncation) []logging.Truncation {
+	var logged []logging.Truncation
+	for _, t := range truncations {
+		logged = append(logged, logging.Truncation{
+			Source:       t.Source,
+			Tokens:       t.Tokens,
+			KeptTokens:   t.KeptTokens,
+			DroppedLines: t.DroppedLines,
+		})
+	}
+	return logged
+}
+
+// logClaudeMdFiles converts the claude.md files to their log form
+func logClaudeMdFiles(files []config.ClaudeMdFile) []logging.ClaudeMdFile {
+	var logged []logging.ClaudeMdFile
+	for _, f := range files {
+		logged = append(logged, logging.ClaudeMdFile{Path: f.Path, Content: f.Content})
+	}
+	return logged
+}
+
+// checkSafety runs the local safety checks on every alternative
+func checkSafety(rules *safety.Rules, response *claude.Response) [][]safety.Finding {
+	findings := make([][]safety.Finding, len(response.Alternatives))
+	for i, alt := range response.Alternatives {
+		findings[i] = rules.Check(alt.Command)
+	}
+	return findings
+}
+
+// riskLevel combines the model's risk rating with the local safety findings
+func riskLevel(alt claude.Alternative, findings []safety.Finding) string {
+	switch {
+	case alt.Risk == claude.RiskHigh || safety.Highest(findings) == safety.SeverityHigh:
+		return claude.RiskHigh
+	case alt.Risk == claude.RiskMedium || len(findings) > 0:
+		return claude.RiskMedium
+	default:
+		return alt.Risk
+	}
+}
+
+// modelOutput converts a generation result and its safety findings into their log representation
+func modelOutput(result *claude.GenerateResult, findings [][]safety.Finding) logging.ModelOutput {
+	output := logging.ModelOutput{
+		RawResponse: result.RawOutput,
+		Command:     result.Response.Command,
+		Explanation: result.Response.Explanation,
+	}
+	for i, alt := range result.Response.Alternatives {
+		logged := logging.Alternative{
+			Command:     alt.Command,
+			Explanation: alt.Explanation,
+			Tradeoff:    alt.Tradeoff,
+			Risk:        alt.Risk,
+			RiskReasons: alt.RiskReasons,
+		}
+		logged.Findings = logFindings(findings[i])
+		output.Alternatives = append(output.Alternatives, logged)
+	}
+	return output
+}
+
+// logFindings converts safety findings into their log representation
+func logFindings(findings []safety.Finding) []logging.Finding {
+	var logged []logging.Finding
+	for _, f := range findings {
+		logged = append(logged, logging.Finding{Rule: f.Rule, Severity: f.Severity, Message: f.Message})
+	}
+	return logged
+}
+
+// logUsage converts the usage of a generation into its log representation
+func logUsage(result *claude.GenerateResult) logging.Usage {
+	return logging.Usage{
+		InputTokens:      result.Usage.InputTokens,
+		OutputTokens:     result.Usage.OutputTokens,
+		CacheReadTokens:  result.Usage.CacheReadTokens,
+		CacheWriteTokens: result.Usage.CacheWriteTokens,
+		CostUSD:          result.Usage.CostUSD,
+		CostEstimated:    result.Usage.CostEstimated,
+		DurationMs:       result.Duration.Milliseconds(),
+	}
+}
+
+// usageSummary describes the tokens and cost of a generation, e.g. "3412 tokens, $0.0123",
+// or "" if the backend reported neither
+func usageSummary(result *claude.GenerateResult) string {
+	var parts []string
+	if tokens := result.Usage.Tokens(); tokens > 0 {
+		parts = append(parts, fmt.Sprintf("%d tokens", tokens))
+	}
+	if result.Usage.CostUSD > 0 {
+		parts = append(parts, fmt.Sprintf("$%.4f", result.Usage.CostUSD))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// displayResponse prints the list of alternatives (if there is more than one)
+// followed by the selected command and its explanation
+func displayResponse(response *claude.Response, findings [][]safety.Finding, selected int) {
+	fmt.Println()
+	if len(response.Alternatives) > 1 {
+		fmt.Println("\033[1mAlternatives:\033[0m")
+		for i, alt := range response.Alternatives {
+			marker := " "
+			if i == selected {
+				marker = ">"
 			}
-			os.Exit(0)
+			fmt.Printf("%s %d. %s%s\n", marker, i+1, alt.Command, riskTag(riskLevel(alt, findings[i])))
+			if alt.Tradeoff != "" {
+				fmt.Printf("     \033[2m%s\033[0m\n", alt.Tradeoff)
+			}
+		}
+		fmt.Println()
+	}
 
-		case 'q', 'Q':
-			logger.Finalize(logging.StatusQuit, "")
-			fmt.Println("Exiting without copying.")
-			os.Exit(0)
+	alt := response.Alternatives[selected]
+	fmt.Printf("\033[1mCommand:\033[0m %s\n", alt.Command)
+	fmt.Println()
+	fmt.Println("\033[1mExplanation:\033[0m")
+	printExplanation(alt.Explanation)
+	fmt.Println()
+	printRisk(alt, findings[selected])
+}
+
+// riskTag returns a short colored label for medium and high risk commands
+func riskTag(risk string) string {
+	switch risk {
+	case claude.RiskHigh:
+		return "  \033[31m[high risk]\033[0m"
+	case claude.RiskMedium:
+		return "  \033[33m[medium risk]\033[0m"
+	default:
+		return ""
+	}
+}
+
+// printRisk shows a warning banner for medium and high risk commands, with
+// the model's reasons followed by the local safety findings
+func printRisk(alt claude.Alternative, findings []safety.Finding) {
+	var color, title string
+	switch riskLevel(alt, findings) {
+	case claude.RiskHigh:
+		color, title = "31", "HIGH RISK"
+	case claude.RiskMedium:
+		color, title = "33", "Medium risk"
+	default:
+		return
+	}
+
+	fmt.Printf("\033[1;%sm⚠ %s\033[0m\n", color, title)
+	for _, reason := range alt.RiskReasons {
+		fmt.Printf("\033[%sm  • %s\033[0m\n", color, reason)
+	}
+	for _, f := range findings {
+		fmt.Printf("\033[%sm  • %s\033[0m \033[2m[%s]\033[0m\n", color, f.Message, f.Rule)
+	}
+	fmt.Println()
+}
+
+// confirmHighRisk asks the user to type "yes" before accepting a high-risk command
+func confirmHighRisk(reader *bufio.Reader) bool {
+	fmt.Print("This command is high risk. Type \"yes\" to accept: ")
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(line), "yes")
+}
+
+// loadRedactor builds the secret redactor from ~/.config/cmd/redact.toml and
+// the [redact] tables of the settings files, where only cmd.toml can disable
+// patterns (see config.LoadSettings). Problems are reported as
+// warnings and only the built-in patterns are used.
+func loadRedactor(settings *config.Settings) *redact.Redactor {
+	builtin, _ := redact.New(nil)
+
+	cfg := &redact.Config{}
+	if path, err := config.GetRedactConfigPath(); err == nil {
+		if err := config.EnsureFile(path, redact.DefaultConfigFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not create %s: %v\n", config.RedactConfigName, err)
+		}
+		cfg, err = redact.LoadConfig(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Could not load redaction settings: %v\n", err)
+			return builtin
+		}
+	}
+
+	cfg.Disabled = append(cfg.Disabled, settings.Redact.Disabled...)
+	cfg.Patterns = append(cfg.Patterns, settings.Redact.Patterns...)
+	redactor, err := redact.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Invalid redaction pattern in %s or %s: %v\n", config.RedactConfigName, config.SettingsName, err)
+		return builtin
+	}
+	return redactor
+}
+
+// reportRedactions tells the user how many secrets were removed from source
+func reportRedactions(source string, counts redact.Counts) {
+	if counts.Total() == 0 {
+		return
+	}
+	noun := "secrets"
+	if counts.Total() == 1 {
+		noun = "secret"
+	}
+	fmt.Printf("\033[2mRedacted %d %s from %s (%s)\033[0m\n", counts.Total(), noun, source, counts)
+}
+
+// loadPromptTemplate layers ~/.config/cmd/prompt.tmpl and the project's
+// .cmd/prompt.tmpl over the built-in prompt. Problems are reported as warnings
+// and the built-in prompt is used.
+func loadPromptTemplate() *claude.Template {
+	var paths []string
+	if path, err := config.GetPromptTemplatePath(); err == nil {
+		paths = append(paths, path)
+	}
+	if path := config.FindProjectFile(config.PromptTemplateName); path != "" {
+		paths = append(paths, path)
+	}
 
+	tmpl, err := claude.LoadTemplate(paths...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not load prompt template, using the default: %v\n", err)
+	}
+	return tmpl
+}
+
+// loadSafetyRules reads ~/.config/cmd/safety.toml. Problems are reported as
+// warnings and the built-in rules are used.
+func loadSafetyRules() *safety.Rules {
+	path, err := config.GetSafetyRulesPath()
+	if err != nil {
+		return nil
+	}
+	if err := config.EnsureFile(path, safety.DefaultRulesFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not create %s: %v\n", config.SafetyRulesName, err)
+	}
+
+	rules, err := safety.LoadRules(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Could not load safety rules: %v\n", err)
+	}
+	return rules
+}
+
+// setupGenerator returns the configured generation backend, exiting if it can't be used
+func setupGenerator(cfg *config.Config) claude.Generator {
+	generator, err := claude.NewGenerator(cfg.Provider, cfg.Model, generatorOptions(cfg))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := generator.Check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return generator
+}
+
+// generatorOptions returns the backend settings from the config
+func generatorOptions(cfg *config.Config) claude.Options {
+	return claude.Options{
+		AnthropicAPIKey:  cfg.AnthropicAPIKey,
+		AnthropicBaseURL: cfg.AnthropicBaseURL,
+		OpenAIAPIKey:     cfg.OpenAIAPIKey,
+		OpenAIBaseURL:    cfg.OpenAIBaseURL,
+		OllamaHost:       cfg.OllamaHost,
+	}
+}
+
+// recoverFromFailure asks whether to retry, switch model or quit after generation
+// has failed. It returns false if the user chose to quit.
+func recoverFromFailure(reader *bufio.Reader, cfg *config.Config, generator *claude.Generator, logger *logging.Logger) bool {
+	for {
+		fmt.Print("\033[1m[R]\033[0metry  \033[1m[M]\033[0model switch  \033[1m[Q]\033[0muit: ")
+
+		key, err := readSingleKey()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nError reading input: %v\n", err)
+			return false
+		}
+		fmt.Println()
+
+		switch key {
 		case 'r', 'R':
-			// Get feedback using normal buffered input
-			fmt.Print("Enter feedback: ")
-			feedback, err = reader.ReadString('\n')
+			return true
+
+		case 'm', 'M':
+			fmt.Print("Model (e.g. sonnet, ollama:qwen2.5-coder): ")
+			line, err := reader.ReadString('\n')
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error reading feedback: %v\n", err)
-				os.Exit(1)
+				return false
 			}
-			feedback = strings.TrimSpace(feedback)
-			if feedback == "" {
-				fmt.Println("No feedback provided, please try again.")
+			spec := strings.TrimSpace(line)
+			if spec == "" {
 				continue
 			}
-			// Loop continues with new feedback
 
-		case 3: // Ctrl+C
-			logger.Finalize(logging.StatusQuit, "")
-			fmt.Println("^C")
-			os.Exit(0)
+			g, err := claude.NewGenerator(cfg.Provider, spec, generatorOptions(cfg))
+			if err == nil {
+				err = g.Check()
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				continue
+			}
+			*generator = g
+			logger.SetModel(g.Provider(), g.Model())
+			return true
+
+		case 'q', 'Q', 3: // 3 = Ctrl+C
+			return false
 
 		default:
-			fmt.Println("Invalid option. Please enter A, R, or Q.")
+			fmt.Println("Invalid option. Please enter R, M, or Q.")
 		}
 	}
 }
@@ -211,28 +818,70 @@ func printUsage() {
 	fmt.Println("Usage:")
 	fmt.Println("  cmd [options] [query]")
 	fmt.Println("  cmd --logs")
+	fmt.Println("  cmd explain [options] [<command>]")
+	fmt.Println("  cmd fix [options] [hint]")
+	fmt.Println("  cmd stats [--days <n>]")
+	fmt.Println("  cmd init <fish|zsh|bash>")
+	fmt.Println("  cmd config show [options]")
+	fmt.Println("  cmd prompt [--render [--script] <query> | --default]")
 	fmt.Println()
 	fmt.Println("If no query is provided, an interactive prompt is shown.")
 	fmt.Println()
 	fmt.Println("Options:")
-	fmt.Println("  --model <model>       Claude model to use (default: opus)")
+	fmt.Println("  --profile <name>      Settings profile from cmd.toml to use (default: $CMD_PROFILE)")
+	fmt.Println("  --model <model>       Model to use (default: opus); prefix with provider: to switch backend")
+	fmt.Println("  --provider <name>     Generation backend: cli (default, or $CMD_PROVIDER), anthropic, openai, ollama")
 	fmt.Println("  --context-lines <n>   Number of tmux scrollback lines to capture (default: 100)")
+	fmt.Println("  --history-commands <n>")
+	fmt.Println("                        Shell history commands to include when not in tmux (default: 50)")
+	fmt.Println("  --history-here        Only include history commands that refer to files in the current directory")
 	fmt.Println("  --output <file>       Write accepted command to file instead of clipboard")
+	fmt.Println("  --timeout <duration>  Maximum time per generation attempt (default: 2m)")
+	fmt.Println("  --retries <n>         Retries for transient generation failures (default: 2)")
+	fmt.Println("  --context-budget <n>  Estimated token limit for the prompt, 0 for unlimited (default: 8000)")
+	fmt.Println("  --script              Generate a multi-step script to review, save or run step by step")
+	fmt.Println("  --buffer <text>       Command line typed so far, passed by the shell integration: a partial")
+	fmt.Println("                        command to complete, or a # comment to use as the query")
+	fmt.Println("  --cursor <n>          Cursor position in --buffer, in characters (default: the end)")
+	fmt.Println("  --command <cmd>       With fix: the command to fix (default: last in tmux scrollback or shell history)")
 	fmt.Println("  --logs                Launch log viewer")
 	fmt.Println("  --help                Show this help message")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  cmd \"find all large files modified today\"")
 	fmt.Println("  cmd --model sonnet \"compress all images in current directory\"")
+	fmt.Println("  cmd --model ollama:qwen2.5-coder \"list listening ports\"")
+	fmt.Println("  cmd --profile thorough \"why is this build slow\"")
 	fmt.Println("  cmd --output /tmp/cmd.txt")
+	fmt.Println("  cmd --script \"set up a python venv, install deps and run tests\"")
 	fmt.Println("  cmd --logs")
+	fmt.Println("  cmd explain 'tar -xzvf archive.tar.gz -C /tmp'")
+	fmt.Println("  cmd fix \"it should only push the current branch\"")
+	fmt.Println("  cmd stats --days 7")
+	fmt.Println("  cmd config show")
 	fmt.Println()
-	fmt.Println("Shell integration:")
-	fmt.Println("  Fish: Press Ctrl+G to generate a command directly on your prompt")
-	fmt.Println("  Install: mise run install (includes fish integration)")
+	fmt.Println("Shell integration (fish, zsh, bash):")
+	fmt.Println("  Press Ctrl+G to generate a command directly on your prompt, or to complete the one you've typed")
+	fmt.Println("  Press Alt+E to explain the command on your prompt")
+	fmt.Println("  Press Alt+G to fix the last command")
+	fmt.Println("  Install: cmd init <shell> prints the script to source from your shell's startup file")
 	fmt.Println()
 	fmt.Println("Configuration:")
+	fmt.Println("  ~/.config/cmd/cmd.toml  - Default model, provider, context and redaction settings")
+	fmt.Println("                            (also .cmd.toml per project, up to the repository root)")
 	fmt.Println("  ~/.config/cmd/claude.md - Customize command generation preferences")
+	fmt.Println("                            (also .cmd/claude.md per project, added after it)")
+	fmt.Println("  ~/.config/cmd/safety.toml - Disable or add safety checks")
+	fmt.Println("  ~/.config/cmd/redact.toml - Disable or add secret redaction patterns")
+	fmt.Println("  ~/.config/cmd/prompt.tmpl - Customize the prompt (also .cmd/prompt.tmpl per project)")
+	fmt.Println("  CMD_PROFILE             - Settings profile to use when --profile isn't given")
+	fmt.Println("  CMD_MODEL, CMD_PROVIDER - Override the model and provider from cmd.toml")
+	fmt.Println("  CMD_LAST_STATUS         - Exit status of the last command (set by the shell integrations)")
+	fmt.Println("  ANTHROPIC_API_KEY       - API key for the anthropic provider")
+	fmt.Println("  ANTHROPIC_BASE_URL      - Override the Messages API endpoint")
+	fmt.Println("  OPENAI_API_KEY          - API key for the openai provider")
+	fmt.Println("  OPENAI_BASE_URL         - OpenAI-compatible endpoint (e.g. http://localhost:8080/v1)")
+	fmt.Println("  OLLAMA_HOST             - Ollama server (default: http://localhost:11434)")
 }
 
 func printExplanation(explanation string) {
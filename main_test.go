@@ -0,0 +1,1065 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/jerryluo/cmd/internal/logging"
+)
+
+// These tests drive the interactive accept/reject/quit loop end-to-end: the
+// binary runs against the scripted backend with its stdin/stdout attached to a
+// pseudo-terminal, keystrokes are typed into the pty, and the resulting
+// SessionLog is read back from the temporary HOME.
+
+var (
+	buildOnce sync.Once
+	binPath   string
+	buildErr  error
+)
+
+// buildBinary compiles the cmd binary once per test run
+func buildBinary(t *testing.T) string {
+	t.Helper()
+	buildOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "cmd-e2e")
+		if err != nil {
+			buildErr = err
+			return
+		}
+		binPath = filepath.Join(dir, "cmd")
+		out, err := exec.Command("go", "build", "-tags", "fixture", "-o", binPath, ".").CombinedOutput()
+		if err != nil {
+			buildErr = fmt.Errorf("go build failed: %v\n%s", err, out)
+		}
+	})
+	if buildErr != nil {
+		t.Fatal(buildErr)
+	}
+	return binPath
+}
+
+// openPTY opens a new pseudo-terminal pair
+func openPTY() (master, slave *os.File, err error) {
+	m, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := unix.IoctlSetPointerInt(int(m.Fd()), unix.TIOCSPTLCK, 0); err != nil {
+		m.Close()
+		return nil, nil, fmt.Errorf("unlockpt: %w", err)
+	}
+	n, err := unix.IoctlGetInt(int(m.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		m.Close()
+		return nil, nil, fmt.Errorf("ptsname: %w", err)
+	}
+	s, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		m.Close()
+		return nil, nil, err
+	}
+	return m, s, nil
+}
+
+// session is a running cmd process attached to a pty
+type session struct {
+	t      *testing.T
+	cmd    *exec.Cmd
+	master *os.File
+	home   string
+
+	mu     sync.Mutex
+	output bytes.Buffer
+	seen   int
+	done   chan struct{}
+}
+
+// startSession runs cmd with the given scripted fixture and arguments
+func startSession(t *testing.T, fixture string, args ...string) *session {
+	t.Helper()
+	return startSessionIn(t, t.TempDir(), fixture, args...)
+}
+
+// startSessionIn is startSession with a prepared home directory, which is also the working directory
+func startSessionIn(t *testing.T, home, fixture string, args ...string) *session {
+	t.Helper()
+	return startSessionEnv(t, home, nil, fixture, args...)
+}
+
+// startSessionEnv is startSessionIn with extra environment variables. A
+// leading "fix" subcommand stays ahead of the --model flag.
+func startSessionEnv(t *testing.T, home string, env []string, fixture string, args ...string) *session {
+	t.Helper()
+	bin := buildBinary(t)
+
+	master, slave, err := openPTY()
+	if err != nil {
+		t.Skipf("pseudo-terminals unavailable: %v", err)
+	}
+
+	fixturePath := filepath.Join(home, "fixture.json")
+	if err := os.WriteFile(fixturePath, []byte(fixture), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var subcommand []string
+	if len(args) > 0 && args[0] == "fix" {
+		subcommand, args = args[:1], args[1:]
+	}
+	cmd := exec.Command(bin, slices.Concat(subcommand, []string{"--model", "fixture:" + fixturePath}, args)...)
+	cmd.Dir = home
+	cmd.Env = append([]string{"HOME=" + home, "PATH=" + os.Getenv("PATH"), "TERM=xterm"}, env...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = &unix.SysProcAttr{Setsid: true, Setctty: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	slave.Close()
+
+	s := &session{t: t, cmd: cmd, master: master, home: home, done: make(chan struct{})}
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := master.Read(buf)
+			s.mu.Lock()
+			s.output.Write(buf[:n])
+			s.mu.Unlock()
+			answerQueries(master, buf[:n])
+			if err != nil {
+				close(s.done)
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		master.Close()
+	})
+	return s
+}
+
+// answerQueries replies to the terminal capability queries lipgloss sends on
+// startup, as a real terminal would, so the program doesn't wait for them to time out
+func answerQueries(master *os.File, chunk []byte) {
+	if bytes.Contains(chunk, []byte("\x1b]11;?")) {
+		master.Write([]byte("\x1b]11;rgb:0000/0000/0000\x1b\\"))
+	}
+	if bytes.Contains(chunk, []byte("\x1b[6n")) {
+		master.Write([]byte("\x1b[1;1R"))
+	}
+}
+
+// expect waits until text appears in output not yet consumed by a previous expect
+func (s *session) expect(text string) {
+	s.t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		out := s.output.String()
+		if idx := strings.Index(out[s.seen:], text); idx >= 0 {
+			s.seen += idx + len(text)
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.t.Fatalf("timed out waiting for %q; output so far:\n%s", text, s.output.String())
+}
+
+// send types keystrokes into the terminal
+func (s *session) send(keys string) {
+	s.t.Helper()
+	if _, err := s.master.Write([]byte(keys)); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// wait waits for the process to exit and returns its exit code
+func (s *session) wait() int {
+	s.t.Helper()
+	errc := make(chan error, 1)
+	go func() { errc <- s.cmd.Wait() }()
+	select {
+	case err := <-errc:
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode()
+		}
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		return 0
+	case <-time.After(10 * time.Second):
+		s.t.Fatalf("process did not exit; output so far:\n%s", s.output.String())
+	}
+	return -1
+}
+
+// sessionLog reads the single session log written under the temporary HOME
+func (s *session) sessionLog() *logging.SessionLog {
+	s.t.Helper()
+	logDir := filepath.Join(s.home, ".local", "share", "cmd", "logs")
+	matches, _ := filepath.Glob(filepath.Join(logDir, "*.json"))
+	if len(matches) != 1 {
+		s.t.Fatalf("expected 1 session log in %s, found %d", logDir, len(matches))
+	}
+	data, err := os.ReadFile(matches[0])
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	var log logging.SessionLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		s.t.Fatal(err)
+	}
+	return &log
+}
+
+const twoResponses = `[
+	{"command": "find . -name '*.go'", "explanation": "- find: search files"},
+	{"command": "fd -e go", "explanation": "- fd: faster find"}
+]`
+
+const alternatives = `[
+	{"alternatives": [
+		{"command": "fd -e go", "explanation": "- fd: faster find", "tradeoff": "Fast, respects .gitignore"},
+		{"command": "find . -name '*.go'", "explanation": "- find: search files", "tradeoff": "Available everywhere"}
+	]}
+]`
+
+func TestInteractiveAccept(t *testing.T) {
+	s := startSession(t, twoResponses, "--output", "out.txt", "list go files")
+	s.expect("[Q]")
+	s.send("a")
+	if code := s.wait(); code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+
+	out, err := os.ReadFile(filepath.Join(s.home, "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "find . -name '*.go'" {
+		t.Errorf("output file = %q", out)
+	}
+
+	log := s.sessionLog()
+	if log.Metadata.FinalStatus != logging.StatusAccepted {
+		t.Errorf("FinalStatus = %q, want accepted", log.Metadata.FinalStatus)
+	}
+	if log.UserQuery != "list go files" || len(log.Iterations) != 1 {
+		t.Errorf("unexpected log: query=%q iterations=%d", log.UserQuery, len(log.Iterations))
+	}
+}
+
+func TestUsageAndStats(t *testing.T) {
+	const fixture = `[
+		{"command": "ls", "explanation": "- ls: list", "usage": {"input_tokens": 1200, "output_tokens": 80, "cost_usd": 0.0125}}
+	]`
+	s := startSession(t, fixture, "--output", "out.txt", "list files")
+	s.expect("1280 tokens, $0.0125")
+	s.expect("[Q]")
+	s.send("a")
+	s.wait()
+
+	usage := s.sessionLog().Iterations[0].Usage
+	if usage == nil || usage.InputTokens != 1200 || usage.OutputTokens != 80 || usage.CostUSD != 0.0125 {
+		t.Fatalf("Usage = %+v", usage)
+	}
+
+	cmd := exec.Command(buildBinary(t), "stats")
+	cmd.Env = []string{"HOME=" + s.home}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("cmd stats failed: %v\n%s", err, out)
+	}
+	for _, want := range []string{"fixture:", "100%", "1200", "$0.0125"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("stats output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestInit(t *testing.T) {
+	for _, shell := range []string{"fish", "zsh", "bash"} {
+		out, err := exec.Command(buildBinary(t), "init", shell).Output()
+		if err != nil {
+			t.Fatalf("cmd init %s failed: %v", shell, err)
+		}
+		want, err := os.ReadFile(filepath.Join("shell", "cmd."+shell))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != string(want) {
+			t.Errorf("cmd init %s printed:\n%s", shell, out)
+		}
+
+		// Check the script parses, where the shell is installed
+		if path, err := exec.LookPath(shell); err == nil {
+			check := exec.Command(path, "-n")
+			check.Stdin = bytes.NewReader(out)
+			if out, err := check.CombinedOutput(); err != nil {
+				t.Errorf("%s -n: %v\n%s", shell, err, out)
+			}
+		}
+	}
+
+	err := exec.Command(buildBinary(t), "init", "tcsh").Run()
+	if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != 2 {
+		t.Errorf("cmd init tcsh: %v, want exit code 2", err)
+	}
+}
+
+func TestPromptTemplate(t *testing.T) {
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, ".cmd"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := `{{define "user"}}Project task: {{.Query}}{{end}}`
+	if err := os.WriteFile(filepath.Join(home, ".cmd", "prompt.tmpl"), []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(buildBinary(t), "prompt", "--render", "list", "files")
+	cmd.Dir = home
+	cmd.Env = []string{"HOME=" + home}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("cmd prompt failed: %v\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "=== User prompt ===\nProject task: list files\n") {
+		t.Errorf("rendered prompt does not use the project template:\n%s", out)
+	}
+	if !strings.Contains(string(out), "You are a CLI command generator") {
+		t.Errorf("system prompt should fall back to the built-in template:\n%s", out)
+	}
+	if strings.Contains(string(out), "matching this JSON schema") {
+		t.Errorf("the cli backend's prompt should not carry the JSON mode instructions:\n%s", out)
+	}
+
+	// Backends in JSON mode append the schema to the system prompt
+	cmd = exec.Command(buildBinary(t), "prompt", "--render", "--model", "ollama:qwen2.5-coder", "list", "files")
+	cmd.Dir = home
+	cmd.Env = []string{"HOME=" + home}
+	out, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("cmd prompt --model failed: %v\n%s", err, out)
+	}
+	for _, want := range []string{"Prompts for qwen2.5-coder (ollama)", "Respond with a single JSON object matching this JSON schema"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("rendered ollama prompt missing %q:\n%s", want, out)
+		}
+	}
+
+	// The same template is used for generation
+	s := startSessionIn(t, home, twoResponses, "--output", "out.txt", "list files")
+	s.expect("[Q]")
+	s.send("q")
+	s.wait()
+	if prompt := s.sessionLog().Iterations[0].ModelInput.UserPrompt; prompt != "Project task: list files" {
+		t.Errorf("UserPrompt = %q", prompt)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	home := t.TempDir()
+	fixture := filepath.Join(home, "fixture.json")
+	explanation := `{"summary": "Deletes the build directory", "risk": "high", "risk_reasons": ["deletes files recursively"], "parts": [
+		{"text": "rm", "explanation": "remove files"},
+		{"text": "-rf", "explanation": "recursively, without asking"},
+		{"text": "build", "explanation": "the build output directory"}
+	]}`
+	if err := os.WriteFile(fixture, []byte("["+explanation+"]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The command comes from the arguments, or from stdin as the fish binding sends it
+	run := func(stdin string, args ...string) string {
+		cmd := exec.Command(buildBinary(t), append([]string{"explain", "--model", "fixture:" + fixture}, args...)...)
+		cmd.Dir = home
+		cmd.Env = []string{"HOME=" + home, "PATH=" + os.Getenv("PATH")}
+		cmd.Stdin = strings.NewReader(stdin)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("cmd explain failed: %v\n%s", err, out)
+		}
+		return string(out)
+	}
+	for _, out := range []string{run("", "rm -rf build"), run("rm -rf build\n")} {
+		for _, want := range []string{"Command:\033[0m rm -rf build", "Deletes the build directory", "-rf", "recursively, without asking", "HIGH RISK", "deletes files recursively"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("explain output missing %q:\n%s", want, out)
+			}
+		}
+	}
+
+	logs, err := filepath.Glob(filepath.Join(home, ".local", "share", "cmd", "logs", "*.json"))
+	if err != nil || len(logs) == 0 {
+		t.Fatalf("no session logs: %v", err)
+	}
+	data, err := os.ReadFile(logs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log logging.SessionLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Type() != logging.TypeExplain || log.Metadata.FinalStatus != logging.StatusExplained {
+		t.Errorf("metadata = %+v", log.Metadata)
+	}
+	output := log.Iterations[0].ModelOutput
+	if output.Command != "rm -rf build" || len(output.Parts) != 3 || output.Risk != "high" {
+		t.Errorf("model output = %+v", output)
+	}
+	if !strings.Contains(log.Iterations[0].ModelInput.UserPrompt, "Command to explain: rm -rf build") {
+		t.Errorf("user prompt = %q", log.Iterations[0].ModelInput.UserPrompt)
+	}
+}
+
+func TestFix(t *testing.T) {
+	fixture := `[{"command": "git status", "explanation": "- gti was a typo for git"}]`
+
+	// The fish binding passes the last command; the output isn't in a scrollback here
+	s := startSession(t, fixture, "fix", "--output", "out.txt", "--command", "gti status")
+	s.expect("Fixing:")
+	s.expect("[Q]")
+	s.send("a")
+	if code := s.wait(); code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+	if out, err := os.ReadFile(filepath.Join(s.home, "out.txt")); err != nil || string(out) != "git status" {
+		t.Errorf("output file = %q, %v", out, err)
+	}
+
+	log := s.sessionLog()
+	if log.Type() != logging.TypeFix || log.UserQuery != "fix: gti status" {
+		t.Errorf("type = %q, query = %q", log.Type(), log.UserQuery)
+	}
+	user := log.Iterations[0].ModelInput.UserPrompt
+	if !strings.Contains(user, "Failed command: gti status") || !strings.Contains(user, "output was not captured") {
+		t.Errorf("user prompt = %q", user)
+	}
+
+	// Without --command or tmux, the last command comes from the shell history,
+	// skipping runs of cmd itself
+	home := t.TempDir()
+	if err := os.WriteFile(filepath.Join(home, ".bash_history"), []byte("ls\nmake buidl\ncmd fix\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s = startSessionEnv(t, home, []string{"SHELL=/bin/bash"}, fixture, "fix", "the target is build")
+	s.expect("make buidl")
+	s.expect("[Q]")
+	s.send("q")
+	s.wait()
+
+	log = s.sessionLog()
+	user = log.Iterations[0].ModelInput.UserPrompt
+	if !strings.Contains(user, "Failed command: make buidl") || !strings.Contains(user, "User request: the target is build") {
+		t.Errorf("user prompt = %q", user)
+	}
+}
+
+func TestInteractiveRejectWithFeedback(t *testing.T) {
+	s := startSession(t, twoResponses, "--output", "out.txt", "list go files")
+	s.expect("[Q]")
+	s.send("r")
+	s.expect("Enter feedback: ")
+	s.send("use fd\n")
+	s.expect("fd -e go")
+	s.expect("[Q]")
+	s.send("a")
+	if code := s.wait(); code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+
+	log := s.sessionLog()
+	if len(log.Iterations) != 2 {
+		t.Fatalf("iterations = %d, want 2", len(log.Iterations))
+	}
+	if log.Iterations[1].Feedback != "use fd" {
+		t.Errorf("second iteration feedback = %q, want %q", log.Iterations[1].Feedback, "use fd")
+	}
+	if !strings.Contains(log.Iterations[1].ModelInput.UserPrompt, "use fd") {
+		t.Error("feedback missing from second prompt")
+	}
+	if log.Iterations[1].ModelOutput.Command != "fd -e go" {
+		t.Errorf("second command = %q", log.Iterations[1].ModelOutput.Command)
+	}
+	if prompt := log.Iterations[1].ModelInput.UserPrompt; !strings.Contains(prompt, "1. Command: find . -name '*.go'\n   Feedback: use fd") {
+		t.Errorf("second prompt is missing the history:\n%s", prompt)
+	}
+}
+
+func TestInteractiveSelectAlternative(t *testing.T) {
+	s := startSession(t, alternatives, "--output", "out.txt", "list go files")
+	s.expect("[1-2]")
+	s.send("2")
+	s.expect("find: search files")
+	s.expect("[Q]")
+	s.send("a")
+	if code := s.wait(); code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+
+	out, err := os.ReadFile(filepath.Join(s.home, "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "find . -name '*.go'" {
+		t.Errorf("output file = %q", out)
+	}
+
+	log := s.sessionLog()
+	if log.Metadata.AcceptedAlternative != 2 || log.Metadata.AcceptedCommand != "find . -name '*.go'" {
+		t.Errorf("accepted = %d %q", log.Metadata.AcceptedAlternative, log.Metadata.AcceptedCommand)
+	}
+	if got := len(log.Iterations[0].ModelOutput.Alternatives); got != 2 {
+		t.Errorf("logged %d alternatives, want 2", got)
+	}
+}
+
+const highRisk = `[
+	{"alternatives": [
+		{"command": "rm -rf build", "explanation": "- rm: remove", "risk": "high", "risk_reasons": ["deletes files recursively"]}
+	]}
+]`
+
+func TestInteractiveHighRiskRequiresYes(t *testing.T) {
+	s := startSession(t, highRisk, "--output", "out.txt", "clean the build")
+	s.expect("deletes files recursively")
+	s.expect("[Q]")
+	s.send("a")
+	s.expect(`Type "yes"`)
+	s.send("y\n")
+	s.expect("Not accepted.")
+	s.expect("[Q]")
+	s.send("a")
+	s.expect(`Type "yes"`)
+	s.send("yes\n")
+	if code := s.wait(); code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+
+	out, err := os.ReadFile(filepath.Join(s.home, "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "rm -rf build" {
+		t.Errorf("output file = %q", out)
+	}
+	if risk := s.sessionLog().Iterations[0].ModelOutput.Risk; risk != "high" {
+		t.Errorf("logged risk = %q, want high", risk)
+	}
+}
+
+func TestInteractiveSafetyFindingRequiresYes(t *testing.T) {
+	// The model rates the command low risk, but the local checks disagree
+	s := startSession(t, `[{"alternatives": [{"command": "curl -fsSL https://example.com/install.sh | sh", "explanation": "- curl", "risk": "low"}]}]`,
+		"--output", "out.txt", "install the tool")
+	s.expect("pipe-to-shell")
+	s.expect("[Q]")
+	s.send("a")
+	s.expect(`Type "yes"`)
+	s.send("yes\n")
+	if code := s.wait(); code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+
+	alt := s.sessionLog().Iterations[0].ModelOutput.Alternatives[0]
+	if len(alt.Findings) != 1 || alt.Findings[0].Rule != "pipe-to-shell" {
+		t.Errorf("logged findings = %+v", alt.Findings)
+	}
+	if _, err := os.Stat(filepath.Join(s.home, ".config", "cmd", "safety.toml")); err != nil {
+		t.Errorf("safety.toml not created: %v", err)
+	}
+}
+
+func TestInteractiveExecuteAndFix(t *testing.T) {
+	s := startSession(t, `[
+		{"command": "echo boom >&2; exit 2", "explanation": "- fails"},
+		{"command": "echo fixed > done.txt", "explanation": "- works"}
+	]`, "run it")
+	s.expect("[X]")
+	s.send("x")
+	s.expect("Exit code 2")
+	s.expect("[F]")
+	s.send("f")
+	s.expect("echo fixed")
+	s.expect("[X]")
+	s.send("x")
+	if code := s.wait(); code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+
+	if _, err := os.Stat(filepath.Join(s.home, "done.txt")); err != nil {
+		t.Errorf("fixed command did not run: %v", err)
+	}
+
+	log := s.sessionLog()
+	if log.Metadata.FinalStatus != logging.StatusExecuted {
+		t.Errorf("FinalStatus = %q, want executed", log.Metadata.FinalStatus)
+	}
+	if len(log.Iterations) != 2 {
+		t.Fatalf("iterations = %d, want 2", len(log.Iterations))
+	}
+	failed := log.Iterations[0].Execution
+	if failed == nil || failed.ExitCode != 2 || failed.Stderr != "boom" {
+		t.Errorf("first execution = %+v", failed)
+	}
+	if fb := log.Iterations[1].Feedback; !strings.Contains(fb, "exit code 2") || !strings.Contains(fb, "boom") {
+		t.Errorf("feedback = %q", fb)
+	}
+	if exec := log.Iterations[1].Execution; exec == nil || exec.ExitCode != 0 {
+		t.Errorf("second execution = %+v", exec)
+	}
+}
+
+const threeSteps = `[
+	{"summary": "Create a project layout", "steps": [
+		{"command": "mkdir -p src", "explanation": "- mkdir -p: create src", "risk": "low"},
+		{"command": "touch src/skipped", "explanation": "- touch: not wanted", "risk": "low"},
+		{"command": "echo hi > src/readme", "explanation": "- echo: write a readme", "risk": "medium", "risk_reasons": ["writes a file"]}
+	]}
+]`
+
+func TestScriptSkipEditAndSave(t *testing.T) {
+	s := startSession(t, threeSteps, "--script", "lay out the project")
+	s.expect("Create a project layout")
+	s.expect("[S]")
+	s.send("2")
+	s.expect("(skipped)")
+	s.send("e")
+	s.expect("Edit step")
+	s.send("3")
+	s.expect("New command")
+	s.send("echo edited > src/readme\r")
+	s.expect("(edited)")
+	s.send("s")
+	s.expect("Save script as")
+	s.send("setup.sh\r")
+	s.expect("Script saved to setup.sh")
+	if code := s.wait(); code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.home, "setup.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := string(data)
+	for _, want := range []string{"#!/bin/sh\n# Create a project layout\nset -e\n", "# Step 1\n#   mkdir -p: create src\nmkdir -p src\n", "echo edited > src/readme\n"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q:\n%s", want, script)
+		}
+	}
+	if strings.Contains(script, "touch") {
+		t.Errorf("script should leave out the skipped step:\n%s", script)
+	}
+
+	log := s.sessionLog()
+	if log.Metadata.FinalStatus != logging.StatusAccepted {
+		t.Errorf("FinalStatus = %q, want accepted", log.Metadata.FinalStatus)
+	}
+	steps := log.Iterations[0].ModelOutput.Steps
+	if len(steps) != 3 || !steps[1].Skipped || steps[2].Original != "echo hi > src/readme" || steps[2].Command != "echo edited > src/readme" {
+		t.Errorf("logged steps = %+v", steps)
+	}
+	if log.Iterations[0].ModelOutput.Risk != "medium" {
+		t.Errorf("Risk = %q, want medium from step 3", log.Iterations[0].ModelOutput.Risk)
+	}
+}
+
+func TestScriptExecuteStepsAndFix(t *testing.T) {
+	s := startSession(t, `[
+		{"summary": "Build", "steps": [
+			{"command": "echo one > one.txt", "explanation": "- writes one.txt"},
+			{"command": "echo broken >&2; exit 3", "explanation": "- fails"}
+		]},
+		{"summary": "Build, fixed", "steps": [
+			{"command": "echo two > two.txt", "explanation": "- writes two.txt"}
+		]}
+	]`, "--script", "build it")
+	s.expect("[X]")
+	s.send("x")
+	s.expect("Step 1/2:")
+	s.send("r")
+	s.expect("Exit code 0")
+	s.expect("Step 2/2:")
+	s.send("r")
+	s.expect("Exit code 3")
+	s.expect("[F]")
+	s.send("f")
+	s.expect("Build, fixed")
+	s.expect("[X]")
+	s.send("x")
+	s.expect("Step 1/1:")
+	s.send("r")
+	if code := s.wait(); code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+
+	for _, name := range []string{"one.txt", "two.txt"} {
+		if _, err := os.Stat(filepath.Join(s.home, name)); err != nil {
+			t.Errorf("step writing %s did not run: %v", name, err)
+		}
+	}
+
+	log := s.sessionLog()
+	if log.Metadata.FinalStatus != logging.StatusExecuted || log.Metadata.AcceptedCommand != "echo two > two.txt" {
+		t.Errorf("metadata = %+v", log.Metadata)
+	}
+	if len(log.Iterations) != 2 {
+		t.Fatalf("iterations = %d, want 2", len(log.Iterations))
+	}
+	first := log.Iterations[0].ModelOutput.Steps
+	if len(first) != 2 || first[0].Execution == nil || first[0].Execution.ExitCode != 0 ||
+		first[1].Execution == nil || first[1].Execution.ExitCode != 3 || first[1].Execution.Stderr != "broken" {
+		t.Errorf("first iteration steps = %+v", first)
+	}
+	if fb := log.Iterations[1].Feedback; !strings.Contains(fb, "Step 2 of the script failed") || !strings.Contains(fb, "broken") {
+		t.Errorf("feedback = %q", fb)
+	}
+	if !strings.Contains(log.Iterations[1].ModelInput.UserPrompt, "Command: echo one > one.txt && echo broken") {
+		t.Errorf("user prompt should include the failed script:\n%s", log.Iterations[1].ModelInput.UserPrompt)
+	}
+}
+
+func TestBuffer(t *testing.T) {
+	// A partial command on the command line is completed without asking for a request
+	s := startSession(t, twoResponses, "--output", "out.txt", "--buffer", "git comit -m wip", "--cursor", "9")
+	s.expect("Completing:")
+	s.expect("[Q]")
+	s.send("q")
+	s.wait()
+
+	log := s.sessionLog()
+	if log.UserQuery != "complete: git comit -m wip" {
+		t.Errorf("query = %q", log.UserQuery)
+	}
+	prompt := log.Iterations[0].ModelInput.UserPrompt
+	if !strings.Contains(prompt, "Partial command on the user's command line") || !strings.Contains(prompt, "git comit<cursor> -m wip") || strings.Contains(prompt, "User request:") {
+		t.Errorf("prompt is missing the partial command:\n%s", prompt)
+	}
+
+	// A # comment is the request
+	s = startSession(t, twoResponses, "--output", "out.txt", "--buffer", "# list go files", "--cursor", "15")
+	s.expect("[Q]")
+	s.send("q")
+	s.wait()
+
+	log = s.sessionLog()
+	prompt = log.Iterations[0].ModelInput.UserPrompt
+	if log.UserQuery != "list go files" || !strings.Contains(prompt, "User request: list go files") || strings.Contains(prompt, "Partial command") {
+		t.Errorf("query = %q, prompt:\n%s", log.UserQuery, prompt)
+	}
+}
+
+func TestSettingsFiles(t *testing.T) {
+	home := t.TempDir()
+	if err := os.Mkdir(filepath.Join(home, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	settings := "model = \"sonnet\"\nproviders = [\"build_tools\"]\npreferences = [\"Use podman, not docker\"]\n" +
+		"[profile.fast]\ncontext_budget = 2000\npreferences = [\"Keep it short\"]\n"
+	if err := os.WriteFile(filepath.Join(home, ".cmd.toml"), []byte(settings), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, "README.md"), []byte("# Project\n\n## Usage\n\n```bash\nmake run\n```\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(home, ".cmd"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".cmd", "claude.md"), []byte("- Target Alpine Linux\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := startSessionIn(t, home, twoResponses, "--profile", "fast", "--output", "out.txt", "run it")
+	s.expect("[Q]")
+	s.send("q")
+	s.wait()
+
+	log := s.sessionLog()
+	input := log.Iterations[0].ModelInput
+	if !strings.Contains(input.SystemPrompt, "- Target Alpine Linux\n\n- Use podman, not docker\n- Keep it short") {
+		t.Errorf("system prompt is missing the project preferences:\n%s", input.SystemPrompt)
+	}
+	var paths []string
+	for _, file := range log.ContextSources.ClaudeMdFiles {
+		paths = append(paths, file.Path)
+	}
+	wantPaths := []string{filepath.Join(home, ".config", "cmd", "claude.md"), filepath.Join(home, ".cmd", "claude.md")}
+	if !slices.Equal(paths, wantPaths) {
+		t.Errorf("claude.md files = %q, want %q", paths, wantPaths)
+	}
+	if prefs, want := log.ContextSources.SettingsPreferences, []string{"Use podman, not docker", "Keep it short"}; !slices.Equal(prefs, want) {
+		t.Errorf("settings preferences = %q, want %q", prefs, want)
+	}
+	if log.Metadata.Profile != "fast" {
+		t.Errorf("profile = %q, want fast", log.Metadata.Profile)
+	}
+	if strings.Contains(input.UserPrompt, "Project documentation") || log.ContextSources.DocumentationContext != "" {
+		t.Errorf("docs were included although only build_tools is enabled:\n%s", input.UserPrompt)
+	}
+
+	// The --model flag wins over the file
+	cmd := exec.Command(buildBinary(t), "config", "show", "--model", "haiku")
+	cmd.Dir = home
+	cmd.Env = []string{"HOME=" + home, "CMD_PROVIDER=anthropic", "CMD_PROFILE=fast"}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("cmd config show failed: %v\n%s", err, out)
+	}
+	for _, want := range []string{`model = "haiku"`, "# --model", `provider = "anthropic"`, "# $CMD_PROVIDER", `providers = ["build_tools"]`, "# " + filepath.Join(home, ".cmd.toml"), "# Profile: fast ($CMD_PROFILE)", "# profile fast in " + filepath.Join(home, ".cmd.toml")} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("config show output missing %q:\n%s", want, out)
+		}
+	}
+
+	// A mistyped --profile is fatal, but the same name in $CMD_PROFILE only warns
+	cmd = exec.Command(buildBinary(t), "config", "show", "--profile", "fsat")
+	cmd.Dir = home
+	cmd.Env = []string{"HOME=" + home}
+	out, err = cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 || !strings.Contains(string(out), `Error: --profile: unknown profile "fsat" (defined: fast)`) {
+		t.Errorf("cmd config show --profile fsat = %v:\n%s", err, out)
+	}
+	cmd = exec.Command(buildBinary(t), "config", "show")
+	cmd.Dir = home
+	cmd.Env = []string{"HOME=" + home, "CMD_PROFILE=fsat"}
+	out, err = cmd.CombinedOutput()
+	if err != nil || !strings.Contains(string(out), `Warning: Could not load settings: $CMD_PROFILE: unknown profile "fsat"`) {
+		t.Errorf("cmd config show with CMD_PROFILE=fsat = %v:\n%s", err, out)
+	}
+}
+
+func TestShellHistoryContext(t *testing.T) {
+	// Outside tmux, the bash history file is the terminal context
+	newHome := func() string {
+		home := t.TempDir()
+		history := "cat notes.txt\ncd /tmp\ngo test ./...\nmake deploy\n"
+		if err := os.WriteFile(filepath.Join(home, ".bash_history"), []byte(history), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(home, "notes.txt"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return home
+	}
+
+	home := newHome()
+	s := startSessionEnv(t, home, []string{"SHELL=/bin/bash"}, twoResponses, "--history-commands", "2", "--output", "out.txt", "list go files")
+	s.expect("[Q]")
+	s.send("q")
+	s.wait()
+
+	log := s.sessionLog()
+	info := log.TerminalInfo()
+	if info.Provider != "bash_history" || info.Commands != 2 || info.HistoryFile != filepath.Join(home, ".bash_history") {
+		t.Errorf("terminal info = %+v", info)
+	}
+	prompt := log.Iterations[0].ModelInput.UserPrompt
+	if !strings.Contains(prompt, "Recent commands from bash history") || !strings.Contains(prompt, "go test ./...\nmake deploy") || strings.Contains(prompt, "cd /tmp") {
+		t.Errorf("prompt is missing the last 2 history commands:\n%s", prompt)
+	}
+
+	// --history-here keeps only commands that refer to files in the directory
+	home = newHome()
+	s = startSessionEnv(t, home, []string{"SHELL=/bin/bash"}, twoResponses, "--history-here", "--output", "out.txt", "list go files")
+	s.expect("[Q]")
+	s.send("q")
+	s.wait()
+
+	log = s.sessionLog()
+	if info := log.TerminalInfo(); info.Commands != 1 || info.Dir != home {
+		t.Errorf("terminal info = %+v", info)
+	}
+	if prompt := log.Iterations[0].ModelInput.UserPrompt; !strings.Contains(prompt, "cat notes.txt") || strings.Contains(prompt, "make deploy") {
+		t.Errorf("prompt was not scoped to the directory:\n%s", prompt)
+	}
+}
+
+func TestContextBudgetTruncatesDocs(t *testing.T) {
+	home := t.TempDir()
+	readme := "# Project\n\n## Usage\n\n```bash\n" + strings.Repeat("make build-everything-with-a-long-target-name\n", 200) + "```\n"
+	if err := os.WriteFile(filepath.Join(home, "README.md"), []byte(readme), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := startSessionIn(t, home, twoResponses, "--context-budget", "1000", "--output", "out.txt", "build it")
+	s.expect("Context trimmed")
+	s.expect("[Q]")
+	s.send("q")
+	s.wait()
+
+	log := s.sessionLog()
+	if len(log.ContextSources.Truncations) != 1 || log.ContextSources.Truncations[0].Source != "docs" {
+		t.Fatalf("truncations = %+v", log.ContextSources.Truncations)
+	}
+	prompt := log.Iterations[0].ModelInput.UserPrompt
+	if !strings.Contains(prompt, "[truncated ") || len(prompt) > 4000+len("build it") {
+		t.Errorf("prompt was not trimmed (%d bytes)", len(prompt))
+	}
+}
+
+func TestRedactsSecretsFromContext(t *testing.T) {
+	home := t.TempDir()
+	readme := "# Project\n\n## Setup\n\n```bash\nexport AWS_SECRET_ACCESS_KEY=wJalrXUtnFEMIK7MDENG\nmake deploy\n```\n"
+	if err := os.WriteFile(filepath.Join(home, "README.md"), []byte(readme), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := startSessionIn(t, home, twoResponses, "--output", "out.txt", "deploy it")
+	s.expect("Redacted 1 secret from context (1 assignment)")
+	s.expect("[Q]")
+	s.send("q")
+	s.wait()
+
+	log := s.sessionLog()
+	if strings.Contains(log.ContextSources.DocumentationContext, "wJalrXUtnFEMIK7MDENG") {
+		t.Error("secret was logged in the docs context")
+	}
+	prompt := log.Iterations[0].ModelInput.UserPrompt
+	if strings.Contains(prompt, "wJalrXUtnFEMIK7MDENG") || !strings.Contains(prompt, "AWS_SECRET_ACCESS_KEY=[REDACTED:assignment]") {
+		t.Errorf("prompt was not redacted:\n%s", prompt)
+	}
+	if got := log.Metadata.Redactions["assignment"]; got != 1 {
+		t.Errorf("Redactions = %v, want 1 assignment", log.Metadata.Redactions)
+	}
+}
+
+func TestRedactsSecretsFromQueryAndFeedback(t *testing.T) {
+	s := startSession(t, twoResponses, "--output", "out.txt", "log in with API_KEY=k3y-from-query")
+	s.expect("[Q]")
+	s.send("r")
+	s.expect("Enter feedback: ")
+	s.send("it needs password: hunter2-feedback\n")
+	s.expect("Redacted 1 secret from feedback (1 assignment)")
+	s.expect("[Q]")
+	s.send("q")
+	s.wait()
+
+	log := s.sessionLog()
+	data, err := json.Marshal(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"k3y-from-query", "hunter2-feedback"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("secret %q was logged", secret)
+		}
+	}
+	if log.UserQuery != "log in with API_KEY=[REDACTED:assignment]" {
+		t.Errorf("UserQuery = %q", log.UserQuery)
+	}
+	if prompt := log.Iterations[1].ModelInput.UserPrompt; !strings.Contains(prompt, "password: [REDACTED:assignment]") {
+		t.Errorf("feedback was not redacted in the prompt:\n%s", prompt)
+	}
+	if got := log.Metadata.Redactions["assignment"]; got != 2 {
+		t.Errorf("Redactions = %v, want 2 assignment", log.Metadata.Redactions)
+	}
+}
+
+func TestInteractiveQuit(t *testing.T) {
+	s := startSession(t, twoResponses, "--output", "out.txt", "list go files")
+	s.expect("[Q]")
+	s.send("q")
+	if code := s.wait(); code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+
+	if _, err := os.Stat(filepath.Join(s.home, "out.txt")); !os.IsNotExist(err) {
+		t.Error("output file should not be written on quit")
+	}
+	if status := s.sessionLog().Metadata.FinalStatus; status != logging.StatusQuit {
+		t.Errorf("FinalStatus = %q, want quit", status)
+	}
+}
+
+func TestInteractivePromptForQuery(t *testing.T) {
+	s := startSession(t, twoResponses, "--output", "out.txt")
+	s.expect("What do you need? ")
+	s.send("list go files\n")
+	s.expect("[Q]")
+	s.send("q")
+	s.wait()
+
+	if query := s.sessionLog().UserQuery; query != "list go files" {
+		t.Errorf("UserQuery = %q, want %q", query, "list go files")
+	}
+}
+
+func TestInteractiveCtrlCAtFeedbackPrompt(t *testing.T) {
+	s := startSession(t, twoResponses, "--output", "out.txt", "list go files")
+	s.expect("[Q]")
+	s.send("r")
+	s.expect("Enter feedback: ")
+	s.send("\x03")
+	if code := s.wait(); code != 130 {
+		t.Fatalf("exit code = %d, want 130", code)
+	}
+
+	log := s.sessionLog()
+	if log.Metadata.FinalStatus != logging.StatusQuit || len(log.Iterations) != 1 {
+		t.Errorf("unexpected log: status=%q iterations=%d", log.Metadata.FinalStatus, len(log.Iterations))
+	}
+}
+
+func TestInteractiveRetriesTransientFailure(t *testing.T) {
+	fixture := `[
+		{"error": "overloaded"},
+		{"command": "ls", "explanation": "- ls: list files"}
+	]`
+	s := startSession(t, fixture, "--output", "out.txt", "--retries", "1", "list files")
+	s.expect("Attempt 1 failed: overloaded. Retrying...")
+	s.expect("[Q]")
+	s.send("a")
+	if code := s.wait(); code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+
+	log := s.sessionLog()
+	if len(log.Iterations) != 2 {
+		t.Fatalf("iterations = %d, want 2", len(log.Iterations))
+	}
+	if log.Iterations[0].Error != "overloaded" || log.Iterations[1].Error != "" {
+		t.Errorf("errors = %q, %q; want failed attempt logged first", log.Iterations[0].Error, log.Iterations[1].Error)
+	}
+}
+
+func TestInteractiveRetryPromptAfterFailure(t *testing.T) {
+	fixture := `[
+		{"error": "overloaded"},
+		{"command": "ls", "explanation": "- ls: list files"}
+	]`
+	s := startSession(t, fixture, "--output", "out.txt", "--retries", "0", "list files")
+	s.expect("Error: overloaded")
+	s.expect("[R]")
+	s.send("r")
+	s.expect("[Q]")
+	s.send("q")
+	if code := s.wait(); code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+
+	log := s.sessionLog()
+	if len(log.Iterations) != 2 || log.Iterations[0].Error == "" {
+		t.Errorf("expected a failed then successful iteration, got %+v", log.Iterations)
+	}
+}
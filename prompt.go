@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jerryluo/cmd/internal/claude"
+	"github.com/jerryluo/cmd/internal/config"
+	"github.com/jerryluo/cmd/internal/terminal"
+)
+
+// runPrompt implements `cmd prompt`: show the prompt template in use, render
+// the exact prompt the selected backend would send for a query, or print the
+// built-in template to start from
+func runPrompt(args []string) {
+	fs := flag.NewFlagSet("prompt", flag.ExitOnError)
+	render := fs.Bool("render", false, "Print the system and user prompts that would be sent for the query")
+	showDefault := fs.Bool("default", false, "Print the built-in template")
+	addSettingFlags(fs, "profile", "model", "provider", "context_lines", "context_budget")
+	historyCommands := fs.Int("history-commands", terminal.HistoryCommands, "Number of shell history commands to include when not in tmux")
+	historyHere := fs.Bool("history-here", false, "Only include shell history commands that refer to files in the current directory")
+	script := fs.Bool("script", false, "Render the prompt for --script mode")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  cmd prompt                    Show which template files are in use")
+		fmt.Fprintln(os.Stderr, "  cmd prompt --render <query>   Print the exact prompt for a query (add --script for script mode)")
+		fmt.Fprintln(os.Stderr, "  cmd prompt --default          Print the built-in template")
+		fmt.Fprintln(os.Stderr)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	switch {
+	case *showDefault:
+		fmt.Print(claude.DefaultTemplate)
+
+	case *render:
+		query := strings.Join(fs.Args(), " ")
+		if query == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+
+		settings := loadSettings(fs)
+		// The backend isn't checked: rendering doesn't need it to be reachable
+		cfg := config.Load(settings)
+		generator, err := claude.NewGenerator(cfg.Provider, cfg.Model, generatorOptions(cfg))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+		redactor := loadRedactor(settings)
+		pc := gatherContext(settings, terminalOptions(settings, *historyCommands, *historyHere), redactor)
+		req := claude.Request{Query: redactor.Redact(query, pc.redactions), Template: loadPromptTemplate()}
+		if *script {
+			req.Mode = claude.ModeScript
+		}
+		req, _ = pc.request(req, settings.ContextBudget)
+		system, user, err := generator.Prompts(req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Prompts for %s (%s)\n\n", generator.Model(), generator.Provider())
+		fmt.Println("=== System prompt ===")
+		fmt.Println(system)
+		fmt.Println()
+		fmt.Println("=== User prompt ===")
+		fmt.Println(user)
+
+	default:
+		tmpl := loadPromptTemplate()
+		if len(tmpl.Sources) == 0 {
+			fmt.Println("Using the built-in prompt template.")
+		} else {
+			fmt.Println("Using the built-in prompt template, overridden by:")
+			for _, path := range tmpl.Sources {
+				fmt.Printf("  %s\n", path)
+			}
+		}
+		fmt.Println()
+		fmt.Printf("Templates are read from ~/.config/cmd/%s and the nearest %s/%s.\n", config.PromptTemplateName, config.ProjectDirName, config.PromptTemplateName)
+		fmt.Println("Run `cmd prompt --default` for a starting point.")
+	}
+}
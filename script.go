@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jerryluo/cmd/internal/claude"
+	"github.com/jerryluo/cmd/internal/logging"
+	"github.com/jerryluo/cmd/internal/redact"
+	"github.com/jerryluo/cmd/internal/safety"
+)
+
+// defaultScriptName is offered when saving a script
+const defaultScriptName = "script.sh"
+
+// scriptStep is one step of a generated script as the user reviews it
+type scriptStep struct {
+	claude.Step
+	original  string // The model's command, if the user edited it
+	skipped   bool
+	findings  []safety.Finding
+	execution *logging.Execution
+}
+
+// risk combines the model's rating of the step with the local safety findings
+func (s *scriptStep) risk() string {
+	return riskLevel(claude.Alternative{Risk: s.Risk}, s.findings)
+}
+
+// scriptReview lets the user skip and edit the steps of a --script response,
+// then copy the joined command, save a script file, or run the steps one at a time
+type scriptReview struct {
+	reader     *bufio.Reader
+	interrupts *interruptHandler
+	logger     *logging.Logger
+	rules      *safety.Rules
+	redactor   *redact.Redactor
+	redactions redact.Counts
+	output     string // --output file for the joined command
+
+	summary string
+	steps   []*scriptStep
+}
+
+// run reviews the steps of response. It exits the process once the script is
+// accepted, saved, run or abandoned, and only returns the feedback to
+// regenerate with when the user rejects the script or asks to fix a failed step.
+func (r *scriptReview) run(response *claude.Response) claude.Turn {
+	r.summary = response.Summary
+	r.steps = nil
+	for _, step := range response.Steps {
+		r.steps = append(r.steps, &scriptStep{Step: step, findings: r.rules.Check(step.Command)})
+	}
+	r.logSteps()
+	r.display()
+
+	for {
+		fmt.Printf("\033[1m[1-%d]\033[0m skip/include  \033[1m[E]\033[0mdit  ", len(r.steps))
+		fmt.Print("\033[1m[A]\033[0mccept  \033[1m[S]\033[0mave  \033[1m[X]\033[0mecute  \033[1m[R]\033[0meject with feedback  \033[1m[Q]\033[0muit: ")
+
+		key, err := readSingleKey()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nError reading input: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println() // Move to next line after keypress
+
+		switch {
+		case key >= '1' && key <= '9':
+			n := int(key - '0')
+			if n > len(r.steps) {
+				fmt.Printf("No step %d.\n", n)
+				continue
+			}
+			r.steps[n-1].skipped = !r.steps[n-1].skipped
+			r.logSteps()
+			r.display()
+
+		case key == 'e' || key == 'E':
+			if r.edit() {
+				r.logSteps()
+				r.display()
+			}
+
+		case key == 'a' || key == 'A':
+			if !r.ready("accepted") {
+				continue
+			}
+			command := claude.JoinSteps(r.commands())
+			r.logger.SetAccepted(1, command)
+			r.logger.Finalize(logging.StatusAccepted, "")
+			deliverCommand(command, r.output)
+			os.Exit(0)
+
+		case key == 's' || key == 'S':
+			if !r.ready("saved") {
+				continue
+			}
+			path := r.save()
+			if path == "" {
+				continue
+			}
+			r.logger.SetAccepted(1, claude.JoinSteps(r.commands()))
+			r.logger.Finalize(logging.StatusAccepted, "")
+			fmt.Printf("Script saved to %s\n", path)
+			os.Exit(0)
+
+		case key == 'x' || key == 'X':
+			if !r.ready("executed") {
+				continue
+			}
+			return r.execute()
+
+		case key == 'r' || key == 'R':
+			fmt.Print("Enter feedback: ")
+			feedback, err := r.reader.ReadString('\n')
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading feedback: %v\n", err)
+				os.Exit(1)
+			}
+			feedback = strings.TrimSpace(feedback)
+			if feedback == "" {
+				fmt.Println("No feedback provided, please try again.")
+				continue
+			}
+			feedback = redactFeedback(r.redactor, feedback, r.redactions, r.logger)
+			return claude.Turn{Command: claude.JoinSteps(r.commands()), Feedback: feedback}
+
+		case key == 'q' || key == 'Q' || key == 3: // 3 = Ctrl+C
+			r.logger.Finalize(logging.StatusQuit, "")
+			fmt.Println("Exiting without copying.")
+			os.Exit(0)
+
+		default:
+			fmt.Println("Invalid option. Please enter a step number, E, A, S, X, R, or Q.")
+		}
+	}
+}
+
+// display prints the summary and every step, dimming skipped ones
+func (r *scriptReview) display() {
+	fmt.Println()
+	if r.summary != "" {
+		fmt.Printf("\033[1mScript:\033[0m %s\n", r.summary)
+		fmt.Println()
+	}
+
+	for i, step := range r.steps {
+		if step.skipped {
+			fmt.Printf("  %d. \033[2;9m%s\033[0m \033[2m(skipped)\033[0m\n", i+1, step.Command)
+			continue
+		}
+		edited := ""
+		if step.original != "" {
+			edited = " \033[2m(edited)\033[0m"
+		}
+		fmt.Printf("  %d. \033[1m%s\033[0m%s%s\n", i+1, step.Command, edited, riskTag(step.risk()))
+		for _, line := range explanationLines(step.Explanation) {
+			fmt.Printf("     • %s\n", line)
+		}
+		for _, reason := range step.RiskReasons {
+			fmt.Printf("     \033[33m⚠ %s\033[0m\n", reason)
+		}
+		for _, f := range step.findings {
+			fmt.Printf("     \033[33m⚠ %s\033[0m \033[2m[%s]\033[0m\n", f.Message, f.Rule)
+		}
+	}
+	fmt.Println()
+}
+
+// explanationLines splits an explanation into lines without their bullets
+func explanationLines(explanation string) []string {
+	var lines []string
+	for _, line := range strings.Split(explanation, "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimPrefix(line, "- ")
+		line = strings.TrimPrefix(line, "* ")
+		line = strings.TrimPrefix(line, "• ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// commands returns the commands of the steps that are not skipped, in order
+func (r *scriptReview) commands() []string {
+	var commands []string
+	for _, step := range r.steps {
+		if !step.skipped {
+			commands = append(commands, step.Command)
+		}
+	}
+	return commands
+}
+
+// ready checks there is something left to use and asks for confirmation if
+// any remaining step is high risk. action completes "Not ...".
+func (r *scriptReview) ready(action string) bool {
+	if len(r.commands()) == 0 {
+		fmt.Println("Every step is skipped.")
+		return false
+	}
+	for _, step := range r.steps {
+		if !step.skipped && step.risk() == claude.RiskHigh {
+			if !confirmHighRisk(r.reader) {
+				fmt.Printf("Not %s.\n", action)
+				return false
+			}
+			break
+		}
+	}
+	return true
+}
+
+// edit replaces the command of a step chosen by number. It returns false if nothing changed.
+func (r *scriptReview) edit() bool {
+	fmt.Printf("Edit step [1-%d]: ", len(r.steps))
+	key, err := readSingleKey()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nError reading input: %v\n", err)
+		return false
+	}
+	fmt.Println()
+	n := int(key - '0')
+	if n < 1 || n > len(r.steps) {
+		fmt.Println("No such step.")
+		return false
+	}
+
+	step := r.steps[n-1]
+	fmt.Printf("Step %d: %s\n", n, step.Command)
+	fmt.Print("New command (empty to keep): ")
+	line, err := r.reader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	command := strings.TrimSpace(line)
+	if command == "" || command == step.Command {
+		return false
+	}
+
+	if step.original == "" {
+		step.original = step.Command
+	} else if command == step.original {
+		step.original = "" // Edited back to the model's command
+	}
+	step.Command = command
+	step.findings = r.rules.Check(command)
+	step.skipped = false
+	return true
+}
+
+// save writes the remaining steps to a new executable shell script, asking for
+// its path. It returns the path, or "" if nothing was saved.
+func (r *scriptReview) save() string {
+	fmt.Printf("Save script as [%s]: ", defaultScriptName)
+	line, err := r.reader.ReadString('\n')
+	if err != nil {
+		return ""
+	}
+	path := strings.TrimSpace(line)
+	if path == "" {
+		path = defaultScriptName
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0755)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			fmt.Fprintf(os.Stderr, "Error: %s already exists\n", path)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return ""
+	}
+	_, err = f.WriteString(r.scriptFile())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing to %s: %v\n", path, err)
+		return ""
+	}
+	return path
+}
+
+// scriptFile renders the remaining steps as a shell script that stops at the
+// first failure, with each step's explanation as a comment
+func (r *scriptReview) scriptFile() string {
+	var sb strings.Builder
+	sb.WriteString("#!/bin/sh\n")
+	if r.summary != "" {
+		fmt.Fprintf(&sb, "# %s\n", r.summary)
+	}
+	sb.WriteString("set -e\n")
+	for i, step := range r.steps {
+		if step.skipped {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n# Step %d\n", i+1)
+		for _, line := range explanationLines(step.Explanation) {
+			fmt.Fprintf(&sb, "#   %s\n", line)
+		}
+		sb.WriteString(step.Command)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// execute runs the remaining steps one at a time, asking before each. It exits
+// once the steps have run or the user stops, and only returns if a step failed
+// and the user asked for a fix.
+func (r *scriptReview) execute() claude.Turn {
+	var executed []string
+	finish := func() {
+		if len(executed) == 0 {
+			r.logger.Finalize(logging.StatusQuit, "")
+		} else {
+			r.logger.SetAccepted(1, claude.JoinSteps(executed))
+			r.logger.Finalize(logging.StatusExecuted, "")
+		}
+		os.Exit(0)
+	}
+
+	for i, step := range r.steps {
+		if step.skipped {
+			continue
+		}
+
+		fmt.Printf("\n\033[1mStep %d/%d:\033[0m %s\n", i+1, len(r.steps), step.Command)
+		switch r.askStep() {
+		case 's':
+			step.skipped = true
+			r.logSteps()
+			continue
+		case 'q':
+			finish()
+		}
+
+		result := runCommand(r.interrupts, step.Command)
+		if result == nil {
+			finish()
+		}
+		redactOutput(r.redactor, result, r.redactions, r.logger)
+		execution := logExecution(step.Command, result)
+		step.execution = &execution
+		r.logSteps()
+		executed = append(executed, step.Command)
+
+		// Later steps depend on this one, so stop at the first failure
+		if result.ExitCode != 0 {
+			if offerFix() {
+				feedback := fmt.Sprintf("Step %d of the script failed. %s", i+1, executionFeedback(step.Command, result))
+				return claude.Turn{Command: claude.JoinSteps(r.commands()), Feedback: feedback}
+			}
+			finish()
+		}
+	}
+	finish()
+	return claude.Turn{} // Unreachable: finish exits
+}
+
+// askStep asks whether to run, skip or stop before a step, returning 'r', 's' or 'q'
+func (r *scriptReview) askStep() byte {
+	for {
+		fmt.Print("\033[1m[R]\033[0mun  \033[1m[S]\033[0mkip  \033[1m[Q]\033[0muit: ")
+
+		key, err := readSingleKey()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nError reading input: %v\n", err)
+			return 'q'
+		}
+		fmt.Println()
+
+		switch key {
+		case 'r', 'R', '\r', '\n':
+			return 'r'
+		case 's', 'S':
+			return 's'
+		case 'q', 'Q', 3: // 3 = Ctrl+C
+			return 'q'
+		default:
+			fmt.Println("Invalid option. Please enter R, S, or Q.")
+		}
+	}
+}
+
+// logSteps records the steps as they stand in the session log
+func (r *scriptReview) logSteps() {
+	steps := make([]logging.Step, len(r.steps))
+	for i, step := range r.steps {
+		steps[i] = logging.Step{
+			Command:     step.Command,
+			Explanation: step.Explanation,
+			Risk:        step.Risk,
+			RiskReasons: step.RiskReasons,
+			Findings:    logFindings(step.findings),
+			Original:    step.original,
+			Skipped:     step.skipped,
+			Execution:   step.execution,
+		}
+	}
+	r.logger.SetSteps(steps)
+}
@@ -0,0 +1,45 @@
+# cmd bash integration: eval "$(cmd init bash)" in ~/.bashrc (bash 4+)
+
+# Tell cmd the last command's exit status, which the tmux scrollback doesn't
+# show. First in PROMPT_COMMAND, so nothing changes $? before it.
+if [[ $PROMPT_COMMAND != *CMD_LAST_STATUS* ]]; then
+    PROMPT_COMMAND='export CMD_LAST_STATUS=$?'${PROMPT_COMMAND:+$'\n'$PROMPT_COMMAND}
+fi
+
+cmd-generate() {
+    local tmpfile
+    tmpfile=$(mktemp /tmp/cmd-output.XXXXXX) || return
+    command stty sane </dev/tty 2>/dev/null
+    # A partial command is completed; a "# comment" is the request
+    if command cmd --output "$tmpfile" --buffer "$READLINE_LINE" --cursor "$READLINE_POINT" </dev/tty && [[ -s $tmpfile ]]; then
+        READLINE_LINE=$(<"$tmpfile")
+        READLINE_POINT=${#READLINE_LINE}
+    fi
+    rm -f "$tmpfile"
+}
+
+cmd-explain() {
+    if [[ -z $READLINE_LINE ]]; then
+        return
+    fi
+    printf '%s\n' "$READLINE_LINE" | command cmd explain
+}
+
+cmd-fix() {
+    local tmpfile last
+    tmpfile=$(mktemp /tmp/cmd-output.XXXXXX) || return
+    # Inside bind -x, fc -1 skips the last command, so read it with history
+    # and strip the "  <n>  " prefix
+    last=$(HISTTIMEFORMAT= builtin history 1)
+    last=${last#*[0-9]  }
+    command stty sane </dev/tty 2>/dev/null
+    if command cmd fix --output "$tmpfile" --command "$last" </dev/tty && [[ -s $tmpfile ]]; then
+        READLINE_LINE=$(<"$tmpfile")
+        READLINE_POINT=${#READLINE_LINE}
+    fi
+    rm -f "$tmpfile"
+}
+
+bind -x '"\C-g": cmd-generate'
+bind -x '"\ee": cmd-explain'
+bind -x '"\eg": cmd-fix'
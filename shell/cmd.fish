@@ -1,7 +1,35 @@
+# Tell cmd the last command's exit status, which the tmux scrollback doesn't show
+function __cmd_postexec --on-event fish_postexec
+    set -gx CMD_LAST_STATUS $status
+end
+
 function cmd-generate --description "Generate a command with AI"
+    set -l tmpfile (mktemp /tmp/cmd-output.XXXXXX)
+    # A partial command is completed; a "# comment" is the request
+    set -l buffer (commandline | string collect)
+    command stty sane </dev/tty 2>/dev/null
+    command cmd --output $tmpfile --buffer "$buffer" --cursor (commandline -C) </dev/tty
+    if test $status -eq 0 -a -s $tmpfile
+        commandline -r (cat $tmpfile)
+    end
+    rm -f $tmpfile
+    commandline -f repaint
+end
+
+function cmd-explain --description "Explain the current command line with AI"
+    set -l current (commandline)
+    if test -z "$current"
+        return
+    end
+    echo
+    commandline | command cmd explain
+    commandline -f repaint
+end
+
+function cmd-fix --description "Fix the last command with AI"
     set -l tmpfile (mktemp /tmp/cmd-output.XXXXXX)
     command stty sane </dev/tty 2>/dev/null
-    command cmd --output $tmpfile </dev/tty
+    command cmd fix --output $tmpfile --command "$history[1]" </dev/tty
     if test $status -eq 0 -a -s $tmpfile
         commandline -r (cat $tmpfile)
     end
@@ -10,3 +38,5 @@ function cmd-generate --description "Generate a command with AI"
 end
 
 bind \cg cmd-generate
+bind \ee cmd-explain
+bind \eg cmd-fix
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// spinner shows an animated status line with the elapsed time and the tail of
+// the explanation streamed so far while a command is being generated
+type spinner struct {
+	label   string
+	start   time.Time
+	tty     bool
+	mu      sync.Mutex
+	partial string
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// startSpinner prints label and, on a terminal, animates it until stop is called
+func startSpinner(label string) *spinner {
+	s := &spinner{
+		label: label,
+		start: time.Now(),
+		tty:   term.IsTerminal(int(os.Stdout.Fd())),
+		done:  make(chan struct{}),
+	}
+
+	if !s.tty {
+		fmt.Printf("%s...\n", label)
+		return s
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for frame := 0; ; frame++ {
+			s.render(spinnerFrames[frame%len(spinnerFrames)])
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
+
+// update records the explanation streamed so far; it is safe to call from any goroutine
+func (s *spinner) update(explanation string) {
+	s.mu.Lock()
+	s.partial = explanation
+	s.mu.Unlock()
+}
+
+// println prints a message on its own line above the status line and clears
+// the streamed explanation, e.g. when an attempt fails and is retried
+func (s *spinner) println(msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.partial = ""
+	if s.tty {
+		fmt.Printf("\r\033[K%s\n", msg)
+	} else {
+		fmt.Println(msg)
+	}
+}
+
+// render redraws the status line
+func (s *spinner) render(frame string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	partial := s.partial
+
+	line := fmt.Sprintf("%s %s (%.1fs)", frame, s.label, time.Since(s.start).Seconds())
+
+	// Show the most recent line of the streamed explanation after the status
+	if lines := strings.Split(strings.TrimSpace(partial), "\n"); lines[len(lines)-1] != "" {
+		line += "  " + strings.TrimSpace(lines[len(lines)-1])
+	}
+
+	width := 80
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		// Too narrow a terminal still gets the start of the status
+		width = max(w, 10)
+	}
+	if runes := []rune(line); len(runes) > width-1 {
+		line = string(runes[:width-2]) + "…"
+	}
+
+	fmt.Printf("\r\033[K%s", line)
+}
+
+// stop ends the animation, replaces it with a summary line and returns the elapsed time
+func (s *spinner) stop(summary string) time.Duration {
+	elapsed := time.Since(s.start)
+	if !s.tty {
+		fmt.Printf("%s (%.1fs)\n", summary, elapsed.Seconds())
+		return elapsed
+	}
+
+	close(s.done)
+	s.wg.Wait()
+	fmt.Printf("\r\033[K%s (%.1fs)\n", summary, elapsed.Seconds())
+	return elapsed
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jerryluo/cmd/internal/logging"
+	"github.com/jerryluo/cmd/internal/stats"
+)
+
+// runStats implements `cmd stats`: spend, latency and tokens by model and by day
+func runStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	days := fs.Int("days", 30, "Only include sessions from the last n days (0 = all)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: cmd stats [--days <n>]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	logs, err := logging.ReadAllLogs()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading logs: %v\n", err)
+		os.Exit(1)
+	}
+
+	var since time.Time
+	if *days > 0 {
+		now := time.Now()
+		since = time.Date(now.Year(), now.Month(), now.Day()-*days+1, 0, 0, 0, 0, now.Location())
+	}
+
+	if err := stats.Write(os.Stdout, stats.Compute(logs, since)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}